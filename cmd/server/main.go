@@ -1,17 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/jlry-dev/whirl/internal/bus"
 	"github.com/jlry-dev/whirl/internal/config"
 	"github.com/jlry-dev/whirl/internal/handler"
 	"github.com/jlry-dev/whirl/internal/middleware"
+	"github.com/jlry-dev/whirl/internal/origin"
+	"github.com/jlry-dev/whirl/internal/presence"
 	"github.com/jlry-dev/whirl/internal/repository"
 	"github.com/jlry-dev/whirl/internal/service"
+	"github.com/jlry-dev/whirl/internal/storage"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -25,32 +35,80 @@ func main() {
 
 	dbPool := config.InitDB()
 
+	// Storage
+	attachmentDir := os.Getenv("ATTACHMENT_DIR")
+	if attachmentDir == "" {
+		attachmentDir = "uploads"
+	}
+
+	attachmentStore, err := storage.NewFSStorage(attachmentDir)
+	if err != nil {
+		log.Fatalf("failed to initialize attachment storage: %v", err)
+	}
+
 	// Repository
 	userRepository := repository.NewUserRepository()
 	avatarRepository := repository.NewAvatarRepository()
 	countryRepository := repository.NewCountryRepository()
 	friendshipRepository := repository.NewFriendshipRepository()
 	messageRepository := repository.NewMessageRepository()
+	attachmentRepository := repository.NewAttachmentRepository()
+	conversationRepository := repository.NewConversationRepository()
+	randomRepository := repository.NewRandomRepository()
 
 	// Services
 	authSrv := service.NewAuthService(srvConfig.Validate, userRepository, countryRepository, dbPool)
 	userSrv := service.NewUserService(srvConfig.Logger, userRepository, avatarRepository, dbPool)
 	frSrv := service.NewFriendshipService(*srvConfig.Validate, srvConfig.Logger, friendshipRepository, &userRepository, dbPool)
-	msgSrv := service.NewMessageService(srvConfig.Logger, messageRepository, dbPool)
+	msgSrv := service.NewMessageService(srvConfig.Logger, messageRepository, attachmentRepository, dbPool)
+	attachSrv := service.NewAttachmentService(srvConfig.Logger, attachmentRepository, messageRepository, attachmentStore, dbPool)
+	convSrv := service.NewConversationService(srvConfig.Logger, conversationRepository, messageRepository, friendshipRepository, dbPool)
+	randomSrv := service.NewRandomService(srvConfig.Logger, userRepository, countryRepository, randomRepository, dbPool)
+	signalSrv := service.NewSignalService(srvConfig.Logger, config.LoadRTC())
+
+	// Bus between the hubs of the nodes
+	var hubBus bus.Bus
+	var registry presence.Registry
+	var rdb *redis.Client
+	switch cluster := config.LoadCluster(); cluster.Bus {
+	case config.BusPostgres:
+		hubBus = bus.NewPostgresBus(dbPool, srvConfig.Logger)
+	case config.BusRedis:
+		rdb = config.InitRedis(cluster.RedisURL)
+		hubBus = bus.NewRedisBus(rdb, cluster.RedisMode, int64(cluster.RedisStreamLen), srvConfig.Logger)
+		registry = presence.NewRedisRegistry(rdb, cluster.PresenceTTL)
+	default:
+		hubBus = bus.NewMemoryBroker().Connect()
+	}
 
-	hub := handler.NewHub(frSrv, msgSrv, srvConfig.Logger)
+	hub := handler.NewHub(frSrv, msgSrv, convSrv, randomSrv, signalSrv, config.LoadRandomChat(), hubBus, registry, srvConfig.Logger)
 	go hub.Run() // Start Hub work
 
+	// Origins allowed by CORS and the websocket upgrader
+	origins := config.LoadOrigins()
+	originPolicy, err := origin.NewPolicy(origins.Allowed, origins.DevMode)
+	if err != nil {
+		log.Fatalf("failed to load allowed origins: %v", err)
+	}
+
+	if originPolicy.AllowsAll() {
+		srvConfig.Logger.Warn("every origin is allowed, set ALLOWED_ORIGINS to restrict them")
+	}
+
 	// Handler
 	rspHandler := handler.NewResponseHandler(srvConfig.Logger)
 	authHandlr := handler.NewAuthHandler(authSrv, rspHandler, srvConfig.Logger)
 	userHandlr := handler.NewUserHandler(userSrv, srvConfig.Logger)
-	chatHandlr := handler.NewChatHandler(srvConfig.Logger, rspHandler, hub)
+	chatHandlr := handler.NewChatHandler(srvConfig.Logger, rspHandler, hub, config.LoadSocket(), originPolicy)
 	frHandlr := handler.NewFriendshipHandler(srvConfig.Logger, rspHandler, frSrv)
-	msgHandlr := handler.NewMessageHandler(msgSrv, rspHandler, srvConfig.Logger)
+	msgHandlr := handler.NewMessageHandler(msgSrv, hub, rspHandler, srvConfig.Logger)
+	attachHandlr := handler.NewAttachmentHandler(attachSrv, rspHandler, srvConfig.Logger)
+	convHandlr := handler.NewConversationHandler(convSrv, hub, rspHandler, srvConfig.Logger)
+	randomHandlr := handler.NewRandomHandler(randomSrv, hub, rspHandler, srvConfig.Logger)
+	rtcHandlr := handler.NewRTCHandler(signalSrv, rspHandler, srvConfig.Logger)
 
 	// Middleware
-	m := middleware.NewMiddleware(rspHandler, srvConfig.Logger)
+	m := middleware.NewMiddleware(rspHandler, srvConfig.Logger, originPolicy)
 
 	// Multiplexer
 	mux := http.NewServeMux()
@@ -68,6 +126,31 @@ func main() {
 	mux.HandleFunc("GET /friends", m.Authenticator(frHandlr.RetrieveFriends))
 
 	mux.HandleFunc("GET /messages/{id}", m.Authenticator(msgHandlr.RetrieveMessages))
+	mux.HandleFunc("GET /messages/search", m.Authenticator(msgHandlr.SearchMessages))
+	mux.HandleFunc("PUT /message/{id}", m.Authenticator(msgHandlr.EditMessage))
+	mux.HandleFunc("DELETE /message/{id}", m.Authenticator(msgHandlr.DeleteMessage))
+
+	// Attachment
+	mux.HandleFunc("POST /attachment", m.Authenticator(attachHandlr.UploadAttachment))
+	mux.HandleFunc("GET /attachment/{id}", m.Authenticator(attachHandlr.DownloadAttachment))
+	mux.HandleFunc("GET /attachment/{id}/thumbnail", m.Authenticator(attachHandlr.DownloadThumbnail))
+
+	// Group conversation
+	mux.HandleFunc("POST /conversation", m.Authenticator(convHandlr.CreateConversation))
+	mux.HandleFunc("GET /conversations", m.Authenticator(convHandlr.RetrieveConversations))
+	mux.HandleFunc("GET /conversation/{id}", m.Authenticator(convHandlr.RetrieveConversation))
+	mux.HandleFunc("GET /conversation/{id}/messages", m.Authenticator(convHandlr.RetrieveMessages))
+	mux.HandleFunc("POST /conversation/{id}/member", m.Authenticator(convHandlr.InviteMember))
+	mux.HandleFunc("PUT /conversation/{id}/member/{userID}", m.Authenticator(convHandlr.ChangeMemberRole))
+	mux.HandleFunc("DELETE /conversation/{id}/member/{userID}", m.Authenticator(convHandlr.KickMember))
+	mux.HandleFunc("POST /conversation/{id}/leave", m.Authenticator(convHandlr.LeaveConversation))
+
+	// Random chat
+	mux.HandleFunc("POST /random/report", m.Authenticator(randomHandlr.Report))
+	mux.HandleFunc("POST /random/rating", m.Authenticator(randomHandlr.Rate))
+
+	// Voice & video chat
+	mux.HandleFunc("GET /rtc/config", m.Authenticator(rtcHandlr.RetrieveConfig))
 
 	// Chat Matcher Worker
 	mux.HandleFunc("/websocket/connect", m.Authenticator(chatHandlr.SocketConnect))
@@ -82,6 +165,59 @@ func main() {
 		ErrorLog: slog.NewLogLogger(srvConfig.Logger.Handler(), slog.LevelError),
 	}
 
-	log.Println("Server started at port: ", srv_addr)
-	log.Fatal(srv.ListenAndServe())
+	// Counters of the websocket connections among others, kept off the public address
+	if metricsAddr := os.Getenv("METRICS_ADDRESS"); metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /debug/vars", expvar.Handler())
+
+		go func() {
+			log.Println("Metrics served at port: ", metricsAddr)
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				srvConfig.Logger.Error("metrics server stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	// SIGTERM is what orchestrators send, interrupt covers ctrl+c
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	go func() {
+		log.Println("Server started at port: ", srv_addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	srvConfig.Logger.Info("shutting down", slog.Duration("timeout", srvConfig.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), srvConfig.ShutdownTimeout)
+	defer cancel()
+
+	// The hub goes first, it refuses new websockets while the HTTP server still answers with a retry hint
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		srvConfig.Logger.Error("failed to drain the hub", slog.String("error", err.Error()))
+	}
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srvConfig.Logger.Error("failed to shut down the server", slog.String("error", err.Error()))
+	}
+
+	// The bus goes before its connections, closing it gives up the locks of this node
+	if err := hubBus.Close(); err != nil {
+		srvConfig.Logger.Error("failed to close the bus", slog.String("error", err.Error()))
+	}
+
+	if rdb != nil {
+		if err := rdb.Close(); err != nil {
+			srvConfig.Logger.Error("failed to close redis", slog.String("error", err.Error()))
+		}
+	}
+
+	dbPool.Close()
+
+	log.Println("Server stopped")
 }
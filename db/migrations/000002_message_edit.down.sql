@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "message_hidden" CASCADE;
+DROP TABLE IF EXISTS "message_revision" CASCADE;
+
+ALTER TABLE "message" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "message" DROP COLUMN IF EXISTS "edited_at";
+
+DROP TYPE IF EXISTS message_revision_action CASCADE;
@@ -0,0 +1,33 @@
+CREATE TYPE "message_revision_action" AS ENUM (
+  'edited',
+  'deleted'
+);
+
+ALTER TABLE "message" ADD COLUMN "edited_at" timestamp;
+
+ALTER TABLE "message" ADD COLUMN "deleted_at" timestamp;
+
+-- Keeps the content a message had before every edit or delete, used for moderation
+CREATE TABLE "message_revision" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+  "message_id" int NOT NULL,
+  "content" VARCHAR,
+  "action" message_revision_action NOT NULL,
+  "revised_at" timestamp NOT NULL DEFAULT (now())
+);
+
+-- Messages a participant deleted for themselves only
+CREATE TABLE "message_hidden" (
+  "message_id" int NOT NULL,
+  "user_id" int NOT NULL,
+  "hidden_at" timestamp NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("message_id", "user_id")
+);
+
+CREATE INDEX ON "message_revision" ("message_id");
+
+ALTER TABLE "message_revision" ADD FOREIGN KEY ("message_id") REFERENCES "message" ("id");
+
+ALTER TABLE "message_hidden" ADD FOREIGN KEY ("message_id") REFERENCES "message" ("id");
+
+ALTER TABLE "message_hidden" ADD FOREIGN KEY ("user_id") REFERENCES "app_user" ("id");
@@ -0,0 +1,11 @@
+CREATE TABLE "message_reaction" (
+  "message_id" int NOT NULL,
+  "user_id" int NOT NULL,
+  "emoji" varchar(32) NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("message_id", "user_id", "emoji")
+);
+
+ALTER TABLE "message_reaction" ADD FOREIGN KEY ("message_id") REFERENCES "message" ("id");
+
+ALTER TABLE "message_reaction" ADD FOREIGN KEY ("user_id") REFERENCES "app_user" ("id");
@@ -0,0 +1,3 @@
+ALTER TABLE "message" ADD COLUMN "reply_to" int;
+
+ALTER TABLE "message" ADD FOREIGN KEY ("reply_to") REFERENCES "message" ("id");
@@ -0,0 +1,16 @@
+-- Files uploaded for direct messages, message_id stays null until the attachment is sent
+CREATE TABLE "attachment" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+  "uploader_id" int NOT NULL,
+  "message_id" int UNIQUE,
+  "storage_key" varchar UNIQUE NOT NULL,
+  "thumbnail_key" varchar UNIQUE,
+  "file_name" varchar(255) NOT NULL,
+  "mime_type" varchar(127) NOT NULL,
+  "size" bigint NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "attachment" ADD FOREIGN KEY ("uploader_id") REFERENCES "app_user" ("id");
+
+ALTER TABLE "attachment" ADD FOREIGN KEY ("message_id") REFERENCES "message" ("id");
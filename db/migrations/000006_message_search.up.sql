@@ -0,0 +1,5 @@
+-- The simple configuration skips stemming and stop words, so links, addresses and names are indexed as typed
+ALTER TABLE "message" ADD COLUMN "search" tsvector
+  GENERATED ALWAYS AS (to_tsvector('simple', COALESCE("content", ''))) STORED;
+
+CREATE INDEX "message_search_idx" ON "message" USING GIN ("search");
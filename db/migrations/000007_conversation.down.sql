@@ -0,0 +1,15 @@
+-- Group messages cannot be kept without their conversation
+DELETE FROM "message_reaction" WHERE "message_id" IN (SELECT "id" FROM "message" WHERE "conversation_id" IS NOT NULL);
+DELETE FROM "message_hidden" WHERE "message_id" IN (SELECT "id" FROM "message" WHERE "conversation_id" IS NOT NULL);
+DELETE FROM "message_revision" WHERE "message_id" IN (SELECT "id" FROM "message" WHERE "conversation_id" IS NOT NULL);
+UPDATE "message" SET "reply_to" = NULL WHERE "reply_to" IN (SELECT "id" FROM "message" WHERE "conversation_id" IS NOT NULL);
+DELETE FROM "message" WHERE "conversation_id" IS NOT NULL;
+
+ALTER TABLE "message" DROP CONSTRAINT IF EXISTS "message_recipient_check";
+ALTER TABLE "message" DROP COLUMN IF EXISTS "conversation_id";
+ALTER TABLE "message" ALTER COLUMN "receiver_id" SET NOT NULL;
+
+DROP TABLE IF EXISTS "conversation_member" CASCADE;
+DROP TABLE IF EXISTS "conversation" CASCADE;
+
+DROP TYPE IF EXISTS conversation_role CASCADE;
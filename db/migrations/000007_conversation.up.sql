@@ -0,0 +1,41 @@
+CREATE TYPE "conversation_role" AS ENUM (
+  'owner',
+  'admin',
+  'member'
+);
+
+-- Group conversations, direct messages keep using the sender and receiver of the message
+CREATE TABLE "conversation" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+  "name" varchar(64) NOT NULL,
+  "created_by" int NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+-- A member only sees the messages sent after joined_at, rejoining resets it
+CREATE TABLE "conversation_member" (
+  "conversation_id" int NOT NULL,
+  "user_id" int NOT NULL,
+  "role" conversation_role NOT NULL DEFAULT 'member',
+  "joined_at" timestamp NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("conversation_id", "user_id")
+);
+
+CREATE INDEX ON "conversation_member" ("user_id");
+
+ALTER TABLE "conversation" ADD FOREIGN KEY ("created_by") REFERENCES "app_user" ("id");
+
+ALTER TABLE "conversation_member" ADD FOREIGN KEY ("conversation_id") REFERENCES "conversation" ("id");
+
+ALTER TABLE "conversation_member" ADD FOREIGN KEY ("user_id") REFERENCES "app_user" ("id");
+
+-- A message either goes to a user or to a group conversation
+ALTER TABLE "message" ADD COLUMN "conversation_id" int;
+
+ALTER TABLE "message" ALTER COLUMN "receiver_id" DROP NOT NULL;
+
+ALTER TABLE "message" ADD CONSTRAINT "message_recipient_check" CHECK (("receiver_id" IS NULL) <> ("conversation_id" IS NULL));
+
+ALTER TABLE "message" ADD FOREIGN KEY ("conversation_id") REFERENCES "conversation" ("id");
+
+CREATE INDEX ON "message" ("conversation_id", "timestamp");
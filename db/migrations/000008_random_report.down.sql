@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "random_rating" CASCADE;
+DROP TABLE IF EXISTS "random_report" CASCADE;
+
+DROP TYPE IF EXISTS random_report_reason CASCADE;
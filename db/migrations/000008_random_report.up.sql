@@ -0,0 +1,42 @@
+CREATE TYPE "random_report_reason" AS ENUM (
+  'spam',
+  'harassment',
+  'sexual_content',
+  'hate',
+  'underage',
+  'other'
+);
+
+-- Reports on a random partner, the session is the ID handed out with random_joined
+CREATE TABLE "random_report" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+  "session_id" uuid NOT NULL,
+  "reporter_id" int NOT NULL,
+  "reported_id" int NOT NULL,
+  "reason" random_report_reason NOT NULL,
+  "transcript" text,
+  "created_at" timestamp NOT NULL DEFAULT (now()),
+  UNIQUE ("session_id", "reporter_id")
+);
+
+CREATE INDEX ON "random_report" ("reported_id");
+
+-- Thumbs up or down a user gave their random partner, one per session
+CREATE TABLE "random_rating" (
+  "session_id" uuid NOT NULL,
+  "rater_id" int NOT NULL,
+  "rated_id" int NOT NULL,
+  "positive" boolean NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("session_id", "rater_id")
+);
+
+CREATE INDEX ON "random_rating" ("rated_id");
+
+ALTER TABLE "random_report" ADD FOREIGN KEY ("reporter_id") REFERENCES "app_user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "random_report" ADD FOREIGN KEY ("reported_id") REFERENCES "app_user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "random_rating" ADD FOREIGN KEY ("rater_id") REFERENCES "app_user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "random_rating" ADD FOREIGN KEY ("rated_id") REFERENCES "app_user" ("id") ON DELETE CASCADE;
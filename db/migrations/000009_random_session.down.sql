@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "random_session" CASCADE;
+
+DROP TYPE IF EXISTS random_end_reason CASCADE;
@@ -0,0 +1,27 @@
+CREATE TYPE "random_end_reason" AS ENUM (
+  'skip',
+  'leave',
+  'disconnect',
+  'report'
+);
+
+-- Random chats with both participants, the ID is the session handed out with random_joined
+CREATE TABLE "random_session" (
+  "id" uuid PRIMARY KEY NOT NULL,
+  "user_a" int NOT NULL,
+  "user_b" int NOT NULL,
+  "interests" text[] NOT NULL DEFAULT '{}',
+  "started_at" timestamp NOT NULL DEFAULT (now()),
+  "ended_at" timestamp,
+  "end_reason" random_end_reason
+);
+
+CREATE INDEX ON "random_session" ("user_a", "started_at");
+
+CREATE INDEX ON "random_session" ("user_b", "started_at");
+
+CREATE INDEX ON "random_session" ("started_at");
+
+ALTER TABLE "random_session" ADD FOREIGN KEY ("user_a") REFERENCES "app_user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "random_session" ADD FOREIGN KEY ("user_b") REFERENCES "app_user" ("id") ON DELETE CASCADE;
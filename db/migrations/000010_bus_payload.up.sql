@@ -0,0 +1,8 @@
+-- Hub messages too large for a NOTIFY, only the ID is sent and the listeners read the message from here
+CREATE TABLE "bus_payload" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY UNIQUE PRIMARY KEY NOT NULL,
+  "payload" bytea NOT NULL,
+  "created_at" timestamp NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "bus_payload" ("created_at");
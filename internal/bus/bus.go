@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrClosed       = errors.New("bus: bus is closed")
+	ErrInvalidTopic = errors.New("bus: invalid topic")
+)
+
+// Called with the payload of every message published on a subscribed topic, one at a time in publish order
+type Handler func(payload []byte)
+
+/*
+Bus carries the hub traffic between the nodes running whirl behind a load balancer.
+
+Every message published on a topic reaches every subscriber of the topic, the publishing node included.
+Delivery is at most once, a node that is down or reconnecting while a message is published never sees it.
+Topics are lowercase names like "hub_deliver", backends may map them to their own naming.
+*/
+type Bus interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Returns the function that ends the subscription
+	Subscribe(topic string, handler Handler) (func(), error)
+	/*
+		Takes the named lock for this node if no other node holds it, reports whether this node holds it.
+
+		The lock is kept until the bus is closed or loses its connection, calling TryLock again tells
+		whether the node still holds it. Backends with expiring locks extend the lock on every call, so the
+		holder has to keep calling it.
+	*/
+	TryLock(ctx context.Context, name string) (bool, error)
+	Close() error
+}
+
+// Messages a subscription buffers before publishing waits for its handler to catch up
+const subscriptionBufferSize = 256
+
+// Hands the messages of one subscription to its handler in order, on a goroutine of its own
+type subscription struct {
+	topic   string
+	handler Handler
+	queue   chan []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newSubscription(topic string, handler Handler) *subscription {
+	s := &subscription{
+		topic:   topic,
+		handler: handler,
+		queue:   make(chan []byte, subscriptionBufferSize),
+		done:    make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *subscription) run() {
+	for {
+		select {
+		case payload := <-s.queue:
+			s.handler(payload)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Queues the message for the handler, messages pushed after the subscription ended are dropped
+func (s *subscription) push(ctx context.Context, payload []byte) error {
+	// Each subscriber gets its own copy so a handler can not change what the others see
+	p := make([]byte, len(payload))
+	copy(p, payload)
+
+	select {
+	case s.queue <- p:
+		return nil
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *subscription) stop() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,139 @@
+package bus
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Connects the buses of nodes living in the same process.
+
+Used by tests to run several hubs against each other, and by a single node deployment that has no
+other nodes to reach.
+*/
+type MemoryBroker struct {
+	mu    sync.Mutex
+	subs  map[string]map[*subscription]struct{}
+	locks map[string]*MemoryBus
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subs:  make(map[string]map[*subscription]struct{}),
+		locks: make(map[string]*MemoryBus),
+	}
+}
+
+// Returns the bus of a new node connected to the broker
+func (b *MemoryBroker) Connect() Bus {
+	return &MemoryBus{
+		broker: b,
+		subs:   make(map[*subscription]struct{}),
+	}
+}
+
+type MemoryBus struct {
+	broker *MemoryBroker
+	closed bool // Guarded by the broker lock
+	subs   map[*subscription]struct{}
+}
+
+func (m *MemoryBus) Publish(ctx context.Context, topic string, payload []byte) error {
+	if topic == "" {
+		return ErrInvalidTopic
+	}
+
+	m.broker.mu.Lock()
+	if m.closed {
+		m.broker.mu.Unlock()
+		return ErrClosed
+	}
+
+	subs := make([]*subscription, 0, len(m.broker.subs[topic]))
+	for s := range m.broker.subs[topic] {
+		subs = append(subs, s)
+	}
+	m.broker.mu.Unlock()
+
+	for _, s := range subs {
+		if err := s.push(ctx, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryBus) Subscribe(topic string, handler Handler) (func(), error) {
+	if topic == "" {
+		return nil, ErrInvalidTopic
+	}
+
+	m.broker.mu.Lock()
+	defer m.broker.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	s := newSubscription(topic, handler)
+
+	if m.broker.subs[topic] == nil {
+		m.broker.subs[topic] = make(map[*subscription]struct{})
+	}
+	m.broker.subs[topic][s] = struct{}{}
+	m.subs[s] = struct{}{}
+
+	return func() {
+		m.broker.mu.Lock()
+		m.unsubscribe(s)
+		m.broker.mu.Unlock()
+	}, nil
+}
+
+// The broker lock must be held by the caller
+func (m *MemoryBus) unsubscribe(s *subscription) {
+	delete(m.broker.subs[s.topic], s)
+	delete(m.subs, s)
+	s.stop()
+}
+
+func (m *MemoryBus) TryLock(ctx context.Context, name string) (bool, error) {
+	m.broker.mu.Lock()
+	defer m.broker.mu.Unlock()
+
+	if m.closed {
+		return false, ErrClosed
+	}
+
+	holder, held := m.broker.locks[name]
+	if !held {
+		m.broker.locks[name] = m
+		return true, nil
+	}
+
+	return holder == m, nil
+}
+
+// Ends every subscription of the node and releases its locks, like a node going down
+func (m *MemoryBus) Close() error {
+	m.broker.mu.Lock()
+	defer m.broker.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	for s := range m.subs {
+		m.unsubscribe(s)
+	}
+
+	for name, holder := range m.broker.locks {
+		if holder == m {
+			delete(m.broker.locks, name)
+		}
+	}
+
+	return nil
+}
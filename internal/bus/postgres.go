@@ -0,0 +1,416 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// Longest payload sent inline, Postgres refuses NOTIFY payloads of 8000 bytes or more and one byte is the prefix
+	postgresInlinePayload = 7998
+
+	// How long stored payloads are kept for the listeners to fetch, and how often old ones are removed
+	postgresPayloadTTL = time.Minute
+
+	// Longest a listener waits to fetch a stored payload, the listening connection waits with it
+	postgresFetchTimeout = 5 * time.Second
+
+	// How long the listening connection waits for a notification before it runs the queued commands
+	postgresPollInterval = 250 * time.Millisecond
+
+	// How long the bus waits before connecting again after losing the listening connection
+	postgresRetryInterval = 2 * time.Second
+)
+
+// Prefixes of the NOTIFY payloads, a message is either sent inline or stored with only its ID sent
+const (
+	postgresInline = 'm'
+	postgresStored = 'r'
+)
+
+// Notifications carry a prefix, one without a known prefix was not sent by a PostgresBus
+var errInvalidNotification = errors.New("bus: invalid notification")
+
+// Topics become channel names, unquoted identifiers keep them readable in pg_listening_channels()
+var postgresTopic = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+/*
+Bus on top of Postgres LISTEN/NOTIFY, every node listens on its own connection taken out of the pool.
+
+Publishing goes through the pool with pg_notify so it never waits on the listening connection. Payloads too large
+for a NOTIFY are stored in the bus_payload table and only their ID is sent, the listeners fetch them from there.
+Locks are session level advisory locks of the listening connection, Postgres releases them when the node
+goes down or its connection drops.
+*/
+type PostgresBus struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	closed bool
+	subs   map[string]map[*subscription]struct{}
+	locks  map[string]bool // Locks held by the current listening connection
+
+	cmds      chan postgresCmd // Run on the listening connection between waits
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lastPrune time.Time // Last removal of the expired stored payloads, guarded by mu
+}
+
+type postgresCmd struct {
+	run    func(ctx context.Context, conn *pgx.Conn) error
+	result chan error
+}
+
+func NewPostgresBus(pool *pgxpool.Pool, logger *slog.Logger) Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &PostgresBus{
+		pool:   pool,
+		logger: logger,
+		subs:   make(map[string]map[*subscription]struct{}),
+		locks:  make(map[string]bool),
+		cmds:   make(chan postgresCmd),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go b.run(ctx)
+
+	return b
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, topic string, payload []byte) error {
+	if !postgresTopic.MatchString(topic) {
+		return ErrInvalidTopic
+	}
+
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	notification := string(postgresInline) + string(payload)
+	if len(payload) > postgresInlinePayload {
+		id, err := b.store(ctx, payload)
+		if err != nil {
+			return err
+		}
+
+		notification = string(postgresStored) + strconv.FormatInt(id, 10)
+	}
+
+	if _, err := b.pool.Exec(ctx, "SELECT pg_notify($1, $2)", topic, notification); err != nil {
+		return fmt.Errorf("bus: failed to publish : %w", err)
+	}
+
+	return nil
+}
+
+// Stores a payload too large for a NOTIFY, the payloads that expired are removed every now and then
+func (b *PostgresBus) store(ctx context.Context, payload []byte) (int64, error) {
+	var id int64
+	if err := b.pool.QueryRow(ctx, "INSERT INTO bus_payload (payload) VALUES ($1) RETURNING id", payload).Scan(&id); err != nil {
+		return 0, fmt.Errorf("bus: failed to store payload : %w", err)
+	}
+
+	now := time.Now()
+
+	b.mu.Lock()
+	prune := now.Sub(b.lastPrune) >= postgresPayloadTTL
+	if prune {
+		b.lastPrune = now
+	}
+	b.mu.Unlock()
+
+	if prune {
+		qry := "DELETE FROM bus_payload WHERE created_at < now() - make_interval(secs => $1)"
+		if _, err := b.pool.Exec(ctx, qry, postgresPayloadTTL.Seconds()); err != nil {
+			b.logger.Error("bus: failed to remove expired payloads", slog.String("error", err.Error()))
+		}
+	}
+
+	return id, nil
+}
+
+/*
+Subscribes the handler to the topic.
+
+The listening connection picks up new topics between waits, messages published before that are missed.
+*/
+func (b *PostgresBus) Subscribe(topic string, handler Handler) (func(), error) {
+	if !postgresTopic.MatchString(topic) {
+		return nil, ErrInvalidTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	s := newSubscription(topic, handler)
+
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[*subscription]struct{})
+	}
+	b.subs[topic][s] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subs[topic], s)
+		if len(b.subs[topic]) == 0 {
+			delete(b.subs, topic)
+		}
+		b.mu.Unlock()
+
+		s.stop()
+	}, nil
+}
+
+func (b *PostgresBus) TryLock(ctx context.Context, name string) (bool, error) {
+	b.mu.Lock()
+	held := b.locks[name]
+	b.mu.Unlock()
+
+	if held {
+		return true, nil
+	}
+
+	var locked bool
+	err := b.exec(ctx, func(ctx context.Context, conn *pgx.Conn) error {
+		// The two key form keeps the locks of the bus apart from other advisory locks on the database
+		query := "SELECT pg_try_advisory_lock(hashtext('whirl_bus'), hashtext($1))"
+		if err := conn.QueryRow(ctx, query, name).Scan(&locked); err != nil {
+			return err
+		}
+
+		if locked {
+			b.mu.Lock()
+			b.locks[name] = true
+			b.mu.Unlock()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("bus: failed to take lock : %w", err)
+	}
+
+	return locked, nil
+}
+
+// Stops listening and closes the listening connection, which releases the locks of the node
+func (b *PostgresBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+
+	for _, subs := range b.subs {
+		for s := range subs {
+			s.stop()
+		}
+	}
+	b.subs = make(map[string]map[*subscription]struct{})
+	b.mu.Unlock()
+
+	b.cancel()
+	<-b.done
+
+	return nil
+}
+
+// Runs fn on the listening connection, waits until the connection is up if it is reconnecting
+func (b *PostgresBus) exec(ctx context.Context, fn func(ctx context.Context, conn *pgx.Conn) error) error {
+	cmd := postgresCmd{
+		run:    fn,
+		result: make(chan error, 1),
+	}
+
+	select {
+	case b.cmds <- cmd:
+	case <-b.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-cmd.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Keeps a listening connection up until the bus is closed
+func (b *PostgresBus) run(ctx context.Context) {
+	defer close(b.done)
+
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.logger.Error("bus: lost the listening connection", slog.String("error", err.Error()))
+
+		select {
+		case <-time.After(postgresRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *PostgresBus) listen(ctx context.Context) error {
+	pooled, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The connection holds LISTENs and locks, so it is taken out of the pool and never handed back
+	conn := pooled.Hijack()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		conn.Close(closeCtx)
+
+		b.mu.Lock()
+		b.locks = make(map[string]bool)
+		b.mu.Unlock()
+	}()
+
+	listening := make(map[string]bool)
+
+	for {
+		if err := b.syncTopics(ctx, conn, listening); err != nil {
+			return err
+		}
+
+		select {
+		case cmd := <-b.cmds:
+			cmd.result <- cmd.run(ctx, conn)
+			continue
+		default:
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, postgresPollInterval)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Timing out leaves the connection usable, anything else means it is gone
+			if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+				continue
+			}
+
+			return err
+		}
+
+		b.dispatch(ctx, conn, n)
+	}
+}
+
+// Listens on the topics that gained a subscriber and stops listening on the ones that lost all of them
+func (b *PostgresBus) syncTopics(ctx context.Context, conn *pgx.Conn, listening map[string]bool) error {
+	b.mu.Lock()
+	var listen, unlisten []string
+	for topic := range b.subs {
+		if !listening[topic] {
+			listen = append(listen, topic)
+		}
+	}
+	for topic := range listening {
+		if _, ok := b.subs[topic]; !ok {
+			unlisten = append(unlisten, topic)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, topic := range listen {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{topic}.Sanitize()); err != nil {
+			return err
+		}
+		listening[topic] = true
+	}
+
+	for _, topic := range unlisten {
+		if _, err := conn.Exec(ctx, "UNLISTEN "+pgx.Identifier{topic}.Sanitize()); err != nil {
+			return err
+		}
+		delete(listening, topic)
+	}
+
+	return nil
+}
+
+func (b *PostgresBus) dispatch(ctx context.Context, conn *pgx.Conn, n *pgconn.Notification) {
+	payload, err := b.payload(ctx, conn, n.Payload)
+	if err != nil {
+		b.logger.Error("bus: dropped a message", slog.String("topic", n.Channel), slog.String("error", err.Error()))
+		return
+	}
+
+	b.mu.Lock()
+	subs := make([]*subscription, 0, len(b.subs[n.Channel]))
+	for s := range b.subs[n.Channel] {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.push(ctx, payload)
+	}
+}
+
+// Returns the message of the notification, a stored one is fetched on the listening connection
+func (b *PostgresBus) payload(ctx context.Context, conn *pgx.Conn, notification string) ([]byte, error) {
+	if notification == "" {
+		return nil, errInvalidNotification
+	}
+
+	switch notification[0] {
+	case postgresInline:
+		return []byte(notification[1:]), nil
+	case postgresStored:
+		id, err := strconv.ParseInt(notification[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bus: invalid stored payload id : %w", err)
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, postgresFetchTimeout)
+		defer cancel()
+
+		var payload []byte
+		if err := conn.QueryRow(fetchCtx, "SELECT payload FROM bus_payload WHERE id = $1", id).Scan(&payload); err != nil {
+			return nil, fmt.Errorf("bus: failed to fetch stored payload : %w", err)
+		}
+
+		return payload, nil
+	default:
+		return nil, errInvalidNotification
+	}
+}
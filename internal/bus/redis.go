@@ -0,0 +1,358 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Ways the Redis bus carries the messages
+const (
+	RedisPubSub  = "pubsub"  // PUBLISH/SUBSCRIBE, messages published while a node reconnects are lost
+	RedisStreams = "streams" // XADD/XREAD, a node that reconnects reads what it missed from the stream
+)
+
+const (
+	// Prefix of every key and channel of the bus
+	redisPrefix = "whirl:bus:"
+
+	// How long a lock lives without the holder calling TryLock again
+	redisLockTTL = 10 * time.Second
+
+	// How long a stream read blocks before it checks whether the subscription ended
+	redisBlock = time.Second
+
+	// How long a stream reader waits before reading again after an error
+	redisRetryInterval = 2 * time.Second
+)
+
+// Extends the lock if this node holds it, takes it otherwise if it is free
+var redisTryLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// Deletes the lock only if this node holds it, the lock may have expired and been taken by another node
+var redisUnlock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+/*
+Bus on top of Redis, either with pub/sub or with streams.
+
+Streams are capped at the stream length, older messages are trimmed. Locks are keys holding a token of the node
+that expire unless the holder keeps calling TryLock, so a node that goes down gives up its locks after the lock TTL.
+*/
+type RedisBus struct {
+	rdb       *redis.Client
+	logger    *slog.Logger
+	mode      string
+	streamLen int64
+	token     string // Tells the locks of this node apart from the ones of the other nodes
+
+	mu      sync.Mutex
+	closed  bool
+	subs    map[string]map[*subscription]struct{}
+	readers map[string]context.CancelFunc // Stream readers by topic
+	locks   map[string]bool
+	pubsub  *redis.PubSub
+}
+
+/*
+Returns a bus using the Redis client, the client is left open on Close since it is usually shared.
+
+In stream mode every topic keeps about streamLen messages around for nodes catching up.
+*/
+func NewRedisBus(rdb *redis.Client, mode string, streamLen int64, logger *slog.Logger) Bus {
+	b := &RedisBus{
+		rdb:       rdb,
+		logger:    logger,
+		mode:      mode,
+		streamLen: streamLen,
+		token:     uuid.NewString(),
+		subs:      make(map[string]map[*subscription]struct{}),
+		readers:   make(map[string]context.CancelFunc),
+		locks:     make(map[string]bool),
+	}
+
+	if mode != RedisStreams {
+		// Subscribed to nothing yet, the client resubscribes on its own after reconnecting
+		b.pubsub = rdb.Subscribe(context.Background())
+		go b.receive(b.pubsub.Channel())
+	}
+
+	return b
+}
+
+func (b *RedisBus) Publish(ctx context.Context, topic string, payload []byte) error {
+	if topic == "" {
+		return ErrInvalidTopic
+	}
+
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	var err error
+	if b.mode == RedisStreams {
+		err = b.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: redisPrefix + topic,
+			MaxLen: b.streamLen,
+			Approx: true,
+			Values: map[string]any{"payload": payload},
+		}).Err()
+	} else {
+		err = b.rdb.Publish(ctx, redisPrefix+topic, payload).Err()
+	}
+
+	if err != nil {
+		return fmt.Errorf("bus: failed to publish : %w", err)
+	}
+
+	return nil
+}
+
+func (b *RedisBus) Subscribe(topic string, handler Handler) (func(), error) {
+	if topic == "" {
+		return nil, ErrInvalidTopic
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	first := len(b.subs[topic]) == 0
+	if first {
+		if err := b.listen(topic); err != nil {
+			return nil, err
+		}
+
+		b.subs[topic] = make(map[*subscription]struct{})
+	}
+
+	s := newSubscription(topic, handler)
+	b.subs[topic][s] = struct{}{}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[topic][s]; !ok {
+			return
+		}
+
+		delete(b.subs[topic], s)
+		s.stop()
+
+		if len(b.subs[topic]) == 0 {
+			delete(b.subs, topic)
+			b.unlisten(topic)
+		}
+	}, nil
+}
+
+// Starts receiving the topic, the bus lock must be held by the caller
+func (b *RedisBus) listen(topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if b.mode != RedisStreams {
+		if err := b.pubsub.Subscribe(ctx, redisPrefix+topic); err != nil {
+			return fmt.Errorf("bus: failed to subscribe : %w", err)
+		}
+
+		return nil
+	}
+
+	// Reading from the newest message on, "$" is not used since messages added between two reads would be skipped
+	lastID := "0-0"
+	latest, err := b.rdb.XRevRangeN(ctx, redisPrefix+topic, "+", "-", 1).Result()
+	if err != nil {
+		return fmt.Errorf("bus: failed to subscribe : %w", err)
+	}
+
+	if len(latest) > 0 {
+		lastID = latest[0].ID
+	}
+
+	readCtx, stop := context.WithCancel(context.Background())
+	b.readers[topic] = stop
+	go b.read(readCtx, topic, lastID)
+
+	return nil
+}
+
+// Stops receiving the topic, the bus lock must be held by the caller
+func (b *RedisBus) unlisten(topic string) {
+	if b.mode != RedisStreams {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		if err := b.pubsub.Unsubscribe(ctx, redisPrefix+topic); err != nil {
+			b.logger.Error("bus: failed to unsubscribe", slog.String("topic", topic), slog.String("error", err.Error()))
+		}
+
+		return
+	}
+
+	if stop, ok := b.readers[topic]; ok {
+		stop()
+		delete(b.readers, topic)
+	}
+}
+
+// Hands the pub/sub messages to the subscriptions until the pub/sub is closed
+func (b *RedisBus) receive(messages <-chan *redis.Message) {
+	for msg := range messages {
+		b.dispatch(strings.TrimPrefix(msg.Channel, redisPrefix), []byte(msg.Payload))
+	}
+}
+
+// Reads the stream of the topic after lastID until the reader is stopped
+func (b *RedisBus) read(ctx context.Context, topic, lastID string) {
+	for {
+		streams, err := b.rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{redisPrefix + topic, lastID},
+			Count:   100,
+			Block:   redisBlock,
+		}).Result()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+
+			b.logger.Error("bus: failed to read stream", slog.String("topic", topic), slog.String("error", err.Error()))
+
+			select {
+			case <-time.After(redisRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastID = msg.ID
+
+				payload, ok := msg.Values["payload"].(string)
+				if !ok {
+					continue
+				}
+
+				b.dispatch(topic, []byte(payload))
+			}
+		}
+	}
+}
+
+func (b *RedisBus) dispatch(topic string, payload []byte) {
+	b.mu.Lock()
+	subs := make([]*subscription, 0, len(b.subs[topic]))
+	for s := range b.subs[topic] {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.push(context.Background(), payload)
+	}
+}
+
+func (b *RedisBus) TryLock(ctx context.Context, name string) (bool, error) {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+
+	if closed {
+		return false, ErrClosed
+	}
+
+	locked, err := redisTryLock.Run(ctx, b.rdb, []string{redisPrefix + "lock:" + name}, b.token, redisLockTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("bus: failed to take lock : %w", err)
+	}
+
+	b.mu.Lock()
+	b.locks[name] = locked == 1
+	b.mu.Unlock()
+
+	return locked == 1, nil
+}
+
+// Ends the subscriptions and gives up the locks of the node right away instead of letting them expire
+func (b *RedisBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+
+	for topic, subs := range b.subs {
+		for s := range subs {
+			s.stop()
+		}
+
+		if stop, ok := b.readers[topic]; ok {
+			stop()
+		}
+	}
+	b.subs = make(map[string]map[*subscription]struct{})
+	b.readers = make(map[string]context.CancelFunc)
+
+	var held []string
+	for name, locked := range b.locks {
+		if locked {
+			held = append(held, name)
+		}
+	}
+	b.mu.Unlock()
+
+	var errs []error
+	if b.pubsub != nil {
+		errs = append(errs, b.pubsub.Close())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, name := range held {
+		errs = append(errs, redisUnlock.Run(ctx, b.rdb, []string{redisPrefix + "lock:" + name}, b.token).Err())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("bus: failed to close : %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Backends of the bus connecting the hubs of the nodes
+const (
+	BusMemory   = "memory"   // A single node, nothing leaves the process
+	BusPostgres = "postgres" // LISTEN/NOTIFY on the application database
+	BusRedis    = "redis"    // Redis pub/sub or streams, with a presence registry
+)
+
+// Ways the Redis bus carries the messages
+const (
+	RedisPubSub  = "pubsub"
+	RedisStreams = "streams"
+)
+
+// Settings of running several whirl nodes behind a load balancer
+type Cluster struct {
+	Bus string
+
+	RedisURL  string // redis:// URL of the server, only used by the redis bus
+	RedisMode string
+	// Messages kept per stream for nodes catching up after a reconnect
+	RedisStreamLen int
+	// How long a user stays online in the presence registry without the node refreshing it
+	PresenceTTL time.Duration
+}
+
+/*
+Loads the cluster settings from the environment.
+
+The memory bus is the default, it only fits a single node. Invalid values stop the program.
+*/
+func LoadCluster() Cluster {
+	return Cluster{
+		Bus: envBus("HUB_BUS"),
+
+		RedisURL:       envString("HUB_REDIS_URL", "redis://localhost:6379/0"),
+		RedisMode:      envRedisMode("HUB_REDIS_MODE"),
+		RedisStreamLen: envInt("HUB_REDIS_STREAM_LEN", 10000),
+		PresenceTTL:    envDuration("HUB_PRESENCE_TTL", 30*time.Second),
+	}
+}
+
+func envBus(key string) string {
+	switch v := os.Getenv(key); v {
+	case "":
+		return BusMemory
+	case BusMemory, BusPostgres, BusRedis:
+		return v
+	default:
+		log.Fatalf("invalid %s bus: %q", key, v)
+		return ""
+	}
+}
+
+func envRedisMode(key string) string {
+	switch v := os.Getenv(key); v {
+	case "":
+		return RedisStreams
+	case RedisPubSub, RedisStreams:
+		return v
+	default:
+		log.Fatalf("invalid %s mode: %q", key, v)
+		return ""
+	}
+}
+
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
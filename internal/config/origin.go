@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// Origins the browsers may call the API and open websockets from
+type Origins struct {
+	// Exact origins like https://whirl.app, or wildcard subdomains like https://*.whirl.app
+	Allowed []string
+	// Also allows http and https localhost origins on any port, meant for local frontends
+	DevMode bool
+}
+
+/*
+Loads the allowed origins from the comma separated ALLOWED_ORIGINS.
+
+FRONTEND_ADDRESS is still read when ALLOWED_ORIGINS is not set. Without either every origin is allowed.
+*/
+func LoadOrigins() Origins {
+	raw := os.Getenv("ALLOWED_ORIGINS")
+	if raw == "" {
+		raw = os.Getenv("FRONTEND_ADDRESS")
+	}
+
+	var allowed []string
+	for _, o := range strings.Split(raw, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed = append(allowed, o)
+		}
+	}
+
+	return Origins{
+		Allowed: allowed,
+		DevMode: envBool("ORIGINS_DEV_MODE", false),
+	}
+}
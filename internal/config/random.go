@@ -0,0 +1,141 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Matchmaking strategies of the random chat
+const (
+	MatcherFIFO   = "fifo"   // The longest waiting user picks a partner first
+	MatcherScored = "scored" // The best scoring pairs are matched first
+)
+
+// Tunables of the random chat matchmaking
+type RandomChat struct {
+	// How long a user with interests waits for an overlapping partner before being matched with anyone
+	InterestWait time.Duration
+	Matcher      string
+
+	// Users paired within this window are not paired again, zero disables it
+	RecentWindow time.Duration
+	// Queue size at or below which recent partners may be paired again
+	ThinQueue int
+	// Loads the pairings of the window from the saved sessions on start so the window survives restarts
+	PersistRecent bool
+
+	// Minimum time between two skips of a user
+	SkipInterval time.Duration
+	// Skips allowed within the skip window before the user is put in a cooldown, zero disables it
+	SkipLimit    int
+	SkipWindow   time.Duration
+	SkipCooldown time.Duration
+
+	// How long an ended session can still be reported or rated
+	SessionTTL time.Duration
+	// How much the scored matcher favors pairing users with a similar reputation
+	ReputationWeight float64
+
+	// How often queued users are sent their queue status, zero disables it
+	QueueStatusInterval time.Duration
+	// How long a user waits for a partner before being removed from the queue, zero disables it
+	QueueTimeout time.Duration
+}
+
+/*
+Loads the random chat settings from the environment, unset values fall back to the defaults.
+
+Durations use the time.ParseDuration format, e.g. "10s" or "1m30s", booleans the strconv.ParseBool one.
+Invalid values stop the program.
+*/
+func LoadRandomChat() RandomChat {
+	return RandomChat{
+		InterestWait: envDuration("RANDOM_INTEREST_WAIT", 10*time.Second),
+		Matcher:      envMatcher("RANDOM_MATCHER"),
+
+		RecentWindow:  envDuration("RANDOM_RECENT_WINDOW", 10*time.Minute),
+		ThinQueue:     envInt("RANDOM_THIN_QUEUE", 4),
+		PersistRecent: envBool("RANDOM_PERSIST_RECENT", false),
+
+		SkipInterval: envDuration("RANDOM_SKIP_INTERVAL", 2*time.Second),
+		SkipLimit:    envInt("RANDOM_SKIP_LIMIT", 10),
+		SkipWindow:   envDuration("RANDOM_SKIP_WINDOW", time.Minute),
+		SkipCooldown: envDuration("RANDOM_SKIP_COOLDOWN", 2*time.Minute),
+
+		SessionTTL:       envDuration("RANDOM_SESSION_TTL", 24*time.Hour),
+		ReputationWeight: envFloat("RANDOM_REPUTATION_WEIGHT", 1),
+
+		QueueStatusInterval: envDuration("RANDOM_QUEUE_STATUS_INTERVAL", 5*time.Second),
+		QueueTimeout:        envDuration("RANDOM_QUEUE_TIMEOUT", 5*time.Minute),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("invalid %s number: %q", key, v)
+	}
+
+	return n
+}
+
+func envFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("invalid %s number: %q", key, v)
+	}
+
+	return f
+}
+
+func envBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("invalid %s boolean: %q", key, v)
+	}
+
+	return b
+}
+
+func envMatcher(key string) string {
+	switch v := os.Getenv(key); v {
+	case "":
+		return MatcherFIFO
+	case MatcherFIFO, MatcherScored:
+		return v
+	default:
+		log.Fatalf("invalid %s matcher: %q", key, v)
+		return ""
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid %s duration: %q", key, v)
+	}
+
+	return d
+}
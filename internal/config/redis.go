@@ -0,0 +1,25 @@
+package config
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Connects to the Redis server of the URL and returns the client on success, otherwise will stop the program.
+*/
+func InitRedis(url string) *redis.Client {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		log.Fatalf("failed to parse redis url: %v", err)
+	}
+
+	rdb := redis.NewClient(opts)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("failed to ping redis: %v", err)
+	}
+
+	return rdb
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ICE servers handed out to the clients for voice and video chat.
+
+Media flows peer to peer, the server only relays the signaling. TURN credentials are either static or,
+when a secret is set, generated per user with the TURN REST API scheme (coturn's use-auth-secret).
+*/
+type RTC struct {
+	STUNURLs []string
+	TURNURLs []string
+
+	// Static TURN credentials, used when no secret is set
+	TURNUsername   string
+	TURNCredential string
+
+	// Secret shared with the TURN server to generate short lived credentials
+	TURNSecret string
+	// How long a generated credential is valid
+	TURNCredentialTTL time.Duration
+}
+
+// Loads the ICE servers from the environment, URLs are comma separated and invalid ones stop the program
+func LoadRTC() RTC {
+	return RTC{
+		STUNURLs: envURLs("RTC_STUN_URLS", "stun:", "stuns:"),
+		TURNURLs: envURLs("RTC_TURN_URLS", "turn:", "turns:"),
+
+		TURNUsername:   os.Getenv("RTC_TURN_USERNAME"),
+		TURNCredential: os.Getenv("RTC_TURN_CREDENTIAL"),
+
+		TURNSecret:        os.Getenv("RTC_TURN_SECRET"),
+		TURNCredentialTTL: envDuration("RTC_TURN_CREDENTIAL_TTL", 12*time.Hour),
+	}
+}
+
+func envURLs(key string, schemes ...string) []string {
+	var urls []string
+
+	for _, u := range strings.Split(os.Getenv(key), ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+
+		valid := false
+		for _, scheme := range schemes {
+			if strings.HasPrefix(u, scheme) && len(u) > len(scheme) {
+				valid = true
+			}
+		}
+
+		if !valid {
+			log.Fatalf("invalid %s url: %q", key, u)
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls
+}
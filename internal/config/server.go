@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/jlry-dev/whirl/internal/util"
@@ -13,6 +14,9 @@ import (
 type Config struct {
 	Logger   *slog.Logger
 	Validate *validator.Validate
+
+	// How long a SIGTERM waits for the connections to drain before the server stops anyway
+	ShutdownTimeout time.Duration
 }
 
 func Load() Config {
@@ -33,5 +37,7 @@ func Load() Config {
 	return Config{
 		Logger:   l,
 		Validate: v,
+
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
 	}
 }
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// Keep alive and limits of the websocket connections
+type Socket struct {
+	// How often the server pings the client
+	PingInterval time.Duration
+	// How long the server waits for a pong or any other message before it closes the connection
+	PongTimeout time.Duration
+	// How long a single write to the client may take before the connection is closed
+	WriteTimeout time.Duration
+	// Largest message in bytes a client may send, the connection is closed on larger ones
+	MaxMessageSize int64
+
+	// Messages queued for a client before new ones are dropped, control messages have their own smaller queue
+	SendBuffer    int
+	ControlBuffer int
+	// How long the queues of a client may stay full before the client is disconnected as too slow
+	OverflowTimeout time.Duration
+}
+
+/*
+Loads the websocket settings from the environment.
+
+The ping interval has to be shorter than the pong timeout, otherwise every idle connection would be closed.
+Invalid values stop the program.
+*/
+func LoadSocket() Socket {
+	s := Socket{
+		PingInterval:   envDuration("WS_PING_INTERVAL", 25*time.Second),
+		PongTimeout:    envDuration("WS_PONG_TIMEOUT", 60*time.Second),
+		WriteTimeout:   envDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		MaxMessageSize: int64(envInt("WS_MAX_MESSAGE_SIZE", 64*1024)),
+
+		SendBuffer:      envInt("WS_SEND_BUFFER", 64),
+		ControlBuffer:   envInt("WS_CONTROL_BUFFER", 16),
+		OverflowTimeout: envDuration("WS_OVERFLOW_TIMEOUT", 10*time.Second),
+	}
+
+	if s.PingInterval <= 0 || s.PingInterval >= s.PongTimeout {
+		log.Fatalf("invalid WS_PING_INTERVAL: %s has to be positive and shorter than WS_PONG_TIMEOUT %s", s.PingInterval, s.PongTimeout)
+	}
+
+	if s.WriteTimeout <= 0 {
+		log.Fatalf("invalid WS_WRITE_TIMEOUT: %s has to be positive", s.WriteTimeout)
+	}
+
+	if s.MaxMessageSize <= 0 {
+		log.Fatalf("invalid WS_MAX_MESSAGE_SIZE: %d has to be positive", s.MaxMessageSize)
+	}
+
+	if s.SendBuffer <= 0 || s.ControlBuffer <= 0 {
+		log.Fatalf("invalid WS_SEND_BUFFER or WS_CONTROL_BUFFER: %d and %d have to be positive", s.SendBuffer, s.ControlBuffer)
+	}
+
+	if s.OverflowTimeout <= 0 {
+		log.Fatalf("invalid WS_OVERFLOW_TIMEOUT: %s has to be positive", s.OverflowTimeout)
+	}
+
+	return s
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+// Room for the multipart boundaries and headers on top of the file itself
+const multipartOverhead = 64 * 1024
+
+type AttachmentHandlr struct {
+	rspHandler *ResponseHandler
+	srv        service.AttachmentService
+	logger     *slog.Logger
+}
+
+type AttachmentHandler interface {
+	UploadAttachment(w http.ResponseWriter, r *http.Request)
+	DownloadAttachment(w http.ResponseWriter, r *http.Request)
+	DownloadThumbnail(w http.ResponseWriter, r *http.Request)
+}
+
+func NewAttachmentHandler(srv service.AttachmentService, rspHandler *ResponseHandler, logger *slog.Logger) AttachmentHandler {
+	return &AttachmentHandlr{
+		srv:        srv,
+		rspHandler: rspHandler,
+		logger:     logger,
+	}
+}
+
+func (h *AttachmentHandlr) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("attachment upload: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "multipart/form-data" {
+		h.logger.Error("attachment upload: invalid content type", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("attachment upload: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxAttachmentSize+multipartOverhead)
+
+	if err := r.ParseMultipartForm(service.MaxAttachmentSize + multipartOverhead); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.rspHandler.Error(w, http.StatusRequestEntityTooLarge, "attachment is too large", nil)
+			return
+		}
+
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, "missing file", nil)
+		return
+	}
+	defer file.Close()
+
+	rspData, err := h.srv.Upload(ctx, &dto.UploadAttachmentDTO{
+		File:     file,
+		FileName: header.Filename,
+		UserID:   userID,
+	})
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+
+		if errors.Is(err, service.ErrAttachmentTooLarge) {
+			h.rspHandler.Error(w, http.StatusRequestEntityTooLarge, "attachment is too large", nil)
+			return
+		}
+
+		if errors.Is(err, service.ErrUnsupportedAttachment) {
+			h.rspHandler.Error(w, http.StatusUnsupportedMediaType, "unsupported attachment type", nil)
+			return
+		}
+
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	rspData.Status = http.StatusCreated
+	h.rspHandler.JSON(w, http.StatusCreated, rspData)
+}
+
+func (h *AttachmentHandlr) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	h.download(w, r, false)
+}
+
+func (h *AttachmentHandlr) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.download(w, r, true)
+}
+
+func (h *AttachmentHandlr) download(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("attachment download: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("attachment download: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	attachmentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("attachment download: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	file, err := h.srv.Open(ctx, userID, attachmentID, thumbnail)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+
+		if errors.Is(err, service.ErrAttachmentNotExist) {
+			h.rspHandler.Error(w, http.StatusNotFound, "attachment not found", nil)
+			return
+		}
+
+		if errors.Is(err, service.ErrAttachmentAccessDenied) {
+			h.rspHandler.Error(w, http.StatusForbidden, http.StatusText(http.StatusForbidden), nil)
+			return
+		}
+
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+	defer file.Content.Close()
+
+	// Only images are shown inline, everything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(file.MimeType, "image/") {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", file.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, file.Content); err != nil {
+		h.logger.Error("attachment download: failed to stream file", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import "time"
+
+// How long the number of messages a disconnected client missed is kept for its next connection
+const droppedTTL = time.Hour
+
+/*
+Messages that go out on the control lane of a client.
+
+They tell the client what happened to its session, so they skip the queued chat traffic and are not starved by it.
+Everything else is data, which is dropped first when a client cannot keep up.
+*/
+var controlTypes = map[string]bool{
+	"error":                  true,
+	"notification":           true,
+	"messages_dropped":       true,
+	"server_shutdown":        true,
+	"random_joined":          true,
+	"room_joined":            true,
+	"queue_timeout":          true,
+	"reveal":                 true,
+	"reveal_request":         true,
+	"friend_request":         true,
+	"friend_request_success": true,
+	"friend_request_failed":  true,
+	"report_received":        true,
+	"rating_received":        true,
+	"sync_complete":          true,
+	"rtc_offer":              true,
+	"rtc_answer":             true,
+	"rtc_ice":                true,
+	"rtc_hangup":             true,
+}
+
+// Messages a client missed on its last connection
+type droppedMessages struct {
+	count int64
+	at    time.Time
+}
+
+/*
+Counts a message the client missed because its queue was full.
+
+The overflow starts with the first drop and ends once the write pump empties the queues. A client that is still
+overflowing after the overflow timeout cannot keep up and is disconnected, it may connect again later.
+*/
+func (c *Client) overflow() {
+	c.dropped.Add(1)
+	socketMetrics.Add("dropped_messages", 1)
+
+	now := time.Now().UnixNano()
+	since := c.overflowSince.Load()
+	if since == 0 {
+		c.overflowSince.CompareAndSwap(0, now)
+		return
+	}
+
+	if time.Duration(now-since) >= c.socket.OverflowTimeout {
+		// Closing waits on the close frame, the sender of the message does not
+		go c.closeSocket(reapedSlowConsumer)
+	}
+}
+
+/*
+Keeps the number of messages the client missed for the next connection of the user.
+
+When the user already connected again the new connection is told right away.
+*/
+func (h *Hub) recordDropped(c *Client, replacement *Client) {
+	count := c.dropped.Load()
+	if count == 0 {
+		return
+	}
+
+	if replacement != nil {
+		replacement.deliver(droppedNotice(count), 0)
+		return
+	}
+
+	now := time.Now()
+
+	h.droppedMU.Lock()
+	defer h.droppedMU.Unlock()
+
+	for userID, d := range h.dropped {
+		if now.Sub(d.at) >= droppedTTL {
+			delete(h.dropped, userID)
+		}
+	}
+
+	d := h.dropped[c.userID.Int()]
+	h.dropped[c.userID.Int()] = droppedMessages{count: d.count + count, at: now}
+}
+
+// Tells a client that connected again how many messages it missed on its last connection
+func (h *Hub) sendDropped(c *Client) {
+	h.droppedMU.Lock()
+	d, ok := h.dropped[c.userID.Int()]
+	delete(h.dropped, c.userID.Int())
+	h.droppedMU.Unlock()
+
+	if !ok || time.Since(d.at) >= droppedTTL {
+		return
+	}
+
+	c.deliver(droppedNotice(d.count), 0)
+}
+
+func droppedNotice(count int64) *Message {
+	return &Message{
+		Type:    "messages_dropped",
+		Code:    "SLOW_CONNECTION",
+		Dropped: count,
+		Content: "Messages were dropped because the connection was too slow, sync to catch up on direct messages",
+	}
+}
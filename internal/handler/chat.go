@@ -4,13 +4,23 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/config"
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/model"
 	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/origin"
+	"github.com/jlry-dev/whirl/internal/presence"
 	"github.com/jlry-dev/whirl/internal/service"
 )
 
@@ -32,20 +42,35 @@ type ChatHandlr struct {
 	hub        *Hub
 	rspHandler *ResponseHandler
 	logger     *slog.Logger
+	socket     config.Socket
+	upgrader   websocket.Upgrader
 }
 
-func NewChatHandler(logger *slog.Logger, rspHandler *ResponseHandler, hub *Hub) ChatHandler {
-	return &ChatHandlr{
+// The origins are the same policy CORS uses, a page that may not call the API may not open a websocket either
+func NewChatHandler(logger *slog.Logger, rspHandler *ResponseHandler, hub *Hub, socket config.Socket, origins origin.Policy) ChatHandler {
+	h := &ChatHandlr{
 		logger:     logger,
 		rspHandler: rspHandler,
 		hub:        hub,
+		socket:     socket,
+	}
+
+	h.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			if origins.Allow(r.Header.Get("Origin")) {
+				return true
+			}
+
+			h.logger.Warn("socket connect: origin not allowed", slog.String("origin", r.Header.Get("Origin")), slog.String("remote_addr", r.RemoteAddr))
+			return false
+		},
+		// Failed handshakes are answered by the upgrader, in the same format as the other errors
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			rspHandler.Error(w, status, reason.Error(), nil)
+		},
 	}
-}
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // TODO: create a proper origin check
-	},
+	return h
 }
 
 func (h *ChatHandlr) SocketConnect(w http.ResponseWriter, r *http.Request) {
@@ -55,26 +80,31 @@ func (h *ChatHandlr) SocketConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		if errors.Is(err, websocket.ErrBadHandshake) {
-			h.rspHandler.Error(w, http.StatusBadRequest, "bad request trying to upgrade connection", nil)
-			return
-		}
+	if h.hub.Draining() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reconnectSpread/time.Second)))
+		h.rspHandler.Error(w, http.StatusServiceUnavailable, "server is shutting down", nil)
+		return
+	}
 
-		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+	// The upgrader already answered when it fails
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Info("socket connect: upgrade failed", slog.Int("userID", userID), slog.String("error", err.Error()))
 		return
 	}
 
-	sendCh := make(chan *Message, 20)
 	cl := &Client{
 		logger:      h.logger,
 		userID:      uid(userID),
 		hub:         h.hub,
 		ws:          ws,
-		send:        sendCh,
+		socket:      h.socket,
+		send:        make(chan *Message, h.socket.SendBuffer),
+		control:     make(chan *Message, h.socket.ControlBuffer),
+		done:        make(chan struct{}),
 		isConnected: true,
 	}
+	socketMetrics.Add("open", 1)
 
 	go cl.ReadMessage()
 	go cl.WriteMessage()
@@ -84,28 +114,82 @@ func (h *ChatHandlr) SocketConnect(w http.ResponseWriter, r *http.Request) {
 }
 
 type Client struct {
-	logger      *slog.Logger
-	mu          sync.RWMutex
-	inQueue     bool // Indicator for when the client is queueing for random chat
-	userID      uid
-	hub         *Hub
-	ws          *websocket.Conn
-	send        chan *Message
+	logger    *slog.Logger
+	mu        sync.RWMutex
+	inQueue   bool // Indicator for when the client is queueing for random chat
+	userID    uid
+	hub       *Hub
+	ws        *websocket.Conn
+	socket    config.Socket
+	closeOnce sync.Once // Closes the websocket once, whichever pump gives up first
+	send      chan *Message
+	control   chan *Message // Priority lane written before send, see controlTypes
+	done      chan struct{} // Closed on disconnect, the queues are never closed since senders do not hold the lock
+
+	queued        atomic.Int64 // Messages in the queues or being written
+	dropped       atomic.Int64 // Messages dropped because the queues were full
+	overflowSince atomic.Int64 // Unix nanoseconds of the first drop since the queues were last empty, zero if none
+
 	randomPair  *Client // This is for the omegle like feature where we pair the user with another user
-	isConnected bool
+	room        *randomRoom
+	mode        string   // Random chat mode of the last join_random, either pair or group
+	interests   []string // Interest tags sent with join_random, used to pick the random pair
+	preferences dto.RandomPreferencesDTO
+
+	session string             // ID of the random chat session with the random pair
+	entry   *matchmaking.Entry // The pair queue entry while queued, announced again when another node takes over the queue
+
+	// Consent to reveal the identity to the random pair, reset whenever the pair changes
+	revealRequested bool
+	befriend        bool
+	isConnected     bool
+
+	// Stands in for a user connected to another node, messages delivered to it are forwarded over the bus
+	remote bool
+	node   string // Node of a remote client, empty when it is unknown and every node gets the message
 }
 
 type Hub struct {
-	frSrv  service.FriendshipService
-	msgSrv service.MessageService
-	logger *slog.Logger
+	frSrv     service.FriendshipService
+	msgSrv    service.MessageService
+	convSrv   service.ConversationService
+	randomSrv service.RandomService
+	signalSrv service.SignalService
+	logger    *slog.Logger
+
+	randomCfg config.RandomChat
 
 	clientMU       sync.RWMutex
 	clients        map[string]*Client
 	friendMU       sync.RWMutex
 	friendRequests map[string]*Client
 	queueMU        sync.RWMutex
-	queue          []*Client
+	matcher        matchmaking.Matcher       // Random chat queue, guarded by queueMU
+	groups         *matchmaking.GroupMatcher // Group random chat queue, guarded by queueMU
+	skips          *matchmaking.SkipLimiter
+	sessions       *matchmaking.Sessions
+	history        matchmaking.History        // Recent partners the pair queue avoids, nil when disabled
+	waits          *matchmaking.WaitEstimator // Match rates of the pair queue
+	groupWaits     *matchmaking.WaitEstimator // Match rates of the group queue
+	typingMU       sync.Mutex
+	typing         map[string]*typingState // Active typing indicators keyed by sender:receiver
+	droppedMU      sync.Mutex
+	dropped        map[int]droppedMessages // Messages users missed on their last connection
+
+	// The hubs of all nodes share the bus, one of them runs the pair queue for all of them
+	node     string
+	bus      bus.Bus
+	presence presence.Registry // Nodes of the online users, nil without a registry
+	leading  atomic.Bool
+	peerMU   sync.Mutex
+	peers    map[string]time.Time // Last heartbeat of the other nodes
+	departed map[int]departure    // Leaves of users queued on other nodes, guarded by queueMU
+
+	// Shutdown stops accepting connections and messages, then stops Run once the work in flight is done
+	draining atomic.Bool
+	quit     chan struct{}
+	stopped  chan struct{}
+	work     sync.WaitGroup // Goroutines started by Run
 
 	connect    chan *Client
 	disconnect chan *Client
@@ -113,51 +197,195 @@ type Hub struct {
 	messages    chan *Message
 	randomJoin  chan *Client
 	randomLeave chan *Client
+	randomNext  chan *Client
 }
 
-func NewHub(frSrv service.FriendshipService, msgSrv service.MessageService, logger *slog.Logger) *Hub {
-	return &Hub{
-		frSrv:  frSrv,
-		msgSrv: msgSrv,
+func NewHub(frSrv service.FriendshipService, msgSrv service.MessageService, convSrv service.ConversationService, randomSrv service.RandomService, signalSrv service.SignalService, randomCfg config.RandomChat, b bus.Bus, registry presence.Registry, logger *slog.Logger) *Hub {
+	h := &Hub{
+		// Without the dashes the ID fits in a topic name of every bus
+		node:     strings.ReplaceAll(uuid.NewString(), "-", ""),
+		bus:      b,
+		presence: registry,
+		peers:    make(map[string]time.Time),
+		departed: make(map[int]departure),
+
+		frSrv:     frSrv,
+		msgSrv:    msgSrv,
+		convSrv:   convSrv,
+		randomSrv: randomSrv,
+		signalSrv: signalSrv,
+		randomCfg: randomCfg,
 
 		logger:         logger,
 		clients:        make(map[string]*Client, 32),
 		friendRequests: make(map[string]*Client, 4),
+		typing:         make(map[string]*typingState, 8),
+		dropped:        make(map[int]droppedMessages),
+		quit:           make(chan struct{}),
+		stopped:        make(chan struct{}),
 		connect:        make(chan *Client, 12),
 		disconnect:     make(chan *Client, 12),
 		messages:       make(chan *Message, 32),
-		queue:          []*Client{},
 		randomJoin:     make(chan *Client, 12),
 		randomLeave:    make(chan *Client, 12),
+		randomNext:     make(chan *Client, 12),
+		skips:          matchmaking.NewSkipLimiter(randomCfg.SkipInterval, randomCfg.SkipLimit, randomCfg.SkipWindow, randomCfg.SkipCooldown),
+		sessions:       matchmaking.NewSessions(randomCfg.SessionTTL),
+		waits:          matchmaking.NewWaitEstimator(matchRateWindow),
+		groupWaits:     matchmaking.NewWaitEstimator(matchRateWindow),
+	}
+
+	h.history = h.randomHistory()
+
+	matchCfg := matchmaking.Config{
+		Allow:        h.allowRandomPair,
+		InterestWait: randomCfg.InterestWait,
+		History:      h.history,
+		ThinQueue:    randomCfg.ThinQueue,
 	}
+
+	switch randomCfg.Matcher {
+	case config.MatcherScored:
+		score := matchmaking.InterestScore(randomCfg.InterestWait, scoredWaitWeight)
+		h.matcher = matchmaking.NewScored(matchCfg, matchmaking.ReputationScore(score, randomCfg.ReputationWeight))
+	default:
+		h.matcher = matchmaking.NewFIFO(matchCfg)
+	}
+
+	h.groups = matchmaking.NewGroupMatcher(matchCfg, groupMinSize, groupMaxSize)
+
+	return h
 }
 
+// The amount of messages fetched per query when syncing a client
+const syncBatchSize = 100
+
+// How long a sync waits for room in the client's send buffer before giving up
+const syncSendTimeout = 5 * time.Second
+
+// How often the random queue is rematched, this is what lets interest waits run out
+const randomMatchInterval = time.Second
+
+// The window of recent matches the estimated wait in queue_status is computed from
+const matchRateWindow = 5 * time.Minute
+
+// Score the scored matcher gives each second a pair waited, a shared interest is worth 10 seconds
+const scoredWaitWeight = 0.1
+
 type Message struct {
-	Type      string    `json:"type"`
-	From      int       `json:"from,omitempty"`
-	To        int       `json:"to,omitempty"`
-	Code      string    `json:"code,omitempty"` // This is used for error codes
-	Content   string    `json:"content,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+	Type           string     `json:"type"`
+	ID             int        `json:"id,omitempty"` // The stored message ID, on sync this is the last seen message ID
+	From           int        `json:"from,omitempty"`
+	To             int        `json:"to,omitempty"`
+	Code           string     `json:"code,omitempty"` // This is used for error codes
+	Content        string     `json:"content,omitempty"`
+	Scope          string     `json:"scope,omitempty"`           // Used by delete_message, either "me" or "everyone"
+	ReplyTo        int        `json:"reply_to,omitempty"`        // The ID of the direct message being replied to
+	ConversationID int        `json:"conversation_id,omitempty"` // The group conversation of a group_message
+	Timestamp      time.Time  `json:"timestamp"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"`
+
+	// Clients only send the ID of an uploaded attachment, the server fills in the rest
+	Attachment *dto.AttachmentDTO `json:"attachment,omitempty"`
+
+	// Sent with join_random, random_joined carries the interests the pair shares
+	Interests   []string                  `json:"interests,omitempty"`
+	Preferences *dto.RandomPreferencesDTO `json:"preferences,omitempty"`
+
+	RetryAfter int   `json:"retry_after,omitempty"` // Seconds until a refused action is allowed again
+	Dropped    int64 `json:"dropped,omitempty"`     // Messages missed on the last connection, sent with messages_dropped
+
+	Befriend bool                  `json:"befriend,omitempty"` // Sent with reveal_request to also become friends
+	Profile  *dto.PublicProfileDTO `json:"profile,omitempty"`  // The partner's profile on reveal
+
+	Session string `json:"session,omitempty"` // ID of a random chat session, used to report or rate the partner
+	Reason  string `json:"reason,omitempty"`  // Category of a report_random
+	Rating  string `json:"rating,omitempty"`  // Either "up" or "down" on rate_random
+
+	// Sent with queue_status, the estimated wait is in seconds and left out when there is no estimate yet
+	QueueSize     int `json:"queue_size,omitempty"`
+	Position      int `json:"position,omitempty"`
+	EstimatedWait int `json:"estimated_wait,omitempty"`
+
+	// WebRTC signaling, rtc_offer and rtc_answer carry the SDP and rtc_ice the candidate
+	SDP       string               `json:"sdp,omitempty"`
+	Candidate *dto.IceCandidateDTO `json:"candidate,omitempty"`
+
+	// Group random chat, the mode is sent with join_random and rooms refer to their members by alias
+	Mode    string   `json:"mode,omitempty"`
+	Alias   string   `json:"alias,omitempty"`
+	Members []string `json:"members,omitempty"`
 }
 
+/*
+Runs the hub until Shutdown stops it.
+
+Every event is handled on its own goroutine, Shutdown waits for the ones still running.
+*/
 func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	h.subscribe()
+	h.Heartbeat()
+
+	ticker := time.NewTicker(randomMatchInterval)
+	defer ticker.Stop()
+
+	clusterTicker := time.NewTicker(clusterInterval)
+	defer clusterTicker.Stop()
+
+	// A nil channel never fires, which leaves the queue status disabled
+	var statusC <-chan time.Time
+	if h.randomCfg.QueueStatusInterval > 0 {
+		statusTicker := time.NewTicker(h.randomCfg.QueueStatusInterval)
+		defer statusTicker.Stop()
+
+		statusC = statusTicker.C
+	}
+
+	var presenceC <-chan time.Time
+	if h.presence != nil {
+		// Refreshed a few times per TTL so one slow refresh does not take the users offline
+		presenceTicker := time.NewTicker(h.presence.TTL() / 3)
+		defer presenceTicker.Stop()
+
+		presenceC = presenceTicker.C
+	}
+
 	for {
 		select {
+		case <-h.quit:
+			return
+
+		case <-ticker.C:
+			h.spawn(func() { h.MatchRandom() })
+
+		case <-statusC:
+			h.spawn(func() { h.QueueStatus() })
+
+		case <-clusterTicker.C:
+			h.spawn(func() { h.Heartbeat() })
+
+		case <-presenceC:
+			h.spawn(func() { h.RefreshPresence() })
+
 		case c := <-h.connect:
-			go h.Connect(c)
+			h.spawn(func() { h.Connect(c) })
 
 		case c := <-h.disconnect:
-			go h.Disconnect(c)
+			h.spawn(func() { h.Disconnect(c) })
 
 		case c := <-h.randomJoin:
-			go h.JoinRandom(c)
+			h.spawn(func() { h.JoinRandom(c) })
 
 		case c := <-h.randomLeave:
-			go h.LeaveRandom(c)
+			h.spawn(func() { h.LeaveRandom(c) })
+
+		case c := <-h.randomNext:
+			h.spawn(func() { h.NextRandom(c) })
 
 		case m := <-h.messages:
-			go h.HandleMessage(m)
+			h.spawn(func() { h.HandleMessage(m) })
 		}
 	}
 }
@@ -166,48 +394,76 @@ func (h *Hub) Connect(c *Client) {
 	h.clientMU.Lock()
 	h.clients[c.userID.String()] = c
 	h.clientMU.Unlock()
+
+	h.registerPresence(c.userID.Int())
+	h.sendDropped(c)
 }
 
 func (h *Hub) Disconnect(c *Client) {
+	// Usually the read pump closed the socket already, otherwise the close frame is sent before taking the lock
+	c.closeSocket(closedByServer)
+
 	h.clientMU.Lock()
 	clientID := c.userID.String()
 
-	h.randomLeave <- c
-	if _, ok := h.clients[clientID]; ok {
+	// A reconnect may have replaced the client already, the new one stays
+	var replacement *Client
+	if current, ok := h.clients[clientID]; ok {
+		if current == c {
+			delete(h.clients, clientID)
+			go h.unregisterPresence(c.userID.Int())
+		} else {
+			replacement = current
+		}
+	}
 
-		delete(h.clients, clientID)
-		c.ws.Close()
-		close(c.send)
+	// Flag the client as disconnected, senders waiting for room in the queues give up
+	c.mu.Lock()
+	wasConnected := c.isConnected
+	if wasConnected {
+		c.isConnected = false
+		close(c.done)
+	}
+	c.mu.Unlock()
+
+	// Still under the client lock, so a reconnect either finds the dropped count or is the replacement told here
+	if wasConnected {
+		h.recordDropped(c, replacement)
 	}
+
 	h.clientMU.Unlock()
+
+	// Called directly, the hub may have stopped taking events. The client is no longer registered, so its
+	// random pair is told it disconnected instead of left
+	h.LeaveRandom(c)
 }
 
 func (h *Hub) JoinRandom(c *Client) {
 	c.mu.RLock()
 	alreadyInQueue := c.inQueue
-	isPaired := c.randomPair != nil
+	isPaired := c.randomPair != nil || c.room != nil
 	c.mu.RUnlock()
 
 	if alreadyInQueue {
 		h.logger.Info("user tried to join random but is already in queue", slog.String("user_id", c.userID.String()))
-		c.send <- &Message{
+		c.deliver(&Message{
 			Type:    "error",
 			Code:    "ALREADY_IN_QUEUE",
 			To:      c.userID.Int(),
 			Content: "The user is already queueing for random chat",
-		}
+		}, 0)
 
 		return
 	}
 
 	if isPaired {
 		h.logger.Info("user tried to join random but is already connected", slog.String("user_id", c.userID.String()))
-		c.send <- &Message{
+		c.deliver(&Message{
 			Type:    "error",
 			Code:    "CONNECTED_TO_RANDOM",
 			To:      c.userID.Int(),
 			Content: "The user is already connected in a random chat",
-		}
+		}, 0)
 
 		return
 	}
@@ -224,145 +480,545 @@ func (h *Hub) JoinRandom(c *Client) {
 		return
 	}
 
+	if retryAfter := h.skips.Cooldown(c.userID.Int(), time.Now()); retryAfter > 0 {
+		c.deliver(skipCooldownError(c, retryAfter), 0)
+		return
+	}
+
+	c.mu.RLock()
+	prefs := c.preferences
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	profile, err := h.randomSrv.Profile(ctx, &dto.JoinRandomDTO{
+		UserID:      c.userID.Int(),
+		Preferences: prefs,
+	})
+	if err != nil {
+		h.logger.Error("join random: failed to load random profile", slog.String("error", err.Error()))
+
+		code, content := "JOIN_RANDOM_FAILED", "Failed to join the random chat"
+		if errors.Is(err, service.ErrInvalidRandomPreferences) {
+			code, content = "INVALID_PREFERENCES", "The random chat preferences are invalid"
+		}
+
+		c.deliver(&Message{
+			Type:    "error",
+			Code:    code,
+			To:      c.userID.Int(),
+			Content: content,
+		}, 0)
+
+		return
+	}
+
+	// Checked for every candidate pair while queueMU is held, so it is loaded once up front
+	related, err := h.frSrv.RelatedUsers(ctx, c.userID.Int())
+	if err != nil {
+		h.logger.Error("join random: failed to load relationships", slog.String("error", err.Error()))
+		c.deliver(&Message{
+			Type:    "error",
+			Code:    "JOIN_RANDOM_FAILED",
+			To:      c.userID.Int(),
+			Content: "Failed to join the random chat",
+		}, 0)
+
+		return
+	}
+
 	h.queueMU.Lock()
 	defer h.queueMU.Unlock()
 
-	if len(h.queue) > 0 {
-		pair := h.queue[0]
-		h.queue = h.queue[1:]
+	c.mu.Lock()
+	if c.inQueue || c.randomPair != nil || c.room != nil {
+		c.mu.Unlock()
+		return
+	}
 
-		// Since na pop na ang client fro the queue, ato siya e flag as not in queue
-		pair.mu.Lock()
-		pair.inQueue = false
-		pair.mu.Unlock()
+	c.inQueue = true
+	mode := c.mode
+	c.entry = &matchmaking.Entry{
+		UserID:    c.userID.Int(),
+		Interests: c.interests,
+		Profile:   profile,
+		QueuedAt:  time.Now(),
+		Node:      h.node,
+		Related:   related,
+	}
+	entry := c.entry
 
-		// check nato if online ba ang napili nga pair
-		// basin na disconnect na
-		h.clientMU.RLock()
-		_, pairOnline := h.clients[pair.userID.String()]
-		h.clientMU.RUnlock()
+	c.mu.Unlock()
 
-		if !pairOnline {
-			h.randomJoin <- c
+	// The random queues of the cluster are run by another node
+	if !h.leading.Load() {
+		go h.publish(randomTopic, &busEvent{Kind: eventJoin, Mode: mode, Entry: entry})
+		return
+	}
 
-			return
-		}
+	queue := h.queueOf(mode)
+	queue.Enqueue(entry)
+
+	if queue == h.groups {
+		h.matchGroups()
+	} else {
+		h.matchQueue()
+	}
 
-		c.mu.RLock()
-		pair.mu.RLock()
+	// Let the client know where it stands right away instead of on the next status tick
+	h.sendQueueStatus(mode, entry.UserID)
+}
 
-		// We check relationship, if they are both in a relationship (friends or blocked) they don't get paired together
-		hasRelationship, err := h.frSrv.CheckStatus(context.Background(), &dto.FriendshipDTO{ // WARN: we may need to add proper context deadline
-			From: c.userID.Int(),
-			To:   pair.userID.Int(),
-		})
-		if err != nil {
-			h.logger.Error("join random: there was an error trying to check friendship status", slog.String("error", err.Error()))
-			pair.mu.RUnlock()
-			c.mu.RUnlock()
+// Sends the queued user its queue status, the caller must hold queueMU
+func (h *Hub) sendQueueStatus(mode string, userID int) {
+	if h.randomCfg.QueueStatusInterval <= 0 {
+		return
+	}
 
-			return
+	now := time.Now()
+	entries := h.queueOf(mode).Entries()
+
+	for i, e := range entries {
+		if e.UserID != userID {
+			continue
 		}
 
-		if hasRelationship {
-			// they are in a relationship so we we put both of them back into the queue
-			pair.mu.RUnlock()
-			c.mu.RUnlock()
+		if c, online := h.entryClient(e); online {
+			c.deliver(queueStatus(h.waitsOf(mode), e.UserID, len(entries), i+1, now), 0)
+		}
 
-			h.randomJoin <- pair
-			h.randomJoin <- c
-			return
+		return
+	}
+}
+
+/*
+Retries matching the queued clients and removes the ones that waited longer than the queue timeout.
+
+This runs periodically so clients waiting on interests get matched with anyone once their wait is over.
+*/
+func (h *Hub) MatchRandom() {
+	now := time.Now()
+
+	h.queueMU.Lock()
+	h.matchQueue()
+	h.matchGroups()
+	timedOut := h.expireQueue(now)
+	h.pruneDeparted(now)
+	h.queueMU.Unlock()
+
+	for _, c := range timedOut {
+		c.deliver(&Message{
+			Type:    "queue_timeout",
+			To:      c.userID.Int(),
+			Content: "No random partner was found in time",
+		}, 0)
+	}
+}
+
+/*
+Removes the users that waited longer than the queue timeout and returns their clients.
+
+Entries of users that went offline are dropped without returning a client, users queued on other nodes
+get a remote client. The queueMU lock must be held by the caller.
+*/
+func (h *Hub) expireQueue(now time.Time) []*Client {
+	if h.randomCfg.QueueTimeout <= 0 {
+		return nil
+	}
+
+	var expired []*matchmaking.Entry
+	for _, q := range []matchmaking.Queue{h.matcher, h.groups} {
+		expired = append(expired, q.Expire(now.Add(-h.randomCfg.QueueTimeout))...)
+	}
+
+	var timedOut []*Client
+	for _, e := range expired {
+		c, online := h.entryClient(e)
+		if !online {
+			continue
 		}
 
-		pair.mu.RUnlock()
-		c.mu.RUnlock()
+		if c.remote {
+			timedOut = append(timedOut, c)
+			continue
+		}
 
 		c.mu.Lock()
-		pair.mu.Lock()
-
-		pair.inQueue = false
+		queued := c.inQueue
 		c.inQueue = false
+		c.mu.Unlock()
 
-		c.randomPair = pair
-		pair.randomPair = c
+		if queued {
+			timedOut = append(timedOut, c)
+		}
+	}
 
-		h.logger.Info("a pair have been whirled", slog.String(c.userID.String(), pair.userID.String()))
+	return timedOut
+}
 
-		pair.mu.Unlock()
-		c.mu.Unlock()
+// Sends every queued client its position, the queue size and the estimated wait, groups queue on their own
+func (h *Hub) QueueStatus() {
+	now := time.Now()
 
-		c.send <- &Message{
-			Type:    "random_joined",
-			To:      c.userID.Int(),
-			Content: "You have been whirled",
+	for _, mode := range []string{randomModePair, randomModeGroup} {
+		h.queueMU.RLock()
+		entries := h.queueOf(mode).Entries()
+		h.queueMU.RUnlock()
+
+		for i, e := range entries {
+			c, online := h.entryClient(e)
+			if !online {
+				continue
+			}
+
+			c.deliver(queueStatus(h.waitsOf(mode), e.UserID, len(entries), i+1, now), 0)
 		}
+	}
+}
+
+func queueStatus(waits *matchmaking.WaitEstimator, userID, size, position int, now time.Time) *Message {
+	m := &Message{
+		Type:      "queue_status",
+		To:        userID,
+		QueueSize: size,
+		Position:  position,
+	}
 
-		pair.send <- &Message{
-			Type:    "random_joined",
-			To:      pair.userID.Int(),
-			Content: "You have been whirled",
+	if wait, ok := waits.Estimate(position, now); ok {
+		m.EstimatedWait = int(math.Ceil(wait.Seconds()))
+	}
+
+	return m
+}
+
+/*
+Runs the matcher and pairs the clients it matched.
+
+If one side of a pair went offline in the meantime the other side is queued again.
+Pairs with a user on another node are announced to the nodes, which pair their side on their own.
+The queueMU lock must be held by the caller.
+*/
+func (h *Hub) matchQueue() {
+	now := time.Now()
+	paired := 0
+
+	var remote []*matchmaking.Pair
+	for _, p := range h.matcher.Match(now) {
+		if p.A.Node != h.node || p.B.Node != h.node {
+			remote = append(remote, p)
+			paired += 2
+			continue
 		}
 
-		return
+		h.clientMU.RLock()
+		a, aOnline := h.clients[strconv.Itoa(p.A.UserID)]
+		b, bOnline := h.clients[strconv.Itoa(p.B.UserID)]
+		h.clientMU.RUnlock()
+
+		if aOnline && bOnline {
+			h.pairRandom(a, b, h.sessions.Start(a.userID.Int(), b.userID.Int(), p.Shared, now))
+			paired += 2
+			continue
+		}
+
+		if aOnline {
+			h.matcher.Enqueue(p.A)
+		}
+
+		if bOnline {
+			h.matcher.Enqueue(p.B)
+		}
 	}
 
-	c.mu.Lock()
-	if c.inQueue || c.randomPair != nil {
-		c.mu.Unlock()
-		return
+	h.waits.Record(paired, now)
+
+	if len(remote) > 0 {
+		go h.announcePairs(remote, now)
 	}
+}
 
-	c.inQueue = true
-	h.queue = append(h.queue, c)
+/*
+Builds the history of recent pairings the matcher avoids, nil when the window is disabled.
 
-	c.mu.Unlock()
+A persisted history loads the pairings of the last window, if loading fails the history starts empty.
+*/
+func (h *Hub) randomHistory() matchmaking.History {
+	if h.randomCfg.RecentWindow == 0 {
+		return nil
+	}
+
+	mem := matchmaking.NewMemoryHistory(h.randomCfg.RecentWindow)
+	if !h.randomCfg.PersistRecent {
+		return mem
+	}
+
+	history := matchmaking.NewPersistentHistory(mem, h.randomSrv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := history.Load(ctx, time.Now()); err != nil {
+		h.logger.Error("random history: failed to load recent pairs", slog.String("error", err.Error()))
+	}
+
+	return history
+}
+
+// Whether the two queued users may be paired, users that are friends or blocked each other never are
+func (h *Hub) allowRandomPair(a, b *matchmaking.Entry) bool {
+	if !service.RandomCompatible(a.Profile, b.Profile) {
+		return false
+	}
+
+	// Either side having the record is enough, the relationships are loaded on join
+	return !a.Related[b.UserID] && !b.Related[a.UserID]
+}
+
+/*
+Pairs the two clients in the session and tells both of them which interests they share.
+
+A remote pair is not told, its own node pairs it as well. Only pairs that were made end up in the history,
+users queued again because their partner went offline are not recent partners.
+*/
+func (h *Hub) pairRandom(c, pair *Client, sess *matchmaking.Session) {
+	h.saveSession(sess, "")
+	h.recordPair(sess)
+
+	// The queue may be run by a node that holds neither user, the copy is published since ending the pair writes to sess
+	if pair.remote {
+		started := *sess
+		go h.publish(randomTopic, &busEvent{Kind: eventStarted, Session: &started})
+	}
+
+	unlock := lockPair(c, pair)
+
+	pair.inQueue = false
+	c.inQueue = false
+
+	c.randomPair = pair
+	pair.randomPair = c
+	c.session = sess.ID
+	pair.session = sess.ID
+	c.resetReveal()
+	pair.resetReveal()
+
+	h.logger.Info("a pair have been whirled", slog.String(c.userID.String(), pair.userID.String()))
+
+	unlock()
+
+	c.deliver(&Message{
+		Type:      "random_joined",
+		To:        c.userID.Int(),
+		Content:   "You have been whirled",
+		Interests: sess.Shared,
+		Session:   sess.ID,
+	}, 0)
+
+	if pair.remote {
+		return
+	}
+
+	pair.deliver(&Message{
+		Type:      "random_joined",
+		To:        pair.userID.Int(),
+		Content:   "You have been whirled",
+		Interests: sess.Shared,
+		Session:   sess.ID,
+	}, 0)
 }
 
 func (h *Hub) LeaveRandom(c *Client) {
 	c.mu.RLock()
-	pair := c.randomPair
+	pair, room := c.randomPair, c.room
 	c.mu.RUnlock()
 
 	h.logger.Info("user is leaving random queue", slog.String("user", c.userID.String()))
 	// If the user has a pair then
 	// we clear the pair's random pair field
 
-	if pair != nil {
-		c.mu.Lock()
-		pair.mu.Lock()
-
-		c.randomPair = nil
-		pair.randomPair = nil
+	if pair != nil || room != nil {
+		h.clientMU.RLock()
+		online := h.clients[c.userID.String()] == c
+		h.clientMU.RUnlock()
 
-		pair.mu.Unlock()
-		c.mu.Unlock()
+		code, reason := "DISCONNECTED", model.EndDisconnect
+		if online {
+			// Leaving and joining again would get around the skip limit, so leaving a pair counts as a skip
+			h.skips.Skip(c.userID.Int(), time.Now())
+			code, reason = "LEFT", model.EndLeave
+		}
 
-		select {
-		case pair.send <- &Message{
-			Type:    "notification",
-			Content: "random_pair_left",
-		}:
-			// sent successfully
-		default:
-			h.logger.Info("random_leave: notification dropped: pair already disconnected")
+		if room != nil {
+			h.leaveRoom(c, room, code)
+			return
 		}
 
+		h.endRandomPair(c, pair, code, reason)
 		return
 	}
 
 	// not paired so we leave the queue
 	h.queueMU.Lock()
 	c.mu.Lock()
+	// Only a queued client removes its entry, a stale client of a reconnected user must not remove the new one
+	if c.inQueue {
+		if !h.leading.Load() {
+			go h.publish(randomTopic, &busEvent{Kind: eventLeave, Mode: c.mode, Entry: c.entry, At: time.Now()})
+		} else {
+			h.queueOf(c.mode).Dequeue(c.userID.Int())
+		}
+	}
 	c.inQueue = false
+	c.entry = nil
 	c.mu.Unlock()
+	h.queueMU.Unlock()
+}
+
+/*
+Ends the random pair of the client and queues the client again, in one step.
+
+The partner is told the pair was skipped. Skips are rate limited, a refused skip keeps the pair as it is.
+*/
+func (h *Hub) NextRandom(c *Client) {
+	c.mu.RLock()
+	pair, room := c.randomPair, c.room
+	inQueue := c.inQueue
+	c.mu.RUnlock()
+
+	// Already waiting for the next partner
+	if inQueue {
+		return
+	}
 
-	for i, cl := range h.queue {
-		if c.userID == cl.userID {
-			h.queue = append(h.queue[:i], h.queue[i+1:]...)
-			break // only remove first occurrence
+	if pair != nil || room != nil {
+		if retryAfter, ok := h.skips.Skip(c.userID.Int(), time.Now()); !ok {
+			c.deliver(skipCooldownError(c, retryAfter), 0)
+			return
+		}
+
+		if room != nil {
+			h.leaveRoom(c, room, "SKIPPED")
+		} else {
+			h.endRandomPair(c, pair, "SKIPPED", model.EndSkip)
 		}
 	}
-	h.queueMU.Unlock()
+
+	h.JoinRandom(c)
+}
+
+/*
+Unpairs the client and its partner and tells the partner why with the reason code.
+
+The session is saved with the end reason, which unlike the code is never shown to the partner.
+Nothing happens if the pair already ended, e.g. when both sides leave at the same time.
+A remote partner is unpaired by its own node once it hears of the end.
+*/
+func (h *Hub) endRandomPair(c, pair *Client, code string, reason model.RandomEndReason) {
+	unlock := lockPair(c, pair)
+
+	ended := c.randomPair == pair && pair.randomPair == c
+	sessionID := c.session
+	if ended {
+		c.randomPair = nil
+		pair.randomPair = nil
+		c.session = ""
+		pair.session = ""
+		c.resetReveal()
+		pair.resetReveal()
+	}
+
+	unlock()
+
+	if !ended {
+		return
+	}
+
+	if sess := h.sessions.End(sessionID, time.Now()); sess != nil {
+		h.saveSession(sess, reason)
+	}
+
+	notification := pairLeftNotification(code, sessionID)
+
+	if pair.remote {
+		h.publish(randomTopic, &busEvent{
+			Kind:    eventPairEnd,
+			Users:   []int{pair.userID.Int()},
+			From:    c.userID.Int(),
+			Session: &matchmaking.Session{ID: sessionID},
+			Reason:  reason,
+			Message: notification,
+		})
+
+		return
+	}
+
+	if !pair.deliver(notification, 0) {
+		h.logger.Info("random_leave: notification dropped: pair already disconnected")
+	}
+}
+
+// Remembers the users of the session as recent partners
+func (h *Hub) recordPair(sess *matchmaking.Session) {
+	if h.history != nil {
+		h.history.Record(sess.UserA, sess.UserB, sess.StartedAt)
+	}
+}
+
+/*
+Saves the random chat session in the background so a slow database does not hold up the pairing.
+
+An empty reason saves the start of the session.
+*/
+func (h *Hub) saveSession(sess *matchmaking.Session, reason model.RandomEndReason) {
+	s := &model.RandomSession{
+		ID:        sess.ID,
+		UserA:     sess.UserA,
+		UserB:     sess.UserB,
+		Interests: sess.Shared,
+		StartedAt: sess.StartedAt,
+	}
+
+	if reason != "" {
+		endedAt := sess.EndedAt
+		s.EndedAt = &endedAt
+		s.EndReason = &reason
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		if err := h.randomSrv.SaveSession(ctx, s); err != nil {
+			h.logger.Error("random session: failed to save session", slog.String("session", s.ID), slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// Locks both clients in user ID order so two goroutines locking the same pair cannot deadlock, returns the unlock
+func lockPair(a, b *Client) func() {
+	first, second := a, b
+	if b.userID.Int() < a.userID.Int() {
+		first, second = b, a
+	}
+
+	first.mu.Lock()
+	second.mu.Lock()
+
+	return func() {
+		second.mu.Unlock()
+		first.mu.Unlock()
+	}
+}
+
+func skipCooldownError(c *Client, retryAfter time.Duration) *Message {
+	return &Message{
+		Type:       "error",
+		Code:       "SKIP_COOLDOWN",
+		To:         c.userID.Int(),
+		Content:    "You are skipping too fast, try again later",
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+	}
 }
 
 func (h *Hub) HandleMessage(m *Message) {
@@ -381,70 +1037,136 @@ func (h *Hub) HandleMessage(m *Message) {
 		m.Timestamp = time.Now()
 		// save to database
 		// WARN: again we need to properly create a context with proper deadline
-		err := h.msgSrv.StoreMessage(context.Background(), m.From, m.To, m.Content, m.Timestamp)
+		data := &dto.StoreMessageDTO{
+			From:      m.From,
+			To:        m.To,
+			Content:   m.Content,
+			ReplyTo:   m.ReplyTo,
+			Timestamp: m.Timestamp,
+		}
+		if m.Attachment != nil {
+			data.AttachmentID = m.Attachment.ID
+		}
+
+		stored, err := h.msgSrv.StoreMessage(context.Background(), data)
 		if err != nil {
 			h.logger.Error("handle message:" + err.Error())
 			h.logger.Error("direct message error : failed to store message")
 
+			if errors.Is(err, service.ErrReplyNotExist) || errors.Is(err, service.ErrReplyNotInChat) {
+				client.deliver(&Message{
+					Type:    "error",
+					Code:    "INVALID_REPLY",
+					ReplyTo: m.ReplyTo,
+					Content: "The replied message does not exist in this conversation",
+				}, 0)
+
+				return
+			}
+
+			if errors.Is(err, service.ErrAttachmentNotExist) {
+				client.deliver(&Message{
+					Type:       "error",
+					Code:       "INVALID_ATTACHMENT",
+					Attachment: m.Attachment,
+					Content:    "The attachment does not exist or was already sent",
+				}, 0)
+
+				return
+			}
+
 			// This is an error because it should have been
-			select {
-			case client.send <- &Message{
+			client.deliver(&Message{
 				Type:    "error",
 				Code:    "SEND_MESSAGE_FAILED",
 				Content: "Random pair has disconnected",
-			}:
-			default:
-				// ignore on fail
-			}
+			}, 0)
 
 			return
 		}
 
-		h.clientMU.RLock()
-		receiver, online := h.clients[strconv.Itoa(m.To)]
-		h.clientMU.RUnlock()
-		if online {
-			select {
-			case receiver.send <- m:
-			default:
-			}
+		// The ID lets the receiver know where to continue from when it syncs
+		m.ID = stored.ID
+		if stored.Attachment != nil {
+			m.Attachment = dto.NewAttachmentDTO(stored.Attachment)
+		}
+		h.clearTyping(m.From, m.To)
+
+		if receiver := h.reach(m.To); receiver != nil {
+			receiver.deliver(m, 0)
 		}
 
 	case "message_random":
+		// Messages without a receiver are meant for the sender's room
+		if m.To == 0 {
+			h.RoomMessage(m)
+			break
+		}
 
 		h.clientMU.RLock()
-		receiver, online := h.clients[strconv.Itoa(m.To)]
 		c, cOnline := h.clients[strconv.Itoa(m.From)]
 		h.clientMU.RUnlock()
 
-		if !online {
+		// The pair may be on another node, so it is taken from the sender instead of the local clients
+		var receiver *Client
+		if cOnline {
+			c.mu.RLock()
+			if pair := c.randomPair; pair != nil && pair.userID.Int() == m.To {
+				receiver = pair
+			}
+			c.mu.RUnlock()
+		}
+
+		if receiver == nil {
 			// The pair is offline so we leave the chat
 			if cOnline {
 
 				c.logger.Error("message random error : pair is offline")
 
 				// This is an error because it should have been
-				select {
-				case c.send <- &Message{
+				c.deliver(&Message{
 					Type:    "error",
 					Code:    "SEND_MESSAGE_FAILED",
 					Content: "Random pair has disconnected",
-				}:
-				default:
-					// ignore on fail
-				}
+				}, 0)
 			}
 
 			return
 		}
 
+		h.clearTyping(m.From, m.To)
+
 		// We clear out the from id because we want it to be anonymous on the frontend
 		m.From = 0
 
-		select {
-		case receiver.send <- m:
-		default:
-		}
+		receiver.deliver(m, 0)
+
+	case "group_message":
+		h.GroupMessage(m)
+
+	case "sync":
+		h.Sync(m)
+
+	case "typing_start", "typing_stop":
+		h.RelayTyping(m)
+
+	case "edit_message", "delete_message":
+		h.ChangeMessage(m)
+
+	case "react", "unreact":
+		h.React(m)
+
+	case "reveal_request":
+		h.RevealRequest(m)
+
+	case "report_random":
+		h.ReportRandom(m)
+
+	case "rate_random":
+		h.RateRandom(m)
+
+	case "rtc_offer", "rtc_answer", "rtc_ice", "rtc_hangup":
+		h.RelaySignal(m)
 
 	case "friend_request":
 		senderID := strconv.Itoa(m.From)
@@ -452,13 +1174,22 @@ func (h *Hub) HandleMessage(m *Message) {
 
 		h.clientMU.RLock()
 		sender, sOnline := h.clients[senderID]
-		receiver, rOnline := h.clients[receiverID]
 		h.clientMU.RUnlock()
 
+		// The receiver is the random pair, which may be connected to another node
+		var receiver *Client
+		if sOnline {
+			sender.mu.RLock()
+			if pair := sender.randomPair; pair != nil && pair.userID.Int() == m.To {
+				receiver = pair
+			}
+			sender.mu.RUnlock()
+		}
+
 		h.friendMU.Lock()
 		defer h.friendMU.Unlock()
 
-		if !sOnline || !rOnline {
+		if receiver == nil {
 			// Clear any request made by either pariticipant
 			delete(h.friendRequests, receiverID)
 			delete(h.friendRequests, senderID)
@@ -479,113 +1210,557 @@ func (h *Hub) HandleMessage(m *Message) {
 				To:   m.To,
 			})
 			if err != nil {
-				select {
-				case sender.send <- &Message{
+				sender.deliver(&Message{
 					Type: "friend_request_failed",
-				}:
-				default:
-				}
+				}, 0)
 
-				select {
-				case receiver.send <- &Message{
+				receiver.deliver(&Message{
 					Type: "friend_request_failed",
-				}:
-				default:
-				}
+				}, 0)
 				return
 			}
 
 			// Notify
-			select {
-			case sender.send <- &Message{
+			sender.deliver(&Message{
 				Type: "friend_request_success",
-			}:
-			default:
-				// Just skip, just tryna avoid a panic :>
-			}
+			}, 0)
 
-			select {
-			case receiver.send <- &Message{
+			receiver.deliver(&Message{
 				Type: "friend_request_success",
-			}:
-			default:
-			}
+			}, 0)
 
 			return
 		}
 
 		h.friendRequests[senderID] = receiver
-		select {
-		case receiver.send <- &Message{
+		receiver.deliver(&Message{
 			Type: "friend_request",
-		}:
+		}, 0)
+	}
+}
+
+/*
+Streams every direct message the client received after the last seen message ID, oldest first.
+
+Once everything is sent the client receives a sync_complete message carrying the ID of the last synced message.
+Realtime messages may interleave with the synced ones so clients should deduplicate by ID.
+*/
+func (h *Hub) Sync(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	lastID := m.ID
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		messages, err := h.msgSrv.SyncMessages(ctx, m.From, lastID, syncBatchSize)
+		cancel()
+		if err != nil {
+			h.logger.Error("sync: failed to retrieve messages", slog.String("error", err.Error()))
+			c.deliver(&Message{
+				Type:    "error",
+				Code:    "SYNC_FAILED",
+				Content: "Failed to sync messages",
+			}, syncSendTimeout)
+
+			return
+		}
+
+		for _, msg := range messages {
+			if msg.DeletedAt != nil {
+				// Deleted for everyone so there is nothing to show
+				lastID = msg.ID
+				continue
+			}
+
+			synced := &Message{
+				Type:      "direct_message",
+				ID:        msg.ID,
+				From:      msg.SenderID,
+				To:        msg.ReceiverID,
+				Content:   msg.Content,
+				Timestamp: msg.Timestamp,
+				EditedAt:  msg.EditedAt,
+			}
+			if msg.ReplyTo != nil {
+				synced.ReplyTo = *msg.ReplyTo
+			}
+			if msg.Attachment != nil {
+				synced.Attachment = dto.NewAttachmentDTO(msg.Attachment)
+			}
+
+			ok := c.deliver(synced, syncSendTimeout)
+			if !ok {
+				h.logger.Info("sync: stopped, client is gone or not reading", slog.String("userID", c.userID.String()))
+				return
+			}
+
+			lastID = msg.ID
+		}
+
+		if len(messages) < syncBatchSize {
+			break
+		}
+	}
+
+	c.deliver(&Message{
+		Type:      "sync_complete",
+		ID:        lastID,
+		Timestamp: time.Now(),
+	}, syncSendTimeout)
+}
+
+// Edits or deletes a stored direct message on behalf of the sender of m
+func (h *Hub) ChangeMessage(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	var changed *model.Message
+	var err error
+	eventType := "message_updated"
+
+	if m.Type == "edit_message" {
+		changed, err = h.msgSrv.EditMessage(ctx, &dto.EditMessageDTO{
+			MessageID: m.ID,
+			UserID:    m.From,
+			Content:   m.Content,
+		})
+	} else {
+		eventType = "message_deleted"
+		changed, err = h.msgSrv.DeleteMessage(ctx, &dto.DeleteMessageDTO{
+			MessageID: m.ID,
+			UserID:    m.From,
+			Scope:     m.Scope,
+		})
+	}
+
+	if err != nil {
+		h.logger.Error("change message: failed to change message", slog.String("type", m.Type), slog.String("error", err.Error()))
+
+		if online {
+			c.deliver(&Message{
+				Type:    "error",
+				ID:      m.ID,
+				Code:    messageErrorCode(err, "CHANGE_MESSAGE_FAILED"),
+				Content: "Failed to change the message",
+			}, 0)
+		}
+
+		return
+	}
+
+	if m.Type == "delete_message" && m.Scope == service.DeleteForMe {
+		// Only the requester is affected
+		if online {
+			c.deliver(&Message{
+				Type:      eventType,
+				ID:        changed.ID,
+				Scope:     m.Scope,
+				Timestamp: time.Now(),
+			}, 0)
+		}
+
+		return
+	}
+
+	h.NotifyMessageChange(eventType, changed)
+}
+
+// Pushes a message_updated or message_deleted event to both participants of the message
+func (h *Hub) NotifyMessageChange(eventType string, m *model.Message) {
+	event := &Message{
+		Type:      eventType,
+		ID:        m.ID,
+		From:      m.SenderID,
+		To:        m.ReceiverID,
+		Content:   m.Content,
+		Timestamp: m.Timestamp,
+		EditedAt:  m.EditedAt,
+	}
+
+	if eventType == "message_deleted" {
+		event.Scope = service.DeleteForEveryone
+	}
+
+	h.deliverTo(event, m.SenderID, m.ReceiverID)
+}
+
+/*
+Adds or removes the sender's reaction on a direct message.
+
+The change is fanned out as reaction_added or reaction_removed to both participants of the message.
+*/
+func (h *Hub) React(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	data := &dto.ReactionDTO{
+		MessageID: m.ID,
+		UserID:    m.From,
+		Emoji:     m.Content,
+	}
+
+	var reacted *model.Message
+	var err error
+	eventType := "reaction_added"
+
+	if m.Type == "react" {
+		reacted, err = h.msgSrv.React(ctx, data)
+	} else {
+		eventType = "reaction_removed"
+		reacted, err = h.msgSrv.Unreact(ctx, data)
+	}
+
+	if err != nil {
+		h.logger.Error("react: failed to change reaction", slog.String("type", m.Type), slog.String("error", err.Error()))
+
+		if online {
+			c.deliver(&Message{
+				Type:    "error",
+				ID:      m.ID,
+				Code:    messageErrorCode(err, "REACTION_FAILED"),
+				Content: "Failed to change the reaction",
+			}, 0)
+		}
+
+		return
+	}
+
+	event := &Message{
+		Type:      eventType,
+		ID:        reacted.ID,
+		From:      m.From,
+		Content:   m.Content,
+		Timestamp: time.Now(),
+	}
+
+	h.deliverTo(event, reacted.SenderID, reacted.ReceiverID)
+}
+
+// Maps the message service errors to websocket error codes, fallback is used for unexpected errors
+func messageErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, service.ErrMessageNotExist):
+		return "MESSAGE_NOT_FOUND"
+	case errors.Is(err, service.ErrNotMessageSender):
+		return "NOT_MESSAGE_SENDER"
+	case errors.Is(err, service.ErrNotMessageParticipant):
+		return "NOT_MESSAGE_PARTICIPANT"
+	case errors.Is(err, service.ErrEditWindowExpired):
+		return "EDIT_WINDOW_EXPIRED"
+	case errors.Is(err, service.ErrMessageDeleted):
+		return "MESSAGE_DELETED"
+	case errors.Is(err, service.ErrEmptyMessage):
+		return "EMPTY_MESSAGE"
+	case errors.Is(err, service.ErrInvalidDeleteScope):
+		return "INVALID_DELETE_SCOPE"
+	case errors.Is(err, service.ErrInvalidReaction):
+		return "INVALID_REACTION"
+	case errors.Is(err, service.ErrReactionNotExist):
+		return "REACTION_NOT_FOUND"
+	default:
+		return fallback
+	}
+}
+
+// Forgets the reveal consent, the caller must hold the client lock
+func (c *Client) resetReveal() {
+	c.revealRequested = false
+	c.befriend = false
+}
+
+/*
+Sends the message to the client, waiting up to timeout for room in its queue.
+
+Control messages go to the control lane, everything else to the send queue. A zero timeout drops the message
+right away if the queue is full, the drop counts towards disconnecting the client as too slow.
+Returns false if the client disconnected or the message was not sent.
+Remote clients forward the message to their node, the timeout applies there.
+
+The client lock is not held while waiting, a disconnect must not wait on a slow client.
+*/
+func (c *Client) deliver(m *Message, timeout time.Duration) bool {
+	if c.remote {
+		return c.hub.forward(c, m, timeout)
+	}
+
+	c.mu.RLock()
+	connected := c.isConnected
+	c.mu.RUnlock()
+
+	if !connected {
+		return false
+	}
+
+	queue := c.send
+	if controlTypes[m.Type] {
+		queue = c.control
+	}
+
+	// Counted before it is queued, the write pump may take it right away
+	c.queued.Add(1)
+
+	if timeout <= 0 {
+		select {
+		case queue <- m:
+			return true
 		default:
+			c.queued.Add(-1)
+			c.overflow()
+			return false
 		}
 	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case queue <- m:
+		return true
+	case <-c.done:
+		c.queued.Add(-1)
+		return false
+	case <-t.C:
+		c.queued.Add(-1)
+		c.overflow()
+		return false
+	}
 }
 
+/*
+Writes the queued messages to the websocket and pings the client in between.
+
+The control lane is always written first. A write that takes longer than the write timeout means the client
+stopped reading, the connection is then closed. Writing stops once the client disconnected.
+*/
 func (c *Client) WriteMessage() {
+	ticker := time.NewTicker(c.socket.PingInterval)
 	defer func() {
+		ticker.Stop()
 		// INFO: my decision to close the websocket on write is message is because what if there were buffered messages
 		c.ws.Close()
 	}()
 
-	if !c.isConnected {
-	}
-
 	for {
-		m, ok := <-c.send
+		select {
+		case m := <-c.control:
+			if !c.write(m) {
+				return
+			}
 
-		if !ok {
-			c.logger.Info("write message: closing socket", slog.String("userID", c.userID.String()))
-			c.ws.WriteMessage(websocket.CloseMessage, []byte{})
-			return
+			continue
+		default:
 		}
 
-		if err := c.ws.WriteJSON(m); err != nil {
-			c.logger.Error("socket error: failed to write JSON", slog.String("error", err.Error()))
-			c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+		select {
+		case m := <-c.control:
+			if !c.write(m) {
+				return
+			}
+
+		case m := <-c.send:
+			if !c.write(m) {
+				return
+			}
+
+		case <-c.done:
+			c.logger.Info("write message: closing socket", slog.String("userID", c.userID.String()))
+			c.closeSocket(closedByServer)
 			return
+
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.socket.WriteTimeout)); err != nil {
+				c.closeSocket(writeCloseReason(err))
+				return
+			}
 		}
+	}
+}
+
+// Writes a message taken off a queue, returns false if the write failed
+func (c *Client) write(m *Message) bool {
+	c.ws.SetWriteDeadline(time.Now().Add(c.socket.WriteTimeout))
+	err := c.ws.WriteJSON(m)
+	left := c.queued.Add(-1)
+
+	if err != nil {
+		c.logger.Error("socket error: failed to write JSON", slog.String("error", err.Error()))
+		c.closeSocket(writeCloseReason(err))
+		return false
+	}
 
+	// The client caught up, an overflow has to start over
+	if left == 0 {
+		c.overflowSince.Store(0)
 	}
+
+	return true
 }
 
+/*
+Reads the messages of the client and hands them to the hub until the connection closes.
+
+Every message and pong pushes the read deadline back by the pong timeout, a client that goes quiet for longer
+is considered gone. Messages larger than the read limit close the connection with a message too big close code.
+*/
 func (c *Client) ReadMessage() {
 	defer func() {
 		// INFO: when the websocket closes it should get disconnected
-		c.hub.disconnect <- c
+		// A stopped hub no longer takes events, Shutdown closed every socket already
+		select {
+		case c.hub.disconnect <- c:
+		case <-c.hub.quit:
+		}
 	}()
-	// Add maxsize read
-	// Add timer
+
+	c.ws.SetReadLimit(c.socket.MaxMessageSize)
+	c.ws.SetReadDeadline(time.Now().Add(c.socket.PongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(c.socket.PongTimeout))
+	})
+
 	for {
 		// TODO: validate data
 		var msg Message
 		if err := c.ws.ReadJSON(&msg); err != nil {
-			c.logger.Error("read message: closing socket got error", slog.String("error", err.Error()))
-			c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+			reason := readCloseReason(err)
+			if reason != closedByClient {
+				c.logger.Error("read message: closing socket got error", slog.String("error", err.Error()))
+			}
+
+			c.closeSocket(reason)
 			return
 		}
 
+		c.ws.SetReadDeadline(time.Now().Add(c.socket.PongTimeout))
+
+		// The socket stays open for the close handshake, but the hub takes no more work
+		if c.hub.Draining() {
+			c.deliver(shuttingDownError(), 0)
+			continue
+		}
+
 		switch msg.Type {
 		case "join_random":
+			mode, ok := randomMode(msg.Mode)
+			if !ok {
+				c.deliver(invalidModeError(), 0)
+				break
+			}
+
+			c.mu.Lock()
+			if !c.inQueue && c.randomPair == nil && c.room == nil {
+				c.mode = mode
+				c.interests = normalizeInterests(msg.Interests)
+
+				c.preferences = dto.RandomPreferencesDTO{}
+				if msg.Preferences != nil {
+					c.preferences = *msg.Preferences
+				}
+			}
+			c.mu.Unlock()
+
 			c.hub.randomJoin <- c
 		case "leave_random":
 			c.hub.randomLeave <- c
+		case "next_random":
+			// Mode, interests and preferences are kept from the last join unless new ones are sent
+			mode, ok := randomMode(msg.Mode)
+			if !ok {
+				c.deliver(invalidModeError(), 0)
+				break
+			}
+
+			c.mu.Lock()
+			if msg.Mode != "" && !c.inQueue {
+				c.mode = mode
+			}
+
+			if msg.Interests != nil {
+				c.interests = normalizeInterests(msg.Interests)
+			}
+
+			if msg.Preferences != nil {
+				c.preferences = *msg.Preferences
+			}
+			c.mu.Unlock()
+
+			c.hub.randomNext <- c
 		case "message_random":
 			msg.From = c.userID.Int()
-			if pair := c.randomPair; pair == nil {
-				c.send <- &Message{
+
+			c.mu.RLock()
+			pair, room := c.randomPair, c.room
+			c.mu.RUnlock()
+
+			switch {
+			case room != nil:
+				msg.To = 0
+				c.hub.messages <- &msg
+			case pair != nil:
+				msg.To = pair.userID.Int()
+				c.hub.messages <- &msg
+			default:
+				c.deliver(&Message{
 					Type:    "error",
 					Code:    "CONNECTION_NOT_EXIST",
 					Content: "You are not connected to a random user",
+				}, 0)
+			}
+
+		case "direct_message", "group_message":
+			msg.From = c.userID.Int()
+			c.hub.messages <- &msg
+
+		case "sync":
+			msg.From = c.userID.Int()
+			c.hub.messages <- &msg
+
+		case "edit_message", "delete_message", "react", "unreact":
+			msg.From = c.userID.Int()
+			c.hub.messages <- &msg
+
+		case "typing_start", "typing_stop":
+			msg.From = c.userID.Int()
+
+			// Without a receiver the indicator is meant for the random pair
+			if msg.To == 0 {
+				c.mu.RLock()
+				pair := c.randomPair
+				c.mu.RUnlock()
+
+				if pair == nil {
+					c.deliver(&Message{
+						Type:    "error",
+						Code:    "CONNECTION_NOT_EXIST",
+						Content: "You are not connected to a random user",
+					}, 0)
+					break
 				}
-			} else {
+
 				msg.To = pair.userID.Int()
-				c.hub.messages <- &msg
 			}
 
-		case "direct_message":
+			c.hub.messages <- &msg
+
+		case "reveal_request", "report_random", "rate_random":
+			msg.From = c.userID.Int()
+			c.hub.messages <- &msg
+
+		case "rtc_offer", "rtc_answer", "rtc_ice", "rtc_hangup":
+			// Without a receiver the signal is meant for the random pair
 			msg.From = c.userID.Int()
 			c.hub.messages <- &msg
 
@@ -596,11 +1771,11 @@ func (c *Client) ReadMessage() {
 			c.hub.messages <- &msg
 
 		default:
-			c.send <- &Message{
+			c.deliver(&Message{
 				Type:    "error",
 				Code:    "INVALID_MESSAGE_TYPE",
 				Content: "The server does not recognize the message type",
-			}
+			}, 0)
 		}
 
 	}
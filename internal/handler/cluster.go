@@ -0,0 +1,792 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+/*
+Topics of the hub on the bus.
+
+Messages for users connected to other nodes go out on the deliver topic, every node hands them to its own clients.
+With a presence registry the node of the user is known and the message goes out on the topic of that node instead.
+The random topic carries the pair and group queues, which one node runs for the whole cluster. Handlers must never publish
+on their own topic without a goroutine, a full subscription would wait on itself.
+*/
+const (
+	deliverTopic = "hub_deliver"
+	randomTopic  = "hub_random"
+)
+
+const (
+	// How often a node announces itself to the others and tries to take over the random queues
+	clusterInterval = 2 * time.Second
+
+	// A node that was not heard from for this long is considered gone
+	peerTimeout = 3 * clusterInterval
+
+	// How long the queue leader remembers a leave, joins published before it are ignored
+	departedTTL = time.Minute
+
+	// Longest a forwarded message waits for room in the send buffer of the receiver, deliveries of a node are serial
+	forwardTimeout = signalSendTimeout
+
+	// Name of the bus lock held by the node running the random queues
+	queueLock = "random_queue"
+
+	// Longest the hub waits on the presence registry, a message for a user of another node waits on the lookup
+	presenceTimeout = time.Second
+)
+
+// Kinds of the events on the random topic
+const (
+	eventNode      = "node"       // Heartbeat of a node
+	eventLeader    = "leader"     // A node took over the random queues
+	eventJoin      = "join"       // A user joined a random queue on another node than the leader
+	eventLeave     = "leave"      // A user left a random queue on another node than the leader
+	eventPaired    = "paired"     // The leader paired users of which at least one is on another node
+	eventStarted   = "started"    // A node paired its side of a pair that spans two nodes
+	eventPairEnd   = "pair_end"   // One side ended a pair that spans two nodes
+	eventRoom      = "room"       // The leader put users of which at least one is on another node in a room
+	eventRoomLeave = "room_leave" // A member left a room that spans nodes
+)
+
+type busEvent struct {
+	Kind string `json:"kind,omitempty"`
+	Node string `json:"node"` // The publishing node
+
+	// Delivered messages and pair ends
+	Users   []int         `json:"users,omitempty"`
+	From    int           `json:"from,omitempty"` // The random pair of the receivers that sent the message
+	Timeout time.Duration `json:"timeout,omitempty"`
+	Message *Message      `json:"message,omitempty"`
+
+	// Random queues, joins and leaves without a mode are for the pair queue
+	Mode    string                `json:"mode,omitempty"`
+	Entry   *matchmaking.Entry    `json:"entry,omitempty"`
+	At      time.Time             `json:"at,omitzero"`
+	Pair    *matchmaking.Pair     `json:"pair,omitempty"`
+	Session *matchmaking.Session  `json:"session,omitempty"`
+	Reason  model.RandomEndReason `json:"reason,omitempty"`
+	Room    *roomEvent            `json:"room,omitempty"`
+}
+
+// A room that spans nodes, every node keeps the room with remote clients for the members of the others
+type roomEvent struct {
+	ID      string               `json:"id"`
+	Shared  []string             `json:"shared,omitempty"`
+	Members []*matchmaking.Entry `json:"members,omitempty"`
+	Aliases []string             `json:"aliases,omitempty"` // In the order of the members
+	Code    string               `json:"code,omitempty"`    // Why the member left
+}
+
+// Where a user that left the pair queue on another node was queued
+type departure struct {
+	node string
+	at   time.Time
+}
+
+// Subscribes the hub to its topics, called once when the hub starts
+func (h *Hub) subscribe() {
+	for topic, handler := range map[string]bus.Handler{
+		deliverTopic:      h.onDeliver,
+		nodeTopic(h.node): h.onDeliver,
+		randomTopic:       h.onRandom,
+	} {
+		if _, err := h.bus.Subscribe(topic, handler); err != nil {
+			h.logger.Error("cluster: failed to subscribe", slog.String("topic", topic), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Topic of the messages for the users connected to the node
+func nodeTopic(node string) string {
+	return deliverTopic + "_" + node
+}
+
+func (h *Hub) publish(topic string, ev *busEvent) error {
+	ev.Node = h.node
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := h.bus.Publish(ctx, topic, payload); err != nil {
+		h.logger.Error("cluster: failed to publish", slog.String("topic", topic), slog.String("kind", ev.Kind), slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+/*
+Announces the node to the others and takes over the random queues if no node runs them.
+
+The node that takes over queues its own waiting users and asks the other nodes for theirs.
+A node that lost the queues forgets them, the new leader collects the users again.
+*/
+func (h *Hub) Heartbeat() {
+	h.publish(randomTopic, &busEvent{Kind: eventNode})
+
+	ctx, cancel := context.WithTimeout(context.Background(), clusterInterval)
+	defer cancel()
+
+	leading, err := h.bus.TryLock(ctx, queueLock)
+	if err != nil {
+		// Two nodes running the queue would pair users twice, so an unknown state counts as lost
+		h.logger.Error("cluster: failed to check the queue lock", slog.String("error", err.Error()))
+		leading = false
+	}
+
+	if was := h.leading.Swap(leading); was == leading {
+		return
+	}
+
+	h.queueMU.Lock()
+	for _, mode := range []string{randomModePair, randomModeGroup} {
+		queue := h.queueOf(mode)
+
+		if leading {
+			for _, e := range h.localQueue(mode) {
+				queue.Enqueue(e)
+			}
+
+			continue
+		}
+
+		for _, e := range queue.Entries() {
+			queue.Dequeue(e.UserID)
+		}
+	}
+	if !leading {
+		h.departed = make(map[int]departure)
+	}
+	h.queueMU.Unlock()
+
+	if leading {
+		h.logger.Info("cluster: node took over the random queue", slog.String("node", h.node))
+		h.publish(randomTopic, &busEvent{Kind: eventLeader})
+	} else {
+		h.logger.Info("cluster: node lost the random queue", slog.String("node", h.node))
+	}
+}
+
+// Entries of the clients on this node waiting in the queue of the random chat mode
+func (h *Hub) localQueue(mode string) []*matchmaking.Entry {
+	h.clientMU.RLock()
+	defer h.clientMU.RUnlock()
+
+	var entries []*matchmaking.Entry
+	for _, c := range h.clients {
+		c.mu.RLock()
+		if c.inQueue && c.mode == mode && c.entry != nil {
+			entries = append(entries, c.entry)
+		}
+		c.mu.RUnlock()
+	}
+
+	return entries
+}
+
+// Reports if other nodes were heard from recently
+func (h *Hub) hasPeers() bool {
+	h.peerMU.Lock()
+	defer h.peerMU.Unlock()
+
+	now := time.Now()
+	for node, seen := range h.peers {
+		if now.Sub(seen) < peerTimeout {
+			return true
+		}
+
+		delete(h.peers, node)
+	}
+
+	return false
+}
+
+/*
+Returns the client of the user on this node, or a remote client forwarding to the node of the user.
+
+Nil means the user is offline. Without a presence registry that is only known for sure when there are no other
+nodes, the remote client then forwards to all of them.
+*/
+func (h *Hub) reach(userID int) *Client {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(userID)]
+	h.clientMU.RUnlock()
+
+	if online {
+		return c
+	}
+
+	if h.presence != nil {
+		nodes, err := h.lookup(userID)
+		if err == nil {
+			node, ok := nodes[userID]
+			if !ok || node == h.node {
+				return nil
+			}
+
+			return h.remoteClient(userID, node)
+		}
+	}
+
+	if !h.hasPeers() {
+		return nil
+	}
+
+	return h.remoteClient(userID, "")
+}
+
+// Returns a client standing in for a user connected to another node, whatever is delivered to it is forwarded
+func (h *Hub) remoteClient(userID int, node string) *Client {
+	return &Client{
+		logger:      h.logger,
+		userID:      uid(userID),
+		hub:         h,
+		remote:      true,
+		node:        node,
+		isConnected: true,
+	}
+}
+
+// Returns the nodes of the online users from the presence registry, the caller checks that there is one
+func (h *Hub) lookup(userIDs ...int) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	nodes, err := h.presence.Lookup(ctx, userIDs...)
+	if err != nil {
+		h.logger.Error("cluster: failed to look up users", slog.Int("users", len(userIDs)), slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+func (h *Hub) registerPresence(userIDs ...int) {
+	if h.presence == nil || len(userIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	if err := h.presence.Register(ctx, h.node, userIDs...); err != nil {
+		h.logger.Error("cluster: failed to register users", slog.Int("users", len(userIDs)), slog.String("error", err.Error()))
+	}
+}
+
+func (h *Hub) unregisterPresence(userID int) {
+	if h.presence == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), presenceTimeout)
+	defer cancel()
+
+	if err := h.presence.Unregister(ctx, h.node, userID); err != nil {
+		h.logger.Error("cluster: failed to unregister user", slog.Int("user_id", userID), slog.String("error", err.Error()))
+	}
+}
+
+// Registers the users connected to this node again before their presence expires
+func (h *Hub) RefreshPresence() {
+	h.clientMU.RLock()
+	userIDs := make([]int, 0, len(h.clients))
+	for _, c := range h.clients {
+		userIDs = append(userIDs, c.userID.Int())
+	}
+	h.clientMU.RUnlock()
+
+	h.registerPresence(userIDs...)
+}
+
+// Returns the client of a queued user, remote when the user queued on another node
+func (h *Hub) entryClient(e *matchmaking.Entry) (*Client, bool) {
+	if e.Node != h.node {
+		return h.remoteClient(e.UserID, e.Node), true
+	}
+
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(e.UserID)]
+	h.clientMU.RUnlock()
+
+	return c, online
+}
+
+/*
+Publishes the message for the user of the remote client, the local random pair is sent along as the sender.
+
+The message goes to the node of the user when it is known, to every node otherwise.
+*/
+func (h *Hub) forward(c *Client, m *Message, timeout time.Duration) bool {
+	c.mu.RLock()
+	from := 0
+	if c.randomPair != nil {
+		from = c.randomPair.userID.Int()
+	}
+	c.mu.RUnlock()
+
+	topic := deliverTopic
+	if c.node != "" {
+		topic = nodeTopic(c.node)
+	}
+
+	err := h.publish(topic, &busEvent{
+		Users:   []int{c.userID.Int()},
+		From:    from,
+		Timeout: min(timeout, forwardTimeout),
+		Message: m,
+	})
+
+	return err == nil
+}
+
+// Hands a message published by another node to the receivers connected to this node
+func (h *Hub) onDeliver(payload []byte) {
+	var ev busEvent
+	if err := json.Unmarshal(payload, &ev); err != nil || ev.Message == nil {
+		h.logger.Error("cluster: invalid delivery", slog.Int("size", len(payload)))
+		return
+	}
+
+	// The publisher already served its own clients
+	if ev.Node == h.node {
+		return
+	}
+
+	for _, id := range ev.Users {
+		h.clientMU.RLock()
+		c, online := h.clients[strconv.Itoa(id)]
+		h.clientMU.RUnlock()
+
+		if !online || !h.mirror(c, ev.From, ev.Message) {
+			continue
+		}
+
+		c.deliver(ev.Message, ev.Timeout)
+	}
+}
+
+/*
+Applies what the remote random pair of the client did to the local copy of the pair.
+
+A pair spanning two nodes is kept on both of them, each with a remote client for the other side.
+The consent to reveal and the friend requests of the other side are recorded here so the local side can answer them.
+Returns false if the message must not be delivered, because it is stale or was already answered.
+*/
+func (h *Hub) mirror(c *Client, from int, m *Message) bool {
+	switch m.Type {
+	case "queue_timeout":
+		c.mu.Lock()
+		c.inQueue = false
+		c.entry = nil
+		c.mu.Unlock()
+
+		return true
+
+	case "message_random":
+		if m.Alias == "" {
+			return true
+		}
+
+		// A room message must not reach a member that left the room after it was sent
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+
+		return c.room != nil && c.room.id == m.Session
+
+	case "reveal_request", "friend_request":
+	default:
+		return true
+	}
+
+	c.mu.RLock()
+	pair := c.randomPair
+	c.mu.RUnlock()
+
+	if pair == nil || !pair.remote || pair.userID.Int() != from {
+		return false
+	}
+
+	if m.Type == "friend_request" {
+		h.friendMU.Lock()
+		h.friendRequests[strconv.Itoa(from)] = c
+		h.friendMU.Unlock()
+
+		return true
+	}
+
+	unlock := lockPair(c, pair)
+	paired := c.randomPair == pair
+	if paired {
+		pair.revealRequested = true
+		pair.befriend = m.Befriend
+	}
+
+	// When both asked at the same time each side sees the other's request, only one of them may reveal
+	mutual := paired && c.revealRequested && c.userID.Int() < pair.userID.Int()
+	befriend := c.befriend && pair.befriend
+	unlock()
+
+	if mutual {
+		go h.reveal(c, pair, befriend)
+		return false
+	}
+
+	return paired
+}
+
+func (h *Hub) onRandom(payload []byte) {
+	var ev busEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		h.logger.Error("cluster: invalid random event", slog.Int("size", len(payload)))
+		return
+	}
+
+	switch ev.Kind {
+	case eventNode:
+		if ev.Node != h.node {
+			h.peerMU.Lock()
+			h.peers[ev.Node] = time.Now()
+			h.peerMU.Unlock()
+		}
+
+	case eventLeader:
+		// A new leader starts with empty queues, the users waiting here are queued with it again
+		if ev.Node != h.node {
+			for _, mode := range []string{randomModePair, randomModeGroup} {
+				for _, e := range h.localQueue(mode) {
+					go h.publish(randomTopic, &busEvent{Kind: eventJoin, Mode: mode, Entry: e})
+				}
+			}
+		}
+
+	case eventJoin:
+		mode, ok := randomMode(ev.Mode)
+		if ok && h.leading.Load() && ev.Entry != nil {
+			h.queueRemote(mode, ev.Entry)
+		}
+
+	case eventLeave:
+		mode, ok := randomMode(ev.Mode)
+		if ok && h.leading.Load() && ev.Entry != nil {
+			h.dequeueRemote(mode, ev.Node, ev.Entry.UserID, ev.At)
+		}
+
+	case eventPaired:
+		if ev.Pair != nil && ev.Session != nil {
+			h.onPaired(ev.Session, ev.Pair)
+		}
+
+	case eventStarted:
+		// The node that published it recorded the pair already
+		if ev.Node != h.node && ev.Session != nil {
+			h.recordPair(ev.Session)
+		}
+
+	case eventPairEnd:
+		h.onPairEnd(&ev)
+
+	case eventRoom:
+		if ev.Room != nil && len(ev.Room.Members) == len(ev.Room.Aliases) {
+			h.onRoom(ev.Room)
+		}
+
+	case eventRoomLeave:
+		if ev.Room != nil {
+			h.onRoomLeave(&ev)
+		}
+	}
+}
+
+// Queues a user that joined on another node, the caller must be the queue leader
+func (h *Hub) queueRemote(mode string, e *matchmaking.Entry) {
+	h.queueMU.Lock()
+	defer h.queueMU.Unlock()
+
+	// The leave was published after the join but arrived first
+	if d, ok := h.departed[e.UserID]; ok && d.node == e.Node && !e.QueuedAt.After(d.at) {
+		return
+	}
+
+	// A join announced again to a new leader replaces the entry it already has
+	queue := h.queueOf(mode)
+	queue.Dequeue(e.UserID)
+	queue.Enqueue(e)
+
+	if queue == h.groups {
+		h.matchGroups()
+	} else {
+		h.matchQueue()
+	}
+
+	h.sendQueueStatus(mode, e.UserID)
+}
+
+// Removes a user that left the queue on another node, unless the user queued again on a different one
+func (h *Hub) dequeueRemote(mode, node string, userID int, at time.Time) {
+	h.queueMU.Lock()
+	defer h.queueMU.Unlock()
+
+	h.departed[userID] = departure{node: node, at: at}
+
+	queue := h.queueOf(mode)
+	for _, e := range queue.Entries() {
+		if e.UserID == userID && e.Node == node && !e.QueuedAt.After(at) {
+			queue.Dequeue(userID)
+		}
+	}
+}
+
+// Forgets the leaves old enough that no join published before them is still on its way
+func (h *Hub) pruneDeparted(now time.Time) {
+	for userID, d := range h.departed {
+		if now.Sub(d.at) >= departedTTL {
+			delete(h.departed, userID)
+		}
+	}
+}
+
+// Lets the nodes of the users know the leader paired them, the pairs are sent one by one
+func (h *Hub) announcePairs(pairs []*matchmaking.Pair, now time.Time) {
+	for _, p := range pairs {
+		h.publish(randomTopic, &busEvent{
+			Kind:    eventPaired,
+			Pair:    p,
+			Session: matchmaking.NewSession(p.A.UserID, p.B.UserID, p.Shared, now),
+		})
+	}
+}
+
+/*
+Pairs the users on this node the leader matched.
+
+A user that left the queue in the meantime can no longer take part, when the partner is on another node it was
+already paired there and is told the user disconnected. A partner on this node is queued again instead.
+*/
+func (h *Hub) onPaired(sess *matchmaking.Session, p *matchmaking.Pair) {
+	aLocal, bLocal := p.A.Node == h.node, p.B.Node == h.node
+	if !aLocal && !bLocal {
+		return
+	}
+
+	h.queueMU.Lock()
+	a, b := h.queuedClient(p.A), h.queuedClient(p.B)
+
+	var requeue, left *matchmaking.Entry
+	var from int
+
+	switch {
+	case aLocal && bLocal:
+		switch {
+		case a != nil && b != nil:
+			h.sessions.Add(sess, time.Now())
+			h.pairRandom(a, b, sess)
+		case a != nil:
+			requeue = p.A
+		case b != nil:
+			requeue = p.B
+		}
+
+	default:
+		c, partner, own := a, p.B, p.A
+		if bLocal {
+			c, partner, own = b, p.A, p.B
+		}
+
+		if c == nil {
+			left, from = partner, own.UserID
+			break
+		}
+
+		h.sessions.Add(sess, time.Now())
+		h.pairRandom(c, h.remoteClient(partner.UserID, partner.Node), sess)
+	}
+	h.queueMU.Unlock()
+
+	if requeue != nil {
+		go h.publish(randomTopic, &busEvent{Kind: eventJoin, Entry: requeue})
+	}
+
+	if left != nil {
+		go h.publish(randomTopic, &busEvent{
+			Kind:    eventPairEnd,
+			Users:   []int{left.UserID},
+			From:    from,
+			Session: sess,
+			Reason:  model.EndDisconnect,
+			Message: pairLeftNotification("DISCONNECTED", sess.ID),
+		})
+	}
+}
+
+// Returns the client on this node still waiting with the entry, nil if it left or queued again since
+func (h *Hub) queuedClient(e *matchmaking.Entry) *Client {
+	if e.Node != h.node {
+		return nil
+	}
+
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(e.UserID)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.inQueue || c.entry == nil || !c.entry.QueuedAt.Equal(e.QueuedAt) {
+		return nil
+	}
+
+	return c
+}
+
+// Ends the local side of a pair spanning two nodes after the other side ended it
+func (h *Hub) onPairEnd(ev *busEvent) {
+	if ev.Node == h.node || len(ev.Users) != 1 || ev.Message == nil || ev.Session == nil {
+		return
+	}
+
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(ev.Users[0])]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	c.mu.RLock()
+	pair, session := c.randomPair, c.session
+	c.mu.RUnlock()
+
+	if pair == nil || !pair.remote || pair.userID.Int() != ev.From || session != ev.Session.ID {
+		return
+	}
+
+	h.endRandomPair(pair, c, ev.Message.Code, ev.Reason)
+}
+
+// The notification the random pair gets when the pair ended, the code tells why
+func pairLeftNotification(code, sessionID string) *Message {
+	return &Message{
+		Type:    "notification",
+		Code:    code,
+		Content: "random_pair_left",
+		Session: sessionID,
+	}
+}
+
+// Lets the nodes of the members know the leader put them in a room, the rooms are sent one by one
+func (h *Hub) announceRooms(groups []*matchmaking.Group) {
+	for _, g := range groups {
+		h.publish(randomTopic, &busEvent{
+			Kind: eventRoom,
+			Room: &roomEvent{
+				ID:      uuid.NewString(),
+				Shared:  g.Shared,
+				Members: g.Members,
+				Aliases: roomAliases(len(g.Members)),
+			},
+		})
+	}
+}
+
+/*
+Opens the side of this node of a room the leader formed.
+
+A member of this node that left the queue in the meantime is taken out of the room right after it opened,
+the other nodes are told so they take the member out of their side as well.
+*/
+func (h *Hub) onRoom(r *roomEvent) {
+	if !slices.ContainsFunc(r.Members, func(e *matchmaking.Entry) bool { return e.Node == h.node }) {
+		return
+	}
+
+	h.queueMU.Lock()
+	clients := make([]*Client, len(r.Members))
+	var gone []*Client
+
+	for i, e := range r.Members {
+		if e.Node != h.node {
+			clients[i] = h.remoteClient(e.UserID, e.Node)
+			continue
+		}
+
+		if c := h.queuedClient(e); c != nil {
+			clients[i] = c
+			continue
+		}
+
+		// Stands in for the member until it is taken out, nothing is forwarded to the own node
+		clients[i] = h.remoteClient(e.UserID, h.node)
+		gone = append(gone, clients[i])
+	}
+
+	room := h.openRoom(r.ID, clients, r.Aliases, r.Shared)
+	h.queueMU.Unlock()
+
+	for _, c := range gone {
+		h.leaveRoom(c, room, "DISCONNECTED")
+	}
+}
+
+// Tells the nodes of the other members of a room that spans nodes that the user left it
+func (h *Hub) announceRoomLeave(roomID string, userID int, code string, members []int) {
+	if len(members) == 0 {
+		return
+	}
+
+	// Room leaves share the topic with the room they are for, so no node sees the leave before the room
+	go h.publish(randomTopic, &busEvent{
+		Kind:  eventRoomLeave,
+		Users: members,
+		From:  userID,
+		Room:  &roomEvent{ID: roomID, Code: code},
+	})
+}
+
+// Takes a member that left on another node out of the side of this node of the room
+func (h *Hub) onRoomLeave(ev *busEvent) {
+	if ev.Node == h.node {
+		return
+	}
+
+	for _, id := range ev.Users {
+		h.clientMU.RLock()
+		c, online := h.clients[strconv.Itoa(id)]
+		h.clientMU.RUnlock()
+
+		if !online {
+			continue
+		}
+
+		c.mu.RLock()
+		room := c.room
+		c.mu.RUnlock()
+
+		// Every member on this node shares the same room, it is left once
+		if room != nil && room.id == ev.Room.ID {
+			h.dropMember(room, ev.From, ev.Room.Code)
+			return
+		}
+	}
+}
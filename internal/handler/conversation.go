@@ -0,0 +1,453 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+type ConversationHandlr struct {
+	rspHandler *ResponseHandler
+	srv        service.ConversationService
+	hub        *Hub
+	logger     *slog.Logger
+}
+
+type ConversationHandler interface {
+	CreateConversation(w http.ResponseWriter, r *http.Request)
+	RetrieveConversation(w http.ResponseWriter, r *http.Request)
+	RetrieveConversations(w http.ResponseWriter, r *http.Request)
+	RetrieveMessages(w http.ResponseWriter, r *http.Request)
+	InviteMember(w http.ResponseWriter, r *http.Request)
+	KickMember(w http.ResponseWriter, r *http.Request)
+	ChangeMemberRole(w http.ResponseWriter, r *http.Request)
+	LeaveConversation(w http.ResponseWriter, r *http.Request)
+}
+
+func NewConversationHandler(srv service.ConversationService, hub *Hub, rspHandler *ResponseHandler, logger *slog.Logger) ConversationHandler {
+	return &ConversationHandlr{
+		srv:        srv,
+		hub:        hub,
+		rspHandler: rspHandler,
+		logger:     logger,
+	}
+}
+
+func (h *ConversationHandlr) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("create conversation: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("create conversation unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("create conversation: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	data := new(dto.CreateConversationDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data.OwnerID = userID
+
+	rspData, err := h.srv.CreateConversation(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	h.hub.NotifyConversation(&Message{
+		Type:           "conversation_created",
+		From:           userID,
+		ConversationID: rspData.Conversation.ID,
+		Content:        rspData.Conversation.Name,
+	})
+
+	rspData.Status = http.StatusCreated
+	h.rspHandler.JSON(w, http.StatusCreated, rspData)
+}
+
+func (h *ConversationHandlr) RetrieveConversation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("retrieve conversation: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("retrieve conversation: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("retrieve conversation: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	rspData, err := h.srv.RetrieveConversation(ctx, conversationID, userID)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	rspData.Status = http.StatusOK
+	h.rspHandler.JSON(w, http.StatusOK, rspData)
+}
+
+func (h *ConversationHandlr) RetrieveConversations(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("retrieve conversations: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("retrieve conversations: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	rspData, err := h.srv.RetrieveConversations(ctx, userID)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	rspData.Status = http.StatusOK
+	h.rspHandler.JSON(w, http.StatusOK, rspData)
+}
+
+func (h *ConversationHandlr) RetrieveMessages(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("retrieve conversation messages: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("retrieve conversation messages: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("retrieve conversation messages: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		if page, err = strconv.Atoi(p); err != nil {
+			h.logger.Error("retrieve conversation messages: failed to convert page to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+			h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+			return
+		}
+	}
+
+	rspData, err := h.srv.RetrieveMessages(ctx, conversationID, userID, page)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	rspData.Status = http.StatusOK
+	h.rspHandler.JSON(w, http.StatusOK, rspData)
+}
+
+func (h *ConversationHandlr) InviteMember(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("invite member: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("invite member unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("invite member: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("invite member: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data := new(dto.ConversationMemberDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data.ConversationID = conversationID
+	data.ActorID = userID
+
+	member, err := h.srv.InviteMember(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	h.hub.NotifyConversation(&Message{
+		Type:           "group_member_added",
+		From:           userID,
+		To:             member.UserID,
+		ConversationID: conversationID,
+	})
+
+	h.rspHandler.JSON(w, http.StatusCreated, &dto.ConversationMemberSuccessDTO{
+		Status: http.StatusCreated,
+		Member: member,
+	})
+}
+
+func (h *ConversationHandlr) KickMember(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodDelete {
+		h.logger.Error("kick member: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("kick member: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("kick member: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		h.logger.Error("kick member: failed to convert user id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	err = h.srv.KickMember(ctx, &dto.ConversationMemberDTO{
+		ConversationID: conversationID,
+		ActorID:        userID,
+		UserID:         memberID,
+	})
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	// The kicked member is no longer part of the conversation so it is notified separately
+	h.hub.NotifyConversation(&Message{
+		Type:           "group_member_removed",
+		From:           userID,
+		To:             memberID,
+		ConversationID: conversationID,
+	}, memberID)
+
+	h.rspHandler.JSON(w, http.StatusOK, &dto.ConversationServiceSuccessDTO{
+		Status:  http.StatusOK,
+		Message: "Successfully removed member",
+	})
+}
+
+func (h *ConversationHandlr) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPut {
+		h.logger.Error("change member role: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("change member role unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("change member role: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("change member role: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	memberID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		h.logger.Error("change member role: failed to convert user id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data := new(dto.ConversationMemberDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data.ConversationID = conversationID
+	data.ActorID = userID
+	data.UserID = memberID
+
+	member, err := h.srv.ChangeMemberRole(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	h.hub.NotifyConversation(&Message{
+		Type:           "group_role_changed",
+		From:           userID,
+		To:             memberID,
+		ConversationID: conversationID,
+		Content:        string(member.Role),
+	})
+
+	h.rspHandler.JSON(w, http.StatusOK, &dto.ConversationMemberSuccessDTO{
+		Status: http.StatusOK,
+		Member: member,
+	})
+}
+
+func (h *ConversationHandlr) LeaveConversation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("leave conversation: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("leave conversation: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("leave conversation: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	if err := h.srv.LeaveConversation(ctx, conversationID, userID); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.conversationError(w, err)
+		return
+	}
+
+	h.hub.NotifyConversation(&Message{
+		Type:           "group_member_left",
+		From:           userID,
+		ConversationID: conversationID,
+	})
+
+	h.rspHandler.JSON(w, http.StatusOK, &dto.ConversationServiceSuccessDTO{
+		Status:  http.StatusOK,
+		Message: "Successfully left the conversation",
+	})
+}
+
+// Maps the conversation service errors to the http response
+func (h *ConversationHandlr) conversationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrConversationNotExist):
+		h.rspHandler.Error(w, http.StatusNotFound, "conversation not found", nil)
+	case errors.Is(err, service.ErrNotConversationMember):
+		h.rspHandler.Error(w, http.StatusForbidden, "not a member of the conversation", nil)
+	case errors.Is(err, service.ErrConversationForbidden):
+		h.rspHandler.Error(w, http.StatusForbidden, "your role does not allow this action", nil)
+	case errors.Is(err, service.ErrKickSelf):
+		h.rspHandler.Error(w, http.StatusBadRequest, "leave the conversation instead of kicking yourself", nil)
+	case errors.Is(err, service.ErrAlreadyConversationMember):
+		h.rspHandler.Error(w, http.StatusConflict, "user is already a member", nil)
+	case errors.Is(err, service.ErrConversationFull):
+		h.rspHandler.Error(w, http.StatusConflict, "conversation has reached the max members", nil)
+	case errors.Is(err, service.ErrNotFriends):
+		h.rspHandler.Error(w, http.StatusForbidden, "only friends can be added to a conversation", nil)
+	case errors.Is(err, service.ErrInvalidConversationName):
+		h.rspHandler.Error(w, http.StatusBadRequest, "name must be between 1 and 64 characters", nil)
+	case errors.Is(err, service.ErrInvalidConversationRole):
+		h.rspHandler.Error(w, http.StatusBadRequest, "role must be either admin or member", nil)
+	default:
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+	}
+}
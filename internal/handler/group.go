@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+/*
+Stores a group message and fans it out to the members of the conversation that are online.
+
+Members that are offline get the message from the conversation history.
+*/
+func (h *Hub) GroupMessage(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	m.Timestamp = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	stored, recipients, err := h.convSrv.SendMessage(ctx, &dto.GroupMessageDTO{
+		From:           m.From,
+		ConversationID: m.ConversationID,
+		Content:        m.Content,
+		Timestamp:      m.Timestamp,
+	})
+	if err != nil {
+		h.logger.Error("group message: failed to store message", slog.String("error", err.Error()))
+
+		if online {
+			c.deliver(&Message{
+				Type:           "error",
+				Code:           conversationErrorCode(err, "SEND_MESSAGE_FAILED"),
+				ConversationID: m.ConversationID,
+				Content:        "Failed to send the group message",
+			}, 0)
+		}
+
+		return
+	}
+
+	event := &Message{
+		Type:           "group_message",
+		ID:             stored.ID,
+		From:           m.From,
+		ConversationID: m.ConversationID,
+		Content:        stored.Content,
+		Timestamp:      stored.Timestamp,
+	}
+
+	h.deliverTo(event, recipients...)
+}
+
+/*
+Pushes a membership change of the conversation to its online members.
+
+The extra users are notified as well, this is used to reach members that were just removed.
+*/
+func (h *Hub) NotifyConversation(event *Message, extra ...int) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	memberIDs, err := h.convSrv.MemberIDs(ctx, event.ConversationID)
+	if err != nil {
+		h.logger.Error("notify conversation: failed to retrieve members", slog.String("error", err.Error()))
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	h.deliverTo(event, append(memberIDs, extra...)...)
+}
+
+/*
+Sends the message to every given user that is online, users whose buffer is full miss it.
+
+Users not connected to this node are reached through the other nodes, with one publish per node when the presence
+registry knows where they are and a single publish to every node otherwise.
+*/
+func (h *Hub) deliverTo(m *Message, userIDs ...int) {
+	h.clientMU.RLock()
+	receivers := make([]*Client, 0, len(userIDs))
+	var remote []int
+	for _, id := range userIDs {
+		if cl, ok := h.clients[strconv.Itoa(id)]; ok {
+			receivers = append(receivers, cl)
+		} else {
+			remote = append(remote, id)
+		}
+	}
+	h.clientMU.RUnlock()
+
+	for _, cl := range receivers {
+		cl.deliver(m, 0)
+	}
+
+	if len(remote) == 0 {
+		return
+	}
+
+	if h.presence != nil {
+		if nodes, err := h.lookup(remote...); err == nil {
+			// One message per node holding some of the receivers, offline users are dropped
+			byNode := make(map[string][]int)
+			for _, id := range remote {
+				if node, ok := nodes[id]; ok && node != h.node {
+					byNode[node] = append(byNode[node], id)
+				}
+			}
+
+			for node, ids := range byNode {
+				h.publish(nodeTopic(node), &busEvent{Users: ids, Message: m})
+			}
+
+			return
+		}
+	}
+
+	if h.hasPeers() {
+		h.publish(deliverTopic, &busEvent{Users: remote, Message: m})
+	}
+}
+
+// Maps the conversation service errors to websocket error codes, fallback is used for unexpected errors
+func conversationErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, service.ErrNotConversationMember):
+		return "NOT_CONVERSATION_MEMBER"
+	case errors.Is(err, service.ErrEmptyMessage):
+		return "EMPTY_MESSAGE"
+	default:
+		return fallback
+	}
+}
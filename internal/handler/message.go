@@ -1,26 +1,35 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/jlry-dev/whirl/internal/model/dto"
 	"github.com/jlry-dev/whirl/internal/service"
 )
 
 type MessageHandlr struct {
 	rspHandler *ResponseHandler
 	srv        service.MessageService
+	hub        *Hub
 	logger     *slog.Logger
 }
 
 type MessageHandler interface {
 	RetrieveMessages(w http.ResponseWriter, r *http.Request)
+	SearchMessages(w http.ResponseWriter, r *http.Request)
+	EditMessage(w http.ResponseWriter, r *http.Request)
+	DeleteMessage(w http.ResponseWriter, r *http.Request)
 }
 
-func NewMessageHandler(service service.MessageService, rspHandler *ResponseHandler, logger *slog.Logger) MessageHandler {
+func NewMessageHandler(service service.MessageService, hub *Hub, rspHandler *ResponseHandler, logger *slog.Logger) MessageHandler {
 	return &MessageHandlr{
 		srv:        service,
+		hub:        hub,
 		rspHandler: rspHandler,
 		logger:     logger,
 	}
@@ -80,3 +89,195 @@ func (h *MessageHandlr) RetrieveMessages(w http.ResponseWriter, r *http.Request)
 	dto.Status = http.StatusOK
 	h.rspHandler.JSON(w, http.StatusOK, dto)
 }
+
+func (h *MessageHandlr) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("search messages: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("search messages: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	params := r.URL.Query()
+	data := &dto.SearchMessagesDTO{
+		UserID: userID,
+		Query:  params.Get("q"),
+	}
+
+	// Both are optional
+	var err error
+	if with := params.Get("with"); with != "" {
+		if data.With, err = strconv.Atoi(with); err != nil {
+			h.logger.Error("search messages: failed to convert with to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+			h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+			return
+		}
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		if data.Cursor, err = strconv.Atoi(cursor); err != nil {
+			h.logger.Error("search messages: failed to convert cursor to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+			h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+			return
+		}
+	}
+
+	rspData, err := h.srv.SearchMessages(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+
+		if errors.Is(err, service.ErrInvalidSearchQuery) {
+			h.rspHandler.Error(w, http.StatusBadRequest, "search query must be between 1 and 200 characters", nil)
+			return
+		}
+
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	rspData.Status = http.StatusOK
+	h.rspHandler.JSON(w, http.StatusOK, rspData)
+}
+
+func (h *MessageHandlr) EditMessage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPut {
+		h.logger.Error("edit message: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("edit message unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("edit message: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("edit message: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data := new(dto.EditMessageDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data.MessageID = messageID
+	data.UserID = userID
+
+	m, err := h.srv.EditMessage(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.messageError(w, err)
+		return
+	}
+
+	h.hub.NotifyMessageChange("message_updated", m)
+
+	h.rspHandler.JSON(w, http.StatusOK, &dto.MessageDTO{
+		Status:  http.StatusOK,
+		Message: m,
+	})
+}
+
+func (h *MessageHandlr) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodDelete {
+		h.logger.Error("delete message: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("delete message unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("delete message: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.logger.Error("delete message: failed to convert id path to int", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data := new(dto.DeleteMessageDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	data.MessageID = messageID
+	data.UserID = userID
+
+	m, err := h.srv.DeleteMessage(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.messageError(w, err)
+		return
+	}
+
+	if data.Scope == service.DeleteForEveryone {
+		h.hub.NotifyMessageChange("message_deleted", m)
+	}
+
+	h.rspHandler.JSON(w, http.StatusOK, &dto.MessageDTO{
+		Status:  http.StatusOK,
+		Message: m,
+	})
+}
+
+// Maps the message service errors to the http response
+func (h *MessageHandlr) messageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrMessageNotExist):
+		h.rspHandler.Error(w, http.StatusNotFound, "message not found", nil)
+	case errors.Is(err, service.ErrNotMessageSender), errors.Is(err, service.ErrNotMessageParticipant):
+		h.rspHandler.Error(w, http.StatusForbidden, http.StatusText(http.StatusForbidden), nil)
+	case errors.Is(err, service.ErrEditWindowExpired):
+		h.rspHandler.Error(w, http.StatusForbidden, "message can no longer be edited", nil)
+	case errors.Is(err, service.ErrMessageDeleted):
+		h.rspHandler.Error(w, http.StatusGone, "message has been deleted", nil)
+	case errors.Is(err, service.ErrEmptyMessage):
+		h.rspHandler.Error(w, http.StatusBadRequest, "message content is empty", nil)
+	case errors.Is(err, service.ErrInvalidDeleteScope):
+		h.rspHandler.Error(w, http.StatusBadRequest, "scope must be either me or everyone", nil)
+	default:
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+	}
+}
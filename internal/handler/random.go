@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+const (
+	maxInterests   = 10
+	maxInterestLen = 32
+)
+
+type RandomHandlr struct {
+	rspHandler *ResponseHandler
+	srv        service.RandomService
+	hub        *Hub
+	logger     *slog.Logger
+}
+
+type RandomHandler interface {
+	Report(w http.ResponseWriter, r *http.Request)
+	Rate(w http.ResponseWriter, r *http.Request)
+}
+
+func NewRandomHandler(srv service.RandomService, hub *Hub, rspHandler *ResponseHandler, logger *slog.Logger) RandomHandler {
+	return &RandomHandlr{
+		srv:        srv,
+		hub:        hub,
+		rspHandler: rspHandler,
+		logger:     logger,
+	}
+}
+
+// Reports the random partner of a session, reporting the current session also ends the pair
+func (h *RandomHandlr) Report(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("report random: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("report random unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("report random: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	data := new(dto.RandomReportDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	sess, ok := h.hub.RandomSession(data.SessionID, userID)
+	if !ok {
+		h.rspHandler.Error(w, http.StatusNotFound, "random session not found", nil)
+		return
+	}
+
+	data.ReporterID = userID
+	data.ReportedID = sess.Partner(userID)
+	data.SessionID = sess.ID
+
+	rspData, err := h.srv.Report(ctx, data)
+	if err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.randomError(w, err)
+		return
+	}
+
+	h.hub.EndRandomSession(userID, sess.ID)
+
+	rspData.Status = http.StatusCreated
+	h.rspHandler.JSON(w, http.StatusCreated, rspData)
+}
+
+// Rates the random partner of a session with a thumbs up or down
+func (h *RandomHandlr) Rate(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.logger.Error("rate random: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	typeHeader := strings.Split(r.Header.Get("Content-Type"), ";")
+	if typeHeader[0] != "application/json" {
+		h.logger.Error("rate random unsupported media format", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("rate random: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	data := new(dto.RandomRatingDTO)
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil)
+		return
+	}
+
+	sess, ok := h.hub.RandomSession(data.SessionID, userID)
+	if !ok {
+		h.rspHandler.Error(w, http.StatusNotFound, "random session not found", nil)
+		return
+	}
+
+	data.RaterID = userID
+	data.RatedID = sess.Partner(userID)
+	data.SessionID = sess.ID
+
+	if err := h.srv.Rate(ctx, data); err != nil {
+		h.logger.Error(err.Error(), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.randomError(w, err)
+		return
+	}
+
+	h.rspHandler.JSON(w, http.StatusCreated, &dto.RandomServiceSuccessDTO{
+		Status:  http.StatusCreated,
+		Message: "Successfully rated the random partner",
+	})
+}
+
+func (h *RandomHandlr) randomError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidReportReason):
+		h.rspHandler.Error(w, http.StatusBadRequest, "reason must be one of spam, harassment, sexual_content, hate, underage or other", nil)
+	case errors.Is(err, service.ErrTranscriptTooLong):
+		h.rspHandler.Error(w, http.StatusBadRequest, "transcript is too long", nil)
+	case errors.Is(err, service.ErrInvalidRating):
+		h.rspHandler.Error(w, http.StatusBadRequest, "rating must be either up or down", nil)
+	case errors.Is(err, service.ErrAlreadyReported):
+		h.rspHandler.Error(w, http.StatusConflict, "session already reported", nil)
+	case errors.Is(err, service.ErrAlreadyRated):
+		h.rspHandler.Error(w, http.StatusConflict, "session already rated", nil)
+	default:
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+	}
+}
+
+// Lowercases and trims the interest tags, empty, too long and duplicate tags are dropped
+func normalizeInterests(raw []string) []string {
+	interests := make([]string, 0, min(len(raw), maxInterests))
+	seen := make(map[string]bool, len(raw))
+
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxInterestLen || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		interests = append(interests, tag)
+
+		if len(interests) == maxInterests {
+			break
+		}
+	}
+
+	return interests
+}
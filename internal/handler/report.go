@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+// Longest a report or rating waits on the saved sessions when the session is not known to the node
+const sessionLookupTimeout = 5 * time.Second
+
+/*
+Returns the random chat session if the user took part in it, an empty ID means the user's current session.
+
+Sessions are kept in memory by the nodes they started on, ended ones are forgotten after the session TTL.
+A session of another node, or one this node forgot over a restart, is read from the saved sessions instead.
+*/
+func (h *Hub) RandomSession(sessionID string, userID int) (*matchmaking.Session, bool) {
+	if sessionID == "" {
+		h.clientMU.RLock()
+		c, online := h.clients[strconv.Itoa(userID)]
+		h.clientMU.RUnlock()
+
+		if !online {
+			return h.savedCurrentSession(userID)
+		}
+
+		c.mu.RLock()
+		sessionID = c.session
+		c.mu.RUnlock()
+
+		if sessionID == "" {
+			return nil, false
+		}
+	}
+
+	if sess, ok := h.sessions.Get(sessionID, userID, time.Now()); ok {
+		return sess, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionLookupTimeout)
+	defer cancel()
+
+	s, err := h.randomSrv.Session(ctx, sessionID)
+	if err != nil {
+		if !errors.Is(err, service.ErrRandomSessionNotExist) {
+			h.logger.Error("random session: failed to load session", slog.String("error", err.Error()))
+		}
+
+		return nil, false
+	}
+
+	return h.savedSession(s, userID)
+}
+
+// The current session of a user connected to another node, the newest saved session when it has not ended
+func (h *Hub) savedCurrentSession(userID int) (*matchmaking.Session, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionLookupTimeout)
+	defer cancel()
+
+	sessions, err := h.randomSrv.UserSessions(ctx, userID, 1)
+	if err != nil {
+		h.logger.Error("random session: failed to load current session", slog.String("error", err.Error()))
+		return nil, false
+	}
+
+	if len(sessions) == 0 || sessions[0].EndedAt != nil {
+		return nil, false
+	}
+
+	return h.savedSession(sessions[0], userID)
+}
+
+// Turns a saved session into the one the hub keeps, applying the same checks
+func (h *Hub) savedSession(s *model.RandomSession, userID int) (*matchmaking.Session, bool) {
+	sess := &matchmaking.Session{
+		ID:        s.ID,
+		UserA:     s.UserA,
+		UserB:     s.UserB,
+		Shared:    s.Interests,
+		StartedAt: s.StartedAt,
+	}
+
+	if s.EndedAt != nil {
+		sess.EndedAt = *s.EndedAt
+	}
+
+	if !sess.Has(userID) || (!sess.EndedAt.IsZero() && time.Since(sess.EndedAt) >= h.randomCfg.SessionTTL) {
+		return nil, false
+	}
+
+	return sess, true
+}
+
+/*
+Reports the random partner of the session, the current pair when no session is given.
+
+Reporting the current pair also ends it, the partner is told the reporter left.
+*/
+func (h *Hub) ReportRandom(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	sess, ok := h.RandomSession(m.Session, m.From)
+	if !ok {
+		c.deliver(randomSessionError(), 0)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	rsp, err := h.randomSrv.Report(ctx, &dto.RandomReportDTO{
+		ReporterID: m.From,
+		ReportedID: sess.Partner(m.From),
+		SessionID:  sess.ID,
+		Reason:     m.Reason,
+		Transcript: m.Content,
+	})
+	if err != nil {
+		h.logger.Error("report random: failed to report partner", slog.String("error", err.Error()))
+		c.deliver(&Message{
+			Type:    "error",
+			Code:    randomErrorCode(err, "REPORT_FAILED"),
+			Session: sess.ID,
+			Content: "Failed to report the random partner",
+		}, 0)
+
+		return
+	}
+
+	c.deliver(&Message{
+		Type:    "report_received",
+		ID:      rsp.ReportID,
+		Session: sess.ID,
+	}, 0)
+
+	h.EndRandomSession(m.From, sess.ID)
+}
+
+// Ends the reported random pair of the user if the session is the current one, the partner is told the user left
+func (h *Hub) EndRandomSession(userID int, sessionID string) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(userID)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	c.mu.RLock()
+	pair, current := c.randomPair, c.session == sessionID
+	c.mu.RUnlock()
+
+	if pair != nil && current {
+		h.endRandomPair(c, pair, "LEFT", model.EndReport)
+	}
+}
+
+// Records the thumbs up or down the sender gave the random partner of the session
+func (h *Hub) RateRandom(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	sess, ok := h.RandomSession(m.Session, m.From)
+	if !ok {
+		c.deliver(randomSessionError(), 0)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := h.randomSrv.Rate(ctx, &dto.RandomRatingDTO{
+		RaterID:   m.From,
+		RatedID:   sess.Partner(m.From),
+		SessionID: sess.ID,
+		Rating:    m.Rating,
+	})
+	if err != nil {
+		h.logger.Error("rate random: failed to rate partner", slog.String("error", err.Error()))
+		c.deliver(&Message{
+			Type:    "error",
+			Code:    randomErrorCode(err, "RATING_FAILED"),
+			Session: sess.ID,
+			Content: "Failed to rate the random partner",
+		}, 0)
+
+		return
+	}
+
+	c.deliver(&Message{
+		Type:    "rating_received",
+		Session: sess.ID,
+	}, 0)
+}
+
+func randomSessionError() *Message {
+	return &Message{
+		Type:    "error",
+		Code:    "SESSION_NOT_EXIST",
+		Content: "The random chat session does not exist or has expired",
+	}
+}
+
+// Maps the random service errors to websocket error codes, fallback is used for unexpected errors
+func randomErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, service.ErrInvalidReportReason):
+		return "INVALID_REPORT_REASON"
+	case errors.Is(err, service.ErrTranscriptTooLong):
+		return "TRANSCRIPT_TOO_LONG"
+	case errors.Is(err, service.ErrAlreadyReported):
+		return "ALREADY_REPORTED"
+	case errors.Is(err, service.ErrInvalidRating):
+		return "INVALID_RATING"
+	case errors.Is(err, service.ErrAlreadyRated):
+		return "ALREADY_RATED"
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+)
+
+/*
+Records the consent of the sender to reveal themselves to their random partner.
+
+The partner is asked with an anonymous reveal_request, once both consented each of them gets a reveal with the
+public profile of the other. If both asked to befriend the friendship is saved as well.
+*/
+func (h *Hub) RevealRequest(m *Message) {
+	h.clientMU.RLock()
+	c, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	c.mu.RLock()
+	pair := c.randomPair
+	c.mu.RUnlock()
+
+	if pair == nil {
+		c.deliver(&Message{
+			Type:    "error",
+			Code:    "CONNECTION_NOT_EXIST",
+			Content: "You are not connected to a random user",
+		}, 0)
+
+		return
+	}
+
+	unlock := lockPair(c, pair)
+
+	// The pair may have ended since it was read
+	paired := c.randomPair == pair && pair.randomPair == c
+	repeated := c.revealRequested
+	if paired {
+		c.revealRequested = true
+		c.befriend = m.Befriend
+	}
+
+	mutual := paired && pair.revealRequested
+	befriend := c.befriend && pair.befriend
+
+	unlock()
+
+	switch {
+	case !paired:
+		return
+	case repeated:
+		// Already asked or already revealed, only the befriend choice is updated
+		return
+	case !mutual:
+		pair.deliver(&Message{
+			Type:     "reveal_request",
+			Befriend: m.Befriend,
+		}, 0)
+	default:
+		h.reveal(c, pair, befriend)
+	}
+}
+
+func (h *Hub) reveal(c, pair *Client, befriend bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	cProfile, err := h.randomSrv.PublicProfile(ctx, c.userID.Int())
+	if err == nil {
+		var pProfile *dto.PublicProfileDTO
+		if pProfile, err = h.randomSrv.PublicProfile(ctx, pair.userID.Int()); err == nil {
+			c.deliver(&Message{Type: "reveal", Profile: pProfile}, 0)
+			pair.deliver(&Message{Type: "reveal", Profile: cProfile}, 0)
+		}
+	}
+
+	if err != nil {
+		h.logger.Error("reveal: failed to retrieve public profile", slog.String("error", err.Error()))
+
+		failed := &Message{
+			Type:    "error",
+			Code:    "REVEAL_FAILED",
+			Content: "Failed to reveal the random pair",
+		}
+		c.deliver(failed, 0)
+		pair.deliver(failed, 0)
+
+		return
+	}
+
+	if !befriend {
+		return
+	}
+
+	result := &Message{Type: "friend_request_success"}
+	if err := h.frSrv.AddFriend(ctx, &dto.FriendshipDTO{
+		From: c.userID.Int(),
+		To:   pair.userID.Int(),
+	}); err != nil {
+		h.logger.Error("reveal: failed to save friendship", slog.String("error", err.Error()))
+		result = &Message{Type: "friend_request_failed"}
+	}
+
+	c.deliver(result, 0)
+	pair.deliver(result, 0)
+}
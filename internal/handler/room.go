@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+)
+
+// Group random chat rooms are formed with at least groupMinSize users and hold up to groupMaxSize
+const (
+	groupMinSize = 3
+	groupMaxSize = 4
+)
+
+// Random chat modes sent with join_random
+const (
+	randomModePair  = "pair"
+	randomModeGroup = "group"
+)
+
+var (
+	aliasAdjectives = []string{"Amber", "Blue", "Brave", "Calm", "Clever", "Cosmic", "Gentle", "Golden", "Lucky", "Misty", "Quiet", "Swift"}
+	aliasAnimals    = []string{"Badger", "Falcon", "Fox", "Heron", "Koala", "Lynx", "Otter", "Owl", "Panda", "Raven", "Tiger", "Wolf"}
+)
+
+/*
+An anonymous group random chat, members only know each other by the alias they got in the room.
+
+The room lock is taken before the lock of a member, never the other way around.
+The room stays open while at least two members are left.
+*/
+type randomRoom struct {
+	id      string
+	shared  []string
+	mu      sync.Mutex
+	members map[int]*roomMember // Keyed by user ID
+}
+
+type roomMember struct {
+	client *Client
+	alias  string
+}
+
+// Returns n distinct aliases, e.g. "Swift Otter"
+func roomAliases(n int) []string {
+	animals := rand.Perm(len(aliasAnimals))
+
+	aliases := make([]string, 0, n)
+	for i := range n {
+		aliases = append(aliases, aliasAdjectives[rand.IntN(len(aliasAdjectives))]+" "+aliasAnimals[animals[i%len(animals)]])
+	}
+
+	return aliases
+}
+
+// Returns the mode of a join_random, false if the mode is unknown
+func randomMode(mode string) (string, bool) {
+	switch mode {
+	case "", randomModePair:
+		return randomModePair, true
+	case randomModeGroup:
+		return randomModeGroup, true
+	default:
+		return "", false
+	}
+}
+
+// Returns the queue of the random chat mode, the caller must hold queueMU
+func (h *Hub) queueOf(mode string) matchmaking.Queue {
+	if mode == randomModeGroup {
+		return h.groups
+	}
+
+	return h.matcher
+}
+
+// Returns the match rates of the random chat mode, used to estimate the wait in queue_status
+func (h *Hub) waitsOf(mode string) *matchmaking.WaitEstimator {
+	if mode == randomModeGroup {
+		return h.groupWaits
+	}
+
+	return h.waits
+}
+
+func invalidModeError() *Message {
+	return &Message{
+		Type:    "error",
+		Code:    "INVALID_MODE",
+		Content: "The random chat mode has to be either pair or group",
+	}
+}
+
+/*
+Runs the group matcher and opens a room for every group it formed.
+
+Members that went offline in the meantime are left out, if too few are left the others are queued again.
+Groups with a member on another node are announced to the nodes, which open their side of the room on their own.
+The queueMU lock must be held by the caller.
+*/
+func (h *Hub) matchGroups() {
+	now := time.Now()
+	grouped := 0
+
+	var remote []*matchmaking.Group
+	for _, g := range h.groups.Match(now) {
+		if slices.ContainsFunc(g.Members, func(e *matchmaking.Entry) bool { return e.Node != h.node }) {
+			remote = append(remote, g)
+			grouped += len(g.Members)
+			continue
+		}
+
+		var clients []*Client
+		var online []*matchmaking.Entry
+
+		for _, e := range g.Members {
+			h.clientMU.RLock()
+			c, ok := h.clients[strconv.Itoa(e.UserID)]
+			h.clientMU.RUnlock()
+
+			if ok {
+				clients = append(clients, c)
+				online = append(online, e)
+			}
+		}
+
+		if len(clients) < groupMinSize {
+			for _, e := range online {
+				h.groups.Enqueue(e)
+			}
+
+			continue
+		}
+
+		h.openRoom(uuid.NewString(), clients, roomAliases(len(clients)), g.Shared)
+		grouped += len(clients)
+	}
+
+	h.groupWaits.Record(grouped, now)
+
+	if len(remote) > 0 {
+		go h.announceRooms(remote)
+	}
+}
+
+/*
+Puts the clients in a new room and tells each of them their alias and the aliases in the room.
+
+Remote clients stand in for the members on other nodes, their own nodes tell them.
+*/
+func (h *Hub) openRoom(id string, clients []*Client, aliases []string, shared []string) *randomRoom {
+	room := &randomRoom{
+		id:      id,
+		shared:  shared,
+		members: make(map[int]*roomMember, len(clients)),
+	}
+
+	for i, c := range clients {
+		room.members[c.userID.Int()] = &roomMember{client: c, alias: aliases[i]}
+
+		c.mu.Lock()
+		c.inQueue = false
+		c.room = room
+		c.resetReveal()
+		c.mu.Unlock()
+	}
+
+	h.logger.Info("a random room has been opened", slog.String("room", room.id), slog.Int("members", len(clients)))
+
+	for i, c := range clients {
+		if c.remote {
+			continue
+		}
+
+		c.deliver(&Message{
+			Type:      "room_joined",
+			To:        c.userID.Int(),
+			Content:   "You have been whirled into a room",
+			Session:   room.id,
+			Alias:     aliases[i],
+			Members:   aliases,
+			Interests: shared,
+		}, 0)
+	}
+
+	return room
+}
+
+// Fans a message_random out to the other members of the sender's room, the sender is shown by alias
+func (h *Hub) RoomMessage(m *Message) {
+	h.clientMU.RLock()
+	sender, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	sender.mu.RLock()
+	room := sender.room
+	sender.mu.RUnlock()
+
+	if room == nil {
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    "CONNECTION_NOT_EXIST",
+			Content: "You are not in a random room",
+		}, 0)
+
+		return
+	}
+
+	room.mu.Lock()
+	member, ok := room.members[m.From]
+	others := make([]*Client, 0, len(room.members))
+	for id, rm := range room.members {
+		if id != m.From {
+			others = append(others, rm.client)
+		}
+	}
+	room.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	rm := &Message{
+		Type:      "message_random",
+		Content:   m.Content,
+		Alias:     member.alias,
+		Session:   room.id,
+		Timestamp: time.Now(),
+	}
+
+	for _, c := range others {
+		c.deliver(rm, 0)
+	}
+}
+
+/*
+Takes the client out of its room and tells the others who left with the reason code.
+
+A room with members on other nodes is kept by each of those nodes, they are told to take the client out as well.
+*/
+func (h *Hub) leaveRoom(c *Client, room *randomRoom, code string) {
+	if remote, ok := h.dropMember(room, c.userID.Int(), code); ok {
+		h.announceRoomLeave(room.id, c.userID.Int(), code, remote)
+	}
+}
+
+/*
+Takes the user out of the room and tells the members on this node who left, returns the members on other nodes.
+
+When fewer than two members would be left the room is closed and the last member gets a room_closed.
+Returns false if the user was not in the room.
+*/
+func (h *Hub) dropMember(room *randomRoom, userID int, code string) ([]int, bool) {
+	room.mu.Lock()
+	member, ok := room.members[userID]
+	if !ok {
+		room.mu.Unlock()
+		return nil, false
+	}
+
+	delete(room.members, userID)
+
+	member.client.mu.Lock()
+	if member.client.room == room {
+		member.client.room = nil
+	}
+	member.client.mu.Unlock()
+
+	var others []*Client
+	var remote []int
+	for id, rm := range room.members {
+		if rm.client.remote {
+			remote = append(remote, id)
+		} else {
+			others = append(others, rm.client)
+		}
+	}
+
+	closed := len(room.members) < 2
+	if closed {
+		for id, rm := range room.members {
+			rm.client.mu.Lock()
+			if rm.client.room == room {
+				rm.client.room = nil
+			}
+			rm.client.mu.Unlock()
+
+			delete(room.members, id)
+		}
+	}
+	room.mu.Unlock()
+
+	for _, o := range others {
+		if closed {
+			o.deliver(&Message{
+				Type:    "notification",
+				Code:    code,
+				Content: "random_room_closed",
+				Alias:   member.alias,
+				Session: room.id,
+			}, 0)
+
+			continue
+		}
+
+		o.deliver(&Message{
+			Type:    "notification",
+			Code:    code,
+			Content: "random_room_left",
+			Alias:   member.alias,
+			Session: room.id,
+		}, 0)
+	}
+
+	return remote, true
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+type RTCHandler interface {
+	RetrieveConfig(w http.ResponseWriter, r *http.Request)
+}
+
+type RTCHandlr struct {
+	logger     *slog.Logger
+	rspHandler *ResponseHandler
+	srv        service.SignalService
+}
+
+func NewRTCHandler(srv service.SignalService, rspHandler *ResponseHandler, logger *slog.Logger) RTCHandler {
+	return &RTCHandlr{
+		logger:     logger,
+		rspHandler: rspHandler,
+		srv:        srv,
+	}
+}
+
+// Returns the STUN and TURN servers the client sets up its peer connections with
+func (h *RTCHandlr) RetrieveConfig(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.logger.Error("retrieve rtc config: invalid http method", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), nil)
+		return
+	}
+
+	userID, ok := ctx.Value("userID").(int)
+	if !ok {
+		h.logger.Error("retrieve rtc config: failed to get the userID value out of ctx", slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+		h.rspHandler.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+
+	rspData := h.srv.IceServers(userID, time.Now())
+	rspData.Status = http.StatusOK
+
+	h.rspHandler.JSON(w, http.StatusOK, rspData)
+}
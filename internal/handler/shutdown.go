@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// Clients are told to reconnect at a random moment within this spread, so they do not all hit the other nodes at once
+	reconnectSpread = 10 * time.Second
+
+	// How often Shutdown checks whether the queues are drained and the clients are gone
+	drainPollInterval = 50 * time.Millisecond
+)
+
+// Reports if the hub is shutting down, new websockets are refused then
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
+
+/*
+Drains the hub and stops Run, returns the context error if the deadline passed first.
+
+Shutting down goes in steps:
+ 1. New websockets and messages from the connected clients are refused
+ 2. Every client gets a server_shutdown with the seconds to wait before reconnecting in retry_after
+ 3. The messages already received are handled, which stores them in the database
+ 4. Once their queues are written the sockets are closed with a going away close code
+ 5. After the clients are disconnected, which ends their random chats, Run stops
+
+Whatever is left when the deadline passes is dropped, the steps still run so the sockets are closed.
+*/
+func (h *Hub) Shutdown(ctx context.Context) error {
+	if h.draining.Swap(true) {
+		return nil
+	}
+
+	h.clientMU.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.clientMU.RUnlock()
+
+	h.logger.Info("hub: shutting down", slog.Int("clients", len(clients)))
+
+	for _, c := range clients {
+		c.deliver(shutdownNotice(), 0)
+	}
+
+	// Messages read before the clients were refused may still be on their way into the channel
+	waitFor(ctx, func() bool { return len(h.messages) == 0 })
+
+	for _, c := range clients {
+		waitFor(ctx, func() bool { return c.drained() })
+		c.closeSocket(closedShutdown)
+	}
+
+	waitFor(ctx, func() bool {
+		h.clientMU.RLock()
+		defer h.clientMU.RUnlock()
+
+		return len(h.clients) == 0
+	})
+
+	close(h.quit)
+
+	done := make(chan struct{})
+	go func() {
+		<-h.stopped
+		h.work.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		h.logger.Info("hub: shut down")
+		return nil
+	case <-ctx.Done():
+		h.logger.Error("hub: shutdown deadline passed with work left", slog.String("error", ctx.Err().Error()))
+		return ctx.Err()
+	}
+}
+
+// Runs fn on its own goroutine, tracked so Shutdown can wait for it
+func (h *Hub) spawn(fn func()) {
+	h.work.Add(1)
+	go func() {
+		defer h.work.Done()
+		fn()
+	}()
+}
+
+// Reports if everything queued for the client was written
+func (c *Client) drained() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return !c.isConnected || c.queued.Load() == 0
+}
+
+// Polls the condition until it holds or the context is done
+func waitFor(ctx context.Context, cond func() bool) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !cond() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func shutdownNotice() *Message {
+	return &Message{
+		Type:       "server_shutdown",
+		Code:       "SERVER_SHUTDOWN",
+		Content:    "The server is shutting down, reconnect after retry_after seconds",
+		RetryAfter: 1 + rand.IntN(int(reconnectSpread/time.Second)),
+	}
+}
+
+func shuttingDownError() *Message {
+	return &Message{
+		Type:    "error",
+		Code:    "SERVER_SHUTTING_DOWN",
+		Content: "The server is shutting down, reconnect to keep chatting",
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+// How long a signaling message waits for room in the peer's send buffer, a lost offer or answer breaks the call
+const signalSendTimeout = 2 * time.Second
+
+/*
+Relays WebRTC signaling (rtc_offer, rtc_answer, rtc_ice and rtc_hangup) to the peer.
+
+Without a receiver the message goes to the random pair and stays anonymous, otherwise the receiver
+has to be a friend of the sender. Only the signaling passes through the server, media is peer to peer.
+*/
+func (h *Hub) RelaySignal(m *Message) {
+	h.clientMU.RLock()
+	sender, online := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	if !online {
+		return
+	}
+
+	err := h.signalSrv.Validate(&dto.SignalDTO{
+		Type:      m.Type,
+		SDP:       m.SDP,
+		Candidate: m.Candidate,
+	})
+	if err != nil {
+		code := "INVALID_SIGNAL"
+		if errors.Is(err, service.ErrSignalTooLarge) {
+			code = "SIGNAL_TOO_LARGE"
+		}
+
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    code,
+			To:      m.To,
+			Content: "The signaling message is invalid",
+		}, 0)
+
+		return
+	}
+
+	rm := &Message{
+		Type:      m.Type,
+		SDP:       m.SDP,
+		Candidate: m.Candidate,
+		Timestamp: time.Now(),
+	}
+
+	if m.To == 0 {
+		sender.mu.RLock()
+		pair := sender.randomPair
+		sender.mu.RUnlock()
+
+		if pair == nil {
+			sender.deliver(&Message{
+				Type:    "error",
+				Code:    "CONNECTION_NOT_EXIST",
+				Content: "You are not connected to a random user",
+			}, 0)
+
+			return
+		}
+
+		rm.To = pair.userID.Int()
+		if !pair.deliver(rm, signalSendTimeout) {
+			h.logger.Info("relay signal: random pair did not take the message", slog.String("type", m.Type))
+		}
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	friends, err := h.frSrv.AreFriends(ctx, &dto.FriendshipDTO{
+		From: m.From,
+		To:   m.To,
+	})
+	if err != nil {
+		h.logger.Error("relay signal: failed to check friendship", slog.String("error", err.Error()))
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    "SIGNAL_FAILED",
+			To:      m.To,
+			Content: "Failed to relay the signaling message",
+		}, 0)
+
+		return
+	}
+
+	if !friends {
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    "NOT_FRIENDS",
+			To:      m.To,
+			Content: "Calls are only possible between friends",
+		}, 0)
+
+		return
+	}
+
+	// Only known when there are no other nodes, otherwise the receiver may be connected to one of them
+	receiver := h.reach(m.To)
+	if receiver == nil {
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    "PEER_OFFLINE",
+			To:      m.To,
+			Content: "The user is offline",
+		}, 0)
+
+		return
+	}
+
+	rm.From = m.From
+	rm.To = m.To
+	if !receiver.deliver(rm, signalSendTimeout) {
+		h.logger.Info("relay signal: receiver did not take the message", slog.String("type", m.Type))
+	}
+}
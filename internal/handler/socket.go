@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+Counters of the websocket connections, published under "websocket" on the expvar page.
+
+Every closed connection is counted once under the reason it was closed for. Reaped connections are the ones
+the server gave up on, either because the client stopped answering (pong timeout) or stopped reading (write timeout
+or queues full for too long). Messages dropped because the queues of a client were full are counted as well.
+*/
+var socketMetrics = expvar.NewMap("websocket")
+
+// Reasons a connection was closed for, the keys of the counters
+const (
+	closedByClient     = "closed_by_client"
+	closedByServer     = "closed_by_server"
+	closedInvalid      = "closed_invalid_message"
+	closedShutdown     = "closed_shutdown"
+	reapedPongTimeout  = "reaped_pong_timeout"
+	reapedWriteTimeout = "reaped_write_timeout"
+	reapedReadLimit    = "reaped_read_limit"
+	reapedSlowConsumer = "reaped_slow_consumer"
+)
+
+// Close frame sent for each reason, no frame is sent to a client that already closed
+var closeFrames = map[string]struct {
+	code int
+	text string
+}{
+	closedByServer:     {websocket.CloseNormalClosure, ""},
+	closedInvalid:      {websocket.CloseUnsupportedData, "invalid message"},
+	closedShutdown:     {websocket.CloseGoingAway, "server shutdown"},
+	reapedPongTimeout:  {websocket.CloseGoingAway, "pong timeout"},
+	reapedWriteTimeout: {websocket.CloseGoingAway, "write timeout"},
+	reapedReadLimit:    {websocket.CloseMessageTooBig, "message too large"},
+	reapedSlowConsumer: {websocket.CloseTryAgainLater, "slow consumer"},
+}
+
+/*
+Closes the websocket of the client for the reason, only the first call does anything.
+
+The close frame is a control message, which gorilla allows next to the writes of the write pump.
+*/
+func (c *Client) closeSocket(reason string) {
+	c.closeOnce.Do(func() {
+		socketMetrics.Add(reason, 1)
+		socketMetrics.Add("open", -1)
+
+		if frame, ok := closeFrames[reason]; ok {
+			deadline := time.Now().Add(c.socket.WriteTimeout)
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(frame.code, frame.text), deadline)
+		}
+
+		if reason != closedByClient && reason != closedByServer && reason != closedShutdown {
+			c.logger.Info("socket: closing connection", slog.String("user_id", c.userID.String()), slog.String("reason", reason))
+		}
+
+		c.ws.Close()
+	})
+}
+
+// Tells why reading from the websocket failed
+func readCloseReason(err error) string {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		return reapedReadLimit
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return reapedPongTimeout
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		// ReadJSON turns an empty message into an unexpected EOF
+		return closedInvalid
+	default:
+		return closedByClient
+	}
+}
+
+// Tells why writing to the websocket failed
+func writeCloseReason(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return reapedWriteTimeout
+	}
+
+	return closedByClient
+}
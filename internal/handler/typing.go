@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+)
+
+const (
+	// Minimum time between two relayed typing_start from the same sender to the same receiver
+	typingThrottle = 2 * time.Second
+
+	// A typing indicator is stopped on behalf of the sender when no typing_start or typing_stop arrives within this time
+	typingTimeout = 6 * time.Second
+)
+
+type typingState struct {
+	lastRelayed time.Time
+	anonymous   bool // Random chat indicators are relayed without the sender ID
+	expiry      *time.Timer
+}
+
+func typingKey(from, to int) string {
+	return strconv.Itoa(from) + ":" + strconv.Itoa(to)
+}
+
+/*
+Relays typing_start and typing_stop to the receiver.
+
+The receiver has to be the random pair or a chat peer of the sender, a friend or someone the sender exchanged
+direct messages with. Otherwise anyone could learn who is online by sending typing indicators.
+Repeated typing_start within the throttle window only extend the indicator instead of being relayed again.
+An indicator with no typing_stop expires after typingTimeout and the receiver gets a typing_stop.
+*/
+func (h *Hub) RelayTyping(m *Message) {
+	h.clientMU.RLock()
+	sender, sOnline := h.clients[strconv.Itoa(m.From)]
+	h.clientMU.RUnlock()
+
+	key := typingKey(m.From, m.To)
+
+	// Indicators sent to the random pair stays anonymous just like message_random
+	var receiver *Client
+	anonymous := false
+	if sOnline {
+		sender.mu.RLock()
+		if pair := sender.randomPair; pair != nil && pair.userID.Int() == m.To {
+			receiver, anonymous = pair, true
+		}
+		sender.mu.RUnlock()
+
+		if receiver == nil && h.mayType(sender, m, key) {
+			receiver = h.reach(m.To)
+		}
+	}
+
+	if receiver == nil {
+		h.clearTyping(m.From, m.To)
+		return
+	}
+
+	h.typingMU.Lock()
+	defer h.typingMU.Unlock()
+
+	st := h.typing[key]
+
+	switch m.Type {
+	case "typing_start":
+		now := time.Now()
+		if st != nil {
+			st.expiry.Reset(typingTimeout)
+
+			if now.Sub(st.lastRelayed) < typingThrottle {
+				return
+			}
+
+			st.lastRelayed = now
+		} else {
+			st = &typingState{
+				lastRelayed: now,
+				anonymous:   anonymous,
+			}
+			st.expiry = time.AfterFunc(typingTimeout, func() {
+				h.expireTyping(key, st, receiver, m.From)
+			})
+			h.typing[key] = st
+		}
+
+	case "typing_stop":
+		if st == nil {
+			// The receiver has no indicator showing
+			return
+		}
+
+		st.expiry.Stop()
+		delete(h.typing, key)
+	}
+
+	rm := &Message{
+		Type:      m.Type,
+		From:      m.From,
+		To:        m.To,
+		Timestamp: time.Now(),
+	}
+	if anonymous {
+		rm.From = 0
+	}
+
+	receiver.deliver(rm, 0)
+}
+
+/*
+Reports if the sender may show a typing indicator to the receiver of m, which is not its random pair.
+
+The peers are checked once per indicator, when it starts. A typing_stop without an indicator has nothing to stop.
+*/
+func (h *Hub) mayType(sender *Client, m *Message, key string) bool {
+	h.typingMU.Lock()
+	_, active := h.typing[key]
+	h.typingMU.Unlock()
+
+	if active {
+		return true
+	}
+
+	if m.Type != "typing_start" {
+		return false
+	}
+
+	peers, err := h.chatPeers(m.From, m.To)
+	if err != nil {
+		h.logger.Error("typing: failed to check chat peers", slog.String("error", err.Error()))
+		return false
+	}
+
+	if !peers {
+		sender.deliver(&Message{
+			Type:    "error",
+			Code:    "NOT_CHAT_PEER",
+			To:      m.To,
+			Content: "Typing indicators are only sent to friends and users you have chatted with",
+		}, 0)
+	}
+
+	return peers
+}
+
+// Reports if the two users are friends or have a direct message conversation, users that blocked each other never are
+func (h *Hub) chatPeers(a, b int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	fr := &dto.FriendshipDTO{From: a, To: b}
+
+	// A relationship that is not a friendship is a block
+	related, err := h.frSrv.CheckStatus(ctx, fr)
+	if err != nil {
+		return false, err
+	}
+
+	if related {
+		return h.frSrv.AreFriends(ctx, fr)
+	}
+
+	return h.msgSrv.HasConversation(ctx, a, b)
+}
+
+func (h *Hub) expireTyping(key string, st *typingState, receiver *Client, from int) {
+	h.typingMU.Lock()
+	if h.typing[key] != st {
+		// The indicator was already stopped or replaced
+		h.typingMU.Unlock()
+		return
+	}
+	delete(h.typing, key)
+	h.typingMU.Unlock()
+
+	h.logger.Info("typing: indicator expired", slog.String("key", key))
+
+	rm := &Message{
+		Type:      "typing_stop",
+		From:      from,
+		To:        receiver.userID.Int(),
+		Timestamp: time.Now(),
+	}
+	if st.anonymous {
+		rm.From = 0
+	}
+
+	receiver.deliver(rm, 0)
+}
+
+/*
+Drops the typing state between the sender and the receiver without notifying anyone.
+
+Used when a message was sent, since receiving the message already ends the indicator on the client.
+*/
+func (h *Hub) clearTyping(from, to int) {
+	key := typingKey(from, to)
+
+	h.typingMU.Lock()
+	if st, ok := h.typing[key]; ok {
+		st.expiry.Stop()
+		delete(h.typing, key)
+	}
+	h.typingMU.Unlock()
+}
@@ -0,0 +1,81 @@
+package matchmaking
+
+import "time"
+
+/*
+Serves the queue in order, the user that waited the longest picks a partner first.
+
+The partner sharing the most interests wins, ties go to whoever queued first. Users without shared
+interests are only paired once both of them waited the interest wait, users without interests never wait.
+*/
+type FIFO struct {
+	queue
+}
+
+func NewFIFO(cfg Config) Matcher {
+	return &FIFO{
+		queue: queue{cfg: cfg},
+	}
+}
+
+func (m *FIFO) Match(now time.Time) []*Pair {
+	m.startMatch()
+
+	var pairs []*Pair
+
+	for i := 0; i < len(m.entries); i++ {
+		e := m.entries[i]
+
+		j, shared := m.pickPartner(i, now)
+		if j < 0 {
+			continue
+		}
+
+		partner := m.entries[j]
+
+		// j is always after i so it is removed first to keep i in place
+		m.entries = append(m.entries[:j], m.entries[j+1:]...)
+		m.entries = append(m.entries[:i], m.entries[i+1:]...)
+		i--
+
+		pairs = append(pairs, &Pair{A: e, B: partner, Shared: shared})
+	}
+
+	return pairs
+}
+
+// Picks the partner of the entry at index i out of the entries queued after it, returns -1 if there is none
+func (m *FIFO) pickPartner(i int, now time.Time) (int, []string) {
+	e := m.entries[i]
+	waited := doneWaiting(e, now, m.cfg.InterestWait)
+
+	best := -1
+	var bestShared []string
+
+	for j := i + 1; j < len(m.entries); j++ {
+		cand := m.entries[j]
+
+		shared := SharedInterests(e.Interests, cand.Interests)
+		if len(shared) == 0 && (!waited || !doneWaiting(cand, now, m.cfg.InterestWait)) {
+			continue
+		}
+
+		// Only a partner with more shared interests can beat the current best
+		if best >= 0 && len(shared) <= len(bestShared) {
+			continue
+		}
+
+		if !m.acceptable(e, cand, now) {
+			continue
+		}
+
+		best, bestShared = j, shared
+	}
+
+	return best, bestShared
+}
+
+// Reports if the entry is done waiting for a partner with shared interests
+func doneWaiting(e *Entry, now time.Time, wait time.Duration) bool {
+	return len(e.Interests) == 0 || now.Sub(e.QueuedAt) >= wait
+}
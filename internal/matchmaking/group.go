@@ -0,0 +1,116 @@
+package matchmaking
+
+import (
+	"slices"
+	"time"
+)
+
+// Users the group matcher put together in a room
+type Group struct {
+	Members []*Entry // In queue order
+	Shared  []string // Interests every member has
+}
+
+/*
+Puts the users of the queue together in rooms of a few users.
+
+The user that waited the longest seeds a room, which is filled first with users sharing the room's interests
+and then, once everyone involved waited the interest wait, with anyone. Every member has to be acceptable
+to every other member. A room is only formed once it reaches the minimum size and never grows past the maximum.
+*/
+type GroupMatcher struct {
+	queue
+	minSize int
+	maxSize int
+}
+
+func NewGroupMatcher(cfg Config, minSize, maxSize int) *GroupMatcher {
+	return &GroupMatcher{
+		queue:   queue{cfg: cfg},
+		minSize: minSize,
+		maxSize: max(minSize, maxSize),
+	}
+}
+
+// Forms every room it can and removes its members from the queue
+func (m *GroupMatcher) Match(now time.Time) []*Group {
+	m.startMatch()
+
+	taken := make([]bool, len(m.entries))
+	var groups []*Group
+
+	for i := range m.entries {
+		if taken[i] {
+			continue
+		}
+
+		members, shared := m.fill(i, taken, now)
+		if len(members) < m.minSize {
+			continue
+		}
+
+		g := &Group{Shared: shared}
+		for _, j := range members {
+			taken[j] = true
+			g.Members = append(g.Members, m.entries[j])
+		}
+
+		groups = append(groups, g)
+	}
+
+	remaining := m.entries[:0]
+	for i, e := range m.entries {
+		if !taken[i] {
+			remaining = append(remaining, e)
+		}
+	}
+	m.entries = remaining
+
+	return groups
+}
+
+// Builds the room seeded by the entry at index i out of the entries that are not taken, returns their indexes
+func (m *GroupMatcher) fill(i int, taken []bool, now time.Time) ([]int, []string) {
+	members := []int{i}
+	shared := m.entries[i].Interests
+	waited := doneWaiting(m.entries[i], now, m.cfg.InterestWait)
+
+	// The first pass only takes users sharing the room's interests, the second anyone once the wait is over
+	for pass := 0; pass < 2 && len(members) < m.maxSize; pass++ {
+		for j := i + 1; j < len(m.entries) && len(members) < m.maxSize; j++ {
+			cand := m.entries[j]
+			if taken[j] || slices.Contains(members, j) {
+				continue
+			}
+
+			overlap := SharedInterests(shared, cand.Interests)
+			if pass == 0 && len(overlap) == 0 {
+				continue
+			}
+
+			if pass == 1 && (!waited || !doneWaiting(cand, now, m.cfg.InterestWait)) {
+				continue
+			}
+
+			if !m.acceptableToAll(members, cand, now) {
+				continue
+			}
+
+			members = append(members, j)
+			shared = overlap
+			waited = waited && doneWaiting(cand, now, m.cfg.InterestWait)
+		}
+	}
+
+	return members, shared
+}
+
+func (m *GroupMatcher) acceptableToAll(members []int, cand *Entry, now time.Time) bool {
+	for _, j := range members {
+		if !m.acceptable(m.entries[j], cand, now) {
+			return false
+		}
+	}
+
+	return true
+}
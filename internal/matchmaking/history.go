@@ -0,0 +1,112 @@
+package matchmaking
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+// Remembers who was paired with whom so matchers can avoid pairing the same users again
+type History interface {
+	Record(a, b int, at time.Time)
+	// Reports if the two users were paired within the window before now
+	Recent(a, b int, now time.Time) bool
+}
+
+// Keeps the pairings in memory, pairings older than the window are forgotten
+type MemoryHistory struct {
+	mu        sync.Mutex
+	window    time.Duration
+	pairs     map[[2]int]time.Time
+	lastPrune time.Time
+}
+
+func NewMemoryHistory(window time.Duration) *MemoryHistory {
+	return &MemoryHistory{
+		window: window,
+		pairs:  make(map[[2]int]time.Time),
+	}
+}
+
+func (h *MemoryHistory) Record(a, b int, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := pairKey(a, b)
+	if prev, ok := h.pairs[key]; !ok || at.After(prev) {
+		h.pairs[key] = at
+	}
+
+	// Expired pairings are dropped at most once per window so recording stays cheap
+	if at.Sub(h.lastPrune) >= h.window {
+		for k, matchedAt := range h.pairs {
+			if at.Sub(matchedAt) >= h.window {
+				delete(h.pairs, k)
+			}
+		}
+
+		h.lastPrune = at
+	}
+}
+
+func (h *MemoryHistory) Recent(a, b int, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	matchedAt, ok := h.pairs[pairKey(a, b)]
+	return ok && now.Sub(matchedAt) < h.window
+}
+
+func (h *MemoryHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.pairs)
+}
+
+// The same key no matter the order of the users
+func pairKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+
+	return [2]int{a, b}
+}
+
+// Where a persisted history loads its pairings from, the random sessions saved when the chats started
+type HistoryStore interface {
+	RecentSessions(ctx context.Context, since time.Time) ([]*model.RandomSession, error)
+}
+
+/*
+A history that survives restarts, the pairings of the last window are loaded from the saved sessions.
+
+Nothing is written through, every pairing is a session that is saved already. Reads are served from memory.
+*/
+type PersistentHistory struct {
+	*MemoryHistory
+	store HistoryStore
+}
+
+func NewPersistentHistory(mem *MemoryHistory, store HistoryStore) *PersistentHistory {
+	return &PersistentHistory{
+		MemoryHistory: mem,
+		store:         store,
+	}
+}
+
+// Loads the pairings of the last window from the store
+func (h *PersistentHistory) Load(ctx context.Context, now time.Time) error {
+	sessions, err := h.store.RecentSessions(ctx, now.Add(-h.window))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		h.MemoryHistory.Record(s.UserA, s.UserB, s.StartedAt)
+	}
+
+	return nil
+}
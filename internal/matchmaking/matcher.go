@@ -0,0 +1,176 @@
+/*
+Package matchmaking pairs the users waiting in the random chat queue.
+
+Matchers only keep track of the queue and decide the pairs, delivering the pairing is left to the caller.
+This keeps the matching logic free of websockets so it can be unit tested and simulated.
+*/
+package matchmaking
+
+import (
+	"slices"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model/dto"
+)
+
+// A user waiting in the random queue
+type Entry struct {
+	UserID    int
+	Interests []string
+	Profile   *dto.RandomProfileDTO
+	QueuedAt  time.Time
+
+	// Node holding the connection of the user when the queue is shared between nodes
+	Node string
+
+	// Users the user is friends with or blocked, loaded on join so pairing does not query
+	Related map[int]bool
+}
+
+// Two users the matcher decided to pair, A is the one that queued first
+type Pair struct {
+	A, B   *Entry
+	Shared []string // Interests both users have
+}
+
+/*
+Decides if the two users may be paired at all, e.g. users that are friends or blocked each other should not.
+
+Matchers call it before pairing, it is never called with the same user on both sides.
+*/
+type AllowFunc func(a, b *Entry) bool
+
+// Settings shared by the matchers
+type Config struct {
+	Allow AllowFunc // Nil allows every pair
+
+	// How long users with interests wait for a partner sharing one before being paired with anyone
+	InterestWait time.Duration
+
+	// Pairings to avoid repeating, nil disables it. Matchers only read it, a pair is recorded by the caller once
+	// both users were actually paired
+	History History
+	// Recent partners are paired again only when the queue has at most this many users and both users
+	// waited the interest wait, so a thin queue does not leave them waiting forever
+	ThinQueue int
+}
+
+// The waiting side of a matcher, shared by the pair and the group matchers
+type Queue interface {
+	// Adds the user to the queue, returns false if the user is already queued
+	Enqueue(e *Entry) bool
+	// Removes the user from the queue, returns false if the user was not queued
+	Dequeue(userID int) bool
+	// Number of users waiting in the queue
+	Len() int
+	// Users waiting in the queue, the longest waiting first
+	Entries() []*Entry
+	// Removes the users that queued before the cutoff and returns them
+	Expire(cutoff time.Time) []*Entry
+}
+
+type Matcher interface {
+	Queue
+	// Pairs every user that has an acceptable partner and removes them from the queue
+	Match(now time.Time) []*Pair
+}
+
+// Queue bookkeeping shared by the matchers, entries are kept in the order they were queued
+type queue struct {
+	entries []*Entry
+	cfg     Config
+	thin    bool // Set when a match starts, see Config.ThinQueue
+}
+
+func (q *queue) Enqueue(e *Entry) bool {
+	if q.index(e.UserID) >= 0 {
+		return false
+	}
+
+	q.entries = append(q.entries, e)
+	return true
+}
+
+func (q *queue) Dequeue(userID int) bool {
+	i := q.index(userID)
+	if i < 0 {
+		return false
+	}
+
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	return true
+}
+
+func (q *queue) Len() int {
+	return len(q.entries)
+}
+
+func (q *queue) Entries() []*Entry {
+	entries := slices.Clone(q.entries)
+
+	// Users queued again after their partner went offline keep their place
+	slices.SortStableFunc(entries, func(a, b *Entry) int {
+		return a.QueuedAt.Compare(b.QueuedAt)
+	})
+
+	return entries
+}
+
+func (q *queue) Expire(cutoff time.Time) []*Entry {
+	var expired []*Entry
+
+	remaining := q.entries[:0]
+	for _, e := range q.entries {
+		if e.QueuedAt.Before(cutoff) {
+			expired = append(expired, e)
+		} else {
+			remaining = append(remaining, e)
+		}
+	}
+	q.entries = remaining
+
+	return expired
+}
+
+// Called before matching with the current time
+func (q *queue) startMatch() {
+	q.thin = len(q.entries) <= q.cfg.ThinQueue
+}
+
+// Applies the allow func and the recent partner rule, the history is checked last since the allow func may be costly
+func (q *queue) acceptable(a, b *Entry, now time.Time) bool {
+	if q.cfg.History != nil && q.cfg.History.Recent(a.UserID, b.UserID, now) {
+		waited := now.Sub(a.QueuedAt) >= q.cfg.InterestWait && now.Sub(b.QueuedAt) >= q.cfg.InterestWait
+		if !q.thin || !waited {
+			return false
+		}
+	}
+
+	return q.cfg.Allow == nil || q.cfg.Allow(a, b)
+}
+
+func (q *queue) index(userID int) int {
+	for i, e := range q.entries {
+		if e.UserID == userID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns the interests found in both lists, in the order of the first list
+func SharedInterests(a, b []string) []string {
+	var shared []string
+
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				shared = append(shared, x)
+				break
+			}
+		}
+	}
+
+	return shared
+}
@@ -0,0 +1,129 @@
+package matchmaking
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+/*
+Rates how good a pairing of the two users is, higher is better.
+
+Returning false means the users should not be paired right now.
+*/
+type ScoreFunc func(a, b *Entry, now time.Time) (score float64, ok bool)
+
+/*
+Pairs the users by score instead of queue order.
+
+Every acceptable pairing is scored and the best ones are taken first, a user is part of at most one pair.
+Equal scores go to the pair with the user that waited the longest.
+*/
+type Scored struct {
+	queue
+	score ScoreFunc
+}
+
+func NewScored(cfg Config, score ScoreFunc) Matcher {
+	return &Scored{
+		queue: queue{cfg: cfg},
+		score: score,
+	}
+}
+
+func (m *Scored) Match(now time.Time) []*Pair {
+	m.startMatch()
+
+	type candidate struct {
+		i, j  int
+		score float64
+	}
+
+	var candidates []candidate
+	for i := 0; i < len(m.entries); i++ {
+		for j := i + 1; j < len(m.entries); j++ {
+			score, ok := m.score(m.entries[i], m.entries[j], now)
+			if !ok {
+				continue
+			}
+
+			candidates = append(candidates, candidate{i: i, j: j, score: score})
+		}
+	}
+
+	// Candidates are generated in queue order, the stable sort keeps that order for equal scores
+	sort.SliceStable(candidates, func(x, y int) bool {
+		return candidates[x].score > candidates[y].score
+	})
+
+	taken := make([]bool, len(m.entries))
+	var pairs []*Pair
+
+	for _, cand := range candidates {
+		if taken[cand.i] || taken[cand.j] {
+			continue
+		}
+
+		a, b := m.entries[cand.i], m.entries[cand.j]
+
+		// Checked last since it may be costly, e.g. a database lookup
+		if !m.acceptable(a, b, now) {
+			continue
+		}
+
+		taken[cand.i], taken[cand.j] = true, true
+		pairs = append(pairs, &Pair{A: a, B: b, Shared: SharedInterests(a.Interests, b.Interests)})
+	}
+
+	remaining := m.entries[:0]
+	for i, e := range m.entries {
+		if !taken[i] {
+			remaining = append(remaining, e)
+		}
+	}
+	m.entries = remaining
+
+	return pairs
+}
+
+/*
+Scores pairs by shared interests plus how long the users waited, in seconds times the wait weight.
+
+Pairs without shared interests are only acceptable once both users waited the interest wait.
+*/
+func InterestScore(interestWait time.Duration, waitWeight float64) ScoreFunc {
+	return func(a, b *Entry, now time.Time) (float64, bool) {
+		shared := len(SharedInterests(a.Interests, b.Interests))
+		if shared == 0 && (!doneWaiting(a, now, interestWait) || !doneWaiting(b, now, interestWait)) {
+			return 0, false
+		}
+
+		waited := now.Sub(a.QueuedAt) + now.Sub(b.QueuedAt)
+		return float64(shared) + waited.Seconds()*waitWeight, true
+	}
+}
+
+/*
+Adds the reputation of the users to the score, pairs with a similar reputation score higher.
+
+This keeps users with a poor reputation away from the well rated ones. Entries without a profile count
+as an average reputation.
+*/
+func ReputationScore(score ScoreFunc, weight float64) ScoreFunc {
+	return func(a, b *Entry, now time.Time) (float64, bool) {
+		s, ok := score(a, b, now)
+		if !ok {
+			return 0, false
+		}
+
+		return s + weight*(1-math.Abs(reputation(a)-reputation(b))), true
+	}
+}
+
+func reputation(e *Entry) float64 {
+	if e.Profile == nil {
+		return 0.5
+	}
+
+	return e.Profile.Reputation
+}
@@ -0,0 +1,127 @@
+package matchmaking
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A random chat between two users, the ID is what clients use to refer to it after the chat ended
+type Session struct {
+	ID        string
+	UserA     int
+	UserB     int
+	Shared    []string
+	StartedAt time.Time
+	EndedAt   time.Time // Zero while the chat is going on
+}
+
+// Reports if the user took part in the session
+func (s *Session) Has(userID int) bool {
+	return s.UserA == userID || s.UserB == userID
+}
+
+// Returns the other user of the session
+func (s *Session) Partner(userID int) int {
+	if s.UserA == userID {
+		return s.UserB
+	}
+
+	return s.UserA
+}
+
+/*
+Keeps track of the random chat sessions so reports and ratings can refer to a partner by session.
+
+Ended sessions are forgotten once the TTL passed.
+*/
+type Sessions struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	byID      map[string]*Session
+	lastPrune time.Time
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:  ttl,
+		byID: make(map[string]*Session),
+	}
+}
+
+// Returns a new session without keeping track of it, used when the session starts on another node
+func NewSession(a, b int, shared []string, now time.Time) *Session {
+	return &Session{
+		ID:        uuid.NewString(),
+		UserA:     a,
+		UserB:     b,
+		Shared:    shared,
+		StartedAt: now,
+	}
+}
+
+func (s *Sessions) Start(a, b int, shared []string, now time.Time) *Session {
+	sess := NewSession(a, b, shared, now)
+	s.Add(sess, now)
+
+	return sess
+}
+
+// Keeps track of a session started elsewhere, e.g. by the node running a shared queue
+func (s *Sessions) Add(sess *Session, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+	s.byID[sess.ID] = sess
+}
+
+// Marks the session as ended, returns a copy of it or nil if it is unknown or already ended
+func (s *Sessions) End(id string, now time.Time) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.byID[id]
+	if !ok || !sess.EndedAt.IsZero() {
+		return nil
+	}
+
+	sess.EndedAt = now
+	ended := *sess
+
+	return &ended
+}
+
+// Returns a copy of the session if the user took part in it and it was not forgotten
+func (s *Sessions) Get(id string, userID int, now time.Time) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.byID[id]
+	if !ok || !sess.Has(userID) || s.expired(sess, now) {
+		return nil, false
+	}
+
+	found := *sess
+	return &found, true
+}
+
+func (s *Sessions) expired(sess *Session, now time.Time) bool {
+	return !sess.EndedAt.IsZero() && now.Sub(sess.EndedAt) >= s.ttl
+}
+
+// Forgets expired sessions, at most once per TTL
+func (s *Sessions) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.ttl {
+		return
+	}
+
+	for id, sess := range s.byID {
+		if s.expired(sess, now) {
+			delete(s.byID, id)
+		}
+	}
+
+	s.lastPrune = now
+}
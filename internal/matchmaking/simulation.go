@@ -0,0 +1,139 @@
+package matchmaking
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// A user joining the simulated queue At after the start, a non zero Leave is when the user gives up waiting
+type Arrival struct {
+	At    time.Duration
+	Leave time.Duration
+	Entry *Entry
+}
+
+/*
+Replays arrivals against a matcher on a virtual clock.
+
+Like the hub, the matcher is run after every arrival and on every tick. Nothing depends on the wall clock
+or goroutines, so the same simulation always gives the same result.
+*/
+type Simulation struct {
+	Start    time.Time
+	Tick     time.Duration
+	Duration time.Duration
+	Arrivals []Arrival
+}
+
+type SimulatedPair struct {
+	At     time.Duration
+	A, B   int
+	Shared []string
+}
+
+type SimulationResult struct {
+	Pairs    []SimulatedPair
+	Left     []int         // Users that gave up before being paired
+	Waiting  []int         // Users still queued when the simulation ended
+	MeanWait time.Duration // Average wait of the paired users
+}
+
+func (s Simulation) Run(m Matcher) *SimulationResult {
+	arrivals := append([]Arrival(nil), s.Arrivals...)
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		return arrivals[i].At < arrivals[j].At
+	})
+
+	result := new(SimulationResult)
+	queued := make(map[int]Arrival)
+	var totalWait time.Duration
+
+	match := func(at time.Duration) {
+		for _, p := range m.Match(s.Start.Add(at)) {
+			result.Pairs = append(result.Pairs, SimulatedPair{At: at, A: p.A.UserID, B: p.B.UserID, Shared: p.Shared})
+			totalWait += at - queued[p.A.UserID].At + at - queued[p.B.UserID].At
+
+			delete(queued, p.A.UserID)
+			delete(queued, p.B.UserID)
+		}
+	}
+
+	leave := func(at time.Duration) {
+		// Sorted by user ID so the order of Left does not depend on map iteration
+		ids := make([]int, 0, len(queued))
+		for id, a := range queued {
+			if a.Leave != 0 && a.At+a.Leave <= at {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			m.Dequeue(id)
+			delete(queued, id)
+			result.Left = append(result.Left, id)
+		}
+	}
+
+	next := 0
+	for at := time.Duration(0); at <= s.Duration; at += s.Tick {
+		for next < len(arrivals) && arrivals[next].At <= at {
+			a := arrivals[next]
+			next++
+
+			leave(a.At)
+
+			e := *a.Entry
+			e.QueuedAt = s.Start.Add(a.At)
+			if m.Enqueue(&e) {
+				queued[e.UserID] = a
+			}
+
+			match(a.At)
+		}
+
+		leave(at)
+		match(at)
+	}
+
+	for id := range queued {
+		result.Waiting = append(result.Waiting, id)
+	}
+	sort.Ints(result.Waiting)
+
+	if len(result.Pairs) > 0 {
+		result.MeanWait = totalWait / time.Duration(2*len(result.Pairs))
+	}
+
+	return result
+}
+
+/*
+Generates n arrivals spread over the given span, each with up to 3 interests picked from tags.
+
+The same seed always generates the same arrivals.
+*/
+func RandomArrivals(seed int64, n int, span time.Duration, tags []string) []Arrival {
+	rng := rand.New(rand.NewSource(seed))
+
+	arrivals := make([]Arrival, n)
+	for i := range arrivals {
+		var interests []string
+		if len(tags) > 0 {
+			for _, k := range rng.Perm(len(tags))[:rng.Intn(min(3, len(tags))+1)] {
+				interests = append(interests, tags[k])
+			}
+		}
+
+		arrivals[i] = Arrival{
+			At: time.Duration(rng.Int63n(int64(span) + 1)),
+			Entry: &Entry{
+				UserID:    i + 1,
+				Interests: interests,
+			},
+		}
+	}
+
+	return arrivals
+}
@@ -0,0 +1,112 @@
+package matchmaking
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Limits how often users may skip their random partner.
+
+Consecutive skips have to be at least the interval apart. A user that skips more than the limit within the
+window is put in a cooldown, during which every skip is refused.
+*/
+type SkipLimiter struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	limit     int // Zero disables the limit, the interval still applies
+	window    time.Duration
+	cooldown  time.Duration
+	skips     map[int][]time.Time // Skips of each user within the window, oldest first
+	blocked   map[int]time.Time   // Users in a cooldown and when it ends
+	lastPrune time.Time
+}
+
+func NewSkipLimiter(interval time.Duration, limit int, window, cooldown time.Duration) *SkipLimiter {
+	return &SkipLimiter{
+		interval: interval,
+		limit:    limit,
+		window:   window,
+		cooldown: cooldown,
+		skips:    make(map[int][]time.Time),
+		blocked:  make(map[int]time.Time),
+	}
+}
+
+/*
+Counts a skip of the user.
+
+Returns false and how long the user has to wait when the skip is refused, refused skips are not counted.
+*/
+func (l *SkipLimiter) Skip(userID int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	if until, ok := l.blocked[userID]; ok && now.Before(until) {
+		return until.Sub(now), false
+	}
+
+	skips := l.recent(userID, now)
+	if n := len(skips); n > 0 && now.Sub(skips[n-1]) < l.interval {
+		return l.interval - now.Sub(skips[n-1]), false
+	}
+
+	if l.limit > 0 && len(skips) >= l.limit {
+		l.blocked[userID] = now.Add(l.cooldown)
+		delete(l.skips, userID)
+
+		return l.cooldown, false
+	}
+
+	l.skips[userID] = append(skips, now)
+	return 0, true
+}
+
+// Returns the remaining cooldown of the user, zero when the user is not in one
+func (l *SkipLimiter) Cooldown(userID int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until, ok := l.blocked[userID]; ok && now.Before(until) {
+		return until.Sub(now)
+	}
+
+	return 0
+}
+
+// Returns the skips of the user that are still within the window
+func (l *SkipLimiter) recent(userID int, now time.Time) []time.Time {
+	skips := l.skips[userID]
+
+	i := 0
+	for i < len(skips) && now.Sub(skips[i]) >= max(l.window, l.interval) {
+		i++
+	}
+
+	return skips[i:]
+}
+
+// Forgets expired skips and cooldowns, at most once per window so skipping stays cheap
+func (l *SkipLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+
+	for id := range l.skips {
+		if skips := l.recent(id, now); len(skips) > 0 {
+			l.skips[id] = skips
+		} else {
+			delete(l.skips, id)
+		}
+	}
+
+	for id, until := range l.blocked {
+		if !now.Before(until) {
+			delete(l.blocked, id)
+		}
+	}
+
+	l.lastPrune = now
+}
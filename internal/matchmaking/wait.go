@@ -0,0 +1,74 @@
+package matchmaking
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Estimates how long a queued user waits for a partner from the rate users were matched at recently.
+
+Only the matches within the window count, so the estimate follows the traffic of the moment.
+*/
+type WaitEstimator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	matches []matchCount // Oldest first
+}
+
+type matchCount struct {
+	at    time.Time
+	users int
+}
+
+func NewWaitEstimator(window time.Duration) *WaitEstimator {
+	return &WaitEstimator{window: window}
+}
+
+// Records that the amount of users were matched at the given time
+func (w *WaitEstimator) Record(users int, now time.Time) {
+	if users <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.prune(now)
+	w.matches = append(w.matches, matchCount{at: now, users: users})
+}
+
+/*
+Returns the expected wait of the user at the 1-based position in the queue.
+
+Returns false when no one was matched within the window, there is nothing to base an estimate on.
+*/
+func (w *WaitEstimator) Estimate(position int, now time.Time) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.prune(now)
+
+	users := 0
+	for _, m := range w.matches {
+		users += m.users
+	}
+
+	if users == 0 || w.window <= 0 {
+		return 0, false
+	}
+
+	// Users matched per second over the window
+	rate := float64(users) / w.window.Seconds()
+	return time.Duration(float64(position) / rate * float64(time.Second)), true
+}
+
+// Forgets the matches that fell out of the window
+func (w *WaitEstimator) prune(now time.Time) {
+	i := 0
+	for i < len(w.matches) && now.Sub(w.matches[i].at) >= w.window {
+		i++
+	}
+
+	w.matches = w.matches[i:]
+}
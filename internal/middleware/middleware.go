@@ -5,12 +5,12 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/origin"
 	"github.com/jlry-dev/whirl/internal/util"
 )
 
@@ -20,34 +20,39 @@ type Middleware interface {
 }
 
 type middlewareStruct struct {
-	rsp    *handler.ResponseHandler
-	logger *slog.Logger
+	rsp     *handler.ResponseHandler
+	logger  *slog.Logger
+	origins origin.Policy
 }
 
-func NewMiddleware(rsp *handler.ResponseHandler, logger *slog.Logger) Middleware {
+func NewMiddleware(rsp *handler.ResponseHandler, logger *slog.Logger, origins origin.Policy) Middleware {
 	return &middlewareStruct{
-		rsp:    rsp,
-		logger: logger,
+		rsp:     rsp,
+		logger:  logger,
+		origins: origins,
 	}
 }
 
+// Answers CORS requests of the origins the policy allows and refuses every request of the other origins
 func (m *middlewareStruct) CorsMiddleware(next http.Handler) http.Handler {
-	frontendURL := os.Getenv("FRONTEND_ADDRESS")
-	allowAll := frontendURL == ""
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
 		m.logger.Info("request has been made", slog.String("origin", origin))
 
-		if allowAll {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		} else if origin == frontendURL {
-			w.Header().Set("Access-Control-Allow-Origin", origin) // Reflect for security
-		} else {
-			http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+		if !m.origins.Allow(origin) {
+			m.logger.Warn("cors: origin not allowed", slog.String("origin", origin), slog.String("METHOD", r.Method), slog.String("PATH", r.URL.Path))
+			m.rsp.Error(w, http.StatusForbidden, "origin not allowed", nil)
 			return
 		}
-		w.Header().Set("Access-Control-Allow-Origin", frontendURL)
+
+		switch {
+		case m.origins.AllowsAll():
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case origin != "":
+			// Reflected, so caches have to keep the answers of the origins apart
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		w.Header().Set("Access-Control-Max-Age", "86400")
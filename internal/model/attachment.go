@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+type Attachment struct {
+	ID           int
+	UploaderID   int
+	MessageID    *int
+	StorageKey   string
+	ThumbnailKey *string
+	FileName     string
+	MimeType     string
+	Size         int64
+	CreatedAt    time.Time
+}
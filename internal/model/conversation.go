@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// A group conversation, direct messages do not have one
+type Conversation struct {
+	ID        int
+	Name      string
+	CreatedBy int
+	CreatedAt time.Time
+}
+
+type ConversationMember struct {
+	ConversationID int
+	UserID         int
+	Role           ConversationRole
+	JoinedAt       time.Time
+}
+
+type ConversationRole string
+
+const (
+	RoleOwner  ConversationRole = "owner"
+	RoleAdmin  ConversationRole = "admin"
+	RoleMember ConversationRole = "member"
+)
+
+// Owners outrank admins who outrank members
+func (r ConversationRole) Rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,56 @@
+package dto
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+type UploadAttachmentDTO struct {
+	File     io.Reader
+	FileName string
+	UserID   int
+}
+
+// The attachment metadata sent to clients
+type AttachmentDTO struct {
+	ID           int    `json:"id"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	URL          string `json:"url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func NewAttachmentDTO(a *model.Attachment) *AttachmentDTO {
+	url := "/attachment/" + strconv.Itoa(a.ID)
+
+	at := &AttachmentDTO{
+		ID:       a.ID,
+		FileName: a.FileName,
+		MimeType: a.MimeType,
+		Size:     a.Size,
+		URL:      url,
+	}
+
+	if a.ThumbnailKey != nil {
+		at.ThumbnailURL = url + "/thumbnail"
+	}
+
+	return at
+}
+
+type UploadAttachmentSuccessDTO struct {
+	Status     int            `json:"status"`
+	Attachment *AttachmentDTO `json:"attachment"`
+}
+
+// An opened attachment file ready to be streamed to the client
+type AttachmentFileDTO struct {
+	Content   io.ReadCloser
+	FileName  string
+	MimeType  string
+	CreatedAt time.Time
+}
@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+type CreateConversationDTO struct {
+	OwnerID int    `json:"-"`
+	Name    string `json:"name"`
+	Members []int  `json:"members"` // User IDs added alongside the owner, they have to be friends of the owner
+}
+
+// Used to invite, kick or change the role of a member, the actor is the user making the change
+type ConversationMemberDTO struct {
+	ConversationID int    `json:"-"`
+	ActorID        int    `json:"-"`
+	UserID         int    `json:"user_id"`
+	Role           string `json:"role,omitempty"`
+}
+
+type GroupMessageDTO struct {
+	From           int
+	ConversationID int
+	Content        string
+	Timestamp      time.Time
+}
+
+type ConversationDTO struct {
+	Status       int                         `json:"status"`
+	Conversation *model.Conversation         `json:"conversation"`
+	Members      []*model.ConversationMember `json:"members"`
+}
+
+type ConversationsDTO struct {
+	Status        int                   `json:"status"`
+	Conversations []*model.Conversation `json:"conversations"`
+}
+
+type ConversationMemberSuccessDTO struct {
+	Status int                       `json:"status"`
+	Member *model.ConversationMember `json:"member"`
+}
+
+type ConversationServiceSuccessDTO struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
@@ -1,6 +1,10 @@
 package dto
 
-import "github.com/jlry-dev/whirl/internal/model"
+import (
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model"
+)
 
 type ChatData struct {
 	Type    string `json:"type"`
@@ -8,6 +12,72 @@ type ChatData struct {
 }
 
 type MessagesDTO struct {
-	Status   int              `json:"status"`
-	Messages []*model.Message `json:"messages"`
+	Status   int                  `json:"status"`
+	Messages []*HistoryMessageDTO `json:"messages"`
+}
+
+// A message of the history, its attachment is sent the way the websocket sends it instead of the stored row
+type HistoryMessageDTO struct {
+	*model.Message
+	Attachment *AttachmentDTO `json:"Attachment"`
+}
+
+// Maps the messages for a history response, a message deleted for everyone is sent without its attachment
+func NewHistoryMessages(messages []*model.Message) []*HistoryMessageDTO {
+	history := make([]*HistoryMessageDTO, 0, len(messages))
+	for _, m := range messages {
+		hm := &HistoryMessageDTO{Message: m}
+		if m.Attachment != nil && m.DeletedAt == nil {
+			hm.Attachment = NewAttachmentDTO(m.Attachment)
+		}
+
+		history = append(history, hm)
+	}
+
+	return history
+}
+
+type StoreMessageDTO struct {
+	From         int
+	To           int
+	Content      string
+	ReplyTo      int // Zero when the message is not a reply
+	AttachmentID int // Zero when the message has no attachment
+	Timestamp    time.Time
+}
+
+type EditMessageDTO struct {
+	MessageID int    `json:"-"`
+	UserID    int    `json:"-"`
+	Content   string `json:"content"`
+}
+
+type DeleteMessageDTO struct {
+	MessageID int    `json:"-"`
+	UserID    int    `json:"-"`
+	Scope     string `json:"scope"` // Either "me" or "everyone"
+}
+
+type MessageDTO struct {
+	Status  int            `json:"status"`
+	Message *model.Message `json:"message"`
+}
+
+type SearchMessagesDTO struct {
+	UserID int
+	Query  string
+	With   int // Zero searches every conversation of the user
+	Cursor int // ID of the last result of the previous page, zero for the first page
+}
+
+type MessageSearchDTO struct {
+	Status     int                          `json:"status"`
+	Results    []*model.MessageSearchResult `json:"results"`
+	NextCursor int                          `json:"next_cursor,omitempty"` // Zero when there are no more results
+}
+
+type ReactionDTO struct {
+	MessageID int
+	UserID    int
+	Emoji     string
 }
@@ -0,0 +1,58 @@
+package dto
+
+// Match preferences sent with join_random, empty fields match anyone
+type RandomPreferencesDTO struct {
+	Countries []string `json:"countries,omitempty"` // ISO 3166-1 alpha-3 codes of the countries the partner may be from
+	Languages []string `json:"languages,omitempty"` // ISO 639-1 codes of the languages the user speaks
+	MinAge    int      `json:"min_age,omitempty"`
+	MaxAge    int      `json:"max_age,omitempty"`
+}
+
+type JoinRandomDTO struct {
+	UserID      int
+	Preferences RandomPreferencesDTO
+}
+
+// What the matcher knows about a queued user, the age and country come from the user's profile
+type RandomProfileDTO struct {
+	UserID      int
+	Age         int
+	Country     string
+	Reputation  float64 // Between 0 and 1, see service.Reputation
+	Preferences RandomPreferencesDTO
+}
+
+// What a random partner sees of the user once both of them agreed to reveal themselves
+type PublicProfileDTO struct {
+	ID          int     `json:"id"`
+	Username    string  `json:"username"`
+	AvatarURL   *string `json:"avatar_url"`
+	CountryCode string  `json:"country-code"`
+	CountryName string  `json:"country-name"`
+}
+
+// The reported user is resolved from the session, the client never learns the partner's ID
+type RandomReportDTO struct {
+	ReporterID int    `json:"-"`
+	ReportedID int    `json:"-"`
+	SessionID  string `json:"session"`
+	Reason     string `json:"reason"`
+	Transcript string `json:"transcript,omitempty"` // What the reporter saw of the chat
+}
+
+type RandomRatingDTO struct {
+	RaterID   int    `json:"-"`
+	RatedID   int    `json:"-"`
+	SessionID string `json:"session"`
+	Rating    string `json:"rating"` // Either "up" or "down"
+}
+
+type RandomReportSuccessDTO struct {
+	Status   int `json:"status"`
+	ReportID int `json:"report_id"`
+}
+
+type RandomServiceSuccessDTO struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
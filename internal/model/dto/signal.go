@@ -0,0 +1,29 @@
+package dto
+
+// An ICE candidate as the browsers serialize an RTCIceCandidate
+type IceCandidateDTO struct {
+	Candidate        string  `json:"candidate"` // Empty marks the end of the candidates
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *int    `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// A WebRTC signaling message relayed between two peers
+type SignalDTO struct {
+	Type      string // One of rtc_offer, rtc_answer, rtc_ice or rtc_hangup
+	SDP       string
+	Candidate *IceCandidateDTO
+}
+
+// An ICE server in the RTCIceServer format
+type IceServerDTO struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+type RTCConfigDTO struct {
+	Status     int            `json:"status,omitempty"`
+	IceServers []IceServerDTO `json:"ice_servers"`
+	TTL        int            `json:"ttl,omitempty"` // Seconds the TURN credentials are valid, left out for static ones
+}
@@ -3,9 +3,63 @@ package model
 import "time"
 
 type Message struct {
-	ID         int
-	SenderID   int
-	ReceiverID int
-	Content    string
-	Timestamp  time.Time
+	ID             int
+	SenderID       int
+	ReceiverID     int  // Zero for group messages
+	ConversationID *int // Only set for group messages
+	Content        string
+	Timestamp      time.Time
+	EditedAt       *time.Time
+	DeletedAt      *time.Time
+	ReplyTo        *int
+	Quote          *MessageQuote // Preview of the ReplyTo message, only set when retrieving history
+	Attachment     *Attachment
+	Reactions      []*ReactionCount
+}
+
+// A message matching a search, the snippet is the matching part of its content
+type MessageSearchResult struct {
+	ID             int
+	SenderID       int
+	ReceiverID     int  // Zero for group messages
+	ConversationID *int // Only set for group messages
+	Timestamp      time.Time
+	Snippet        string
+}
+
+// A compact preview of the message being replied to
+type MessageQuote struct {
+	ID       int
+	SenderID int
+	Content  string // Truncated content of the quoted message
+	Deleted  bool
+}
+
+type MessageRevision struct {
+	ID        int
+	MessageID int
+	Content   string
+	Action    MessageRevisionAction
+	RevisedAt time.Time
+}
+
+type MessageRevisionAction string
+
+const (
+	MessageEdited  MessageRevisionAction = "edited"
+	MessageDeleted MessageRevisionAction = "deleted"
+)
+
+type Reaction struct {
+	MessageID int
+	UserID    int
+	Emoji     string
+	CreatedAt time.Time
+}
+
+// The aggregated reactions of a single emoji on a message
+type ReactionCount struct {
+	Emoji   string
+	Count   int
+	Reacted bool // Whether the user who requested the messages is one of the reactors
 }
@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+type RandomReportReason string
+
+const (
+	ReportSpam          RandomReportReason = "spam"
+	ReportHarassment    RandomReportReason = "harassment"
+	ReportSexualContent RandomReportReason = "sexual_content"
+	ReportHate          RandomReportReason = "hate"
+	ReportUnderage      RandomReportReason = "underage"
+	ReportOther         RandomReportReason = "other"
+)
+
+// Reports if the reason is one of the report categories
+func (r RandomReportReason) Valid() bool {
+	switch r {
+	case ReportSpam, ReportHarassment, ReportSexualContent, ReportHate, ReportUnderage, ReportOther:
+		return true
+	default:
+		return false
+	}
+}
+
+type RandomReport struct {
+	ID         int
+	SessionID  string
+	ReporterID int
+	ReportedID int
+	Reason     RandomReportReason
+	Transcript *string
+	CreatedAt  time.Time
+}
+
+type RandomRating struct {
+	SessionID string
+	RaterID   int
+	RatedID   int
+	Positive  bool
+	CreatedAt time.Time
+}
+
+// Why a random chat ended
+type RandomEndReason string
+
+const (
+	EndSkip       RandomEndReason = "skip"
+	EndLeave      RandomEndReason = "leave"
+	EndDisconnect RandomEndReason = "disconnect"
+	EndReport     RandomEndReason = "report"
+)
+
+// A random chat between two users, the end is nil while the chat is going on
+type RandomSession struct {
+	ID        string
+	UserA     int
+	UserB     int
+	Interests []string // The interests the users were matched on
+	StartedAt time.Time
+	EndedAt   *time.Time
+	EndReason *RandomEndReason
+}
@@ -0,0 +1,160 @@
+/*
+Package origin decides which browser origins may call the API.
+
+CORS and the websocket upgrader share the policy, so a page that may call the API may also open a websocket.
+*/
+package origin
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidPattern = errors.New("origin: invalid origin pattern")
+
+type Policy interface {
+	/*
+		Reports if requests from the origin, the value of the Origin header, are allowed.
+
+		Requests without an Origin do not come from a browser page, so they are allowed. The origin browsers send for
+		sandboxed pages and local files, "null", is only allowed when every origin is.
+	*/
+	Allow(origin string) bool
+	// Reports if every origin is allowed
+	AllowsAll() bool
+}
+
+type pattern struct {
+	scheme   string
+	host     string // The parent domain for wildcards
+	port     string
+	wildcard bool // Matches any subdomain of the host, but not the host itself
+}
+
+type AllowList struct {
+	all      bool
+	patterns []pattern
+	devMode  bool
+}
+
+// Hosts allowed on any port in dev mode
+var localhosts = map[string]bool{
+	"localhost": true,
+	"127.0.0.1": true,
+	"::1":       true,
+}
+
+/*
+Returns the policy allowing the given origins.
+
+Origins are either exact, like https://whirl.app, or allow every subdomain, like https://*.whirl.app.
+A single "*" or no origins at all allow every origin. Dev mode also allows localhost on any port.
+*/
+func NewPolicy(allowed []string, devMode bool) (Policy, error) {
+	p := &AllowList{
+		all:     len(allowed) == 0,
+		devMode: devMode,
+	}
+
+	for _, a := range allowed {
+		if a == "*" {
+			p.all = true
+			continue
+		}
+
+		pat, err := parsePattern(a)
+		if err != nil {
+			return nil, err
+		}
+
+		p.patterns = append(p.patterns, pat)
+	}
+
+	return p, nil
+}
+
+func (p *AllowList) Allow(origin string) bool {
+	if origin == "" || p.all {
+		return true
+	}
+
+	scheme, host, port, ok := parseOrigin(origin)
+	if !ok {
+		return false
+	}
+
+	if p.devMode && localhosts[host] {
+		return true
+	}
+
+	for _, pat := range p.patterns {
+		if pat.scheme != scheme || pat.port != port {
+			continue
+		}
+
+		if pat.wildcard && strings.HasSuffix(host, "."+pat.host) {
+			return true
+		}
+
+		if !pat.wildcard && pat.host == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *AllowList) AllowsAll() bool {
+	return p.all
+}
+
+func parsePattern(raw string) (pattern, error) {
+	wildcard := false
+
+	// The wildcard is not a valid host, it is taken out before parsing
+	if scheme, rest, ok := strings.Cut(raw, "://*."); ok {
+		wildcard = true
+		raw = scheme + "://" + rest
+	}
+
+	scheme, host, port, ok := parseOrigin(raw)
+	if !ok || strings.Contains(host, "*") {
+		return pattern{}, fmt.Errorf("%w : %q", ErrInvalidPattern, raw)
+	}
+
+	return pattern{
+		scheme:   scheme,
+		host:     host,
+		port:     port,
+		wildcard: wildcard,
+	}, nil
+}
+
+// Splits an origin into its lowercase scheme and host and its port, default ports are filled in
+func parseOrigin(raw string) (scheme, host, port string, ok bool) {
+	u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", "", false
+	}
+
+	scheme = strings.ToLower(u.Scheme)
+	host = strings.ToLower(u.Hostname())
+	port = u.Port()
+
+	if host == "" {
+		return "", "", "", false
+	}
+
+	switch {
+	case scheme == "https" && port == "":
+		port = "443"
+	case scheme == "http" && port == "":
+		port = "80"
+	case scheme != "https" && scheme != "http":
+		return "", "", "", false
+	}
+
+	return scheme, host, port, true
+}
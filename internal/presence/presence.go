@@ -0,0 +1,23 @@
+/*
+Package presence keeps track of which node holds the websocket connection of a user.
+
+Entries expire unless the node refreshes them, so users of a node that went down without saying goodbye
+are offline after the TTL.
+*/
+package presence
+
+import (
+	"context"
+	"time"
+)
+
+type Registry interface {
+	// Marks the users as connected to the node, called again before the TTL runs out to keep them online
+	Register(ctx context.Context, node string, userIDs ...int) error
+	// Marks the user as offline, unless the user connected to another node since
+	Unregister(ctx context.Context, node string, userID int) error
+	// Returns the node of every given user that is online, offline users are left out
+	Lookup(ctx context.Context, userIDs ...int) (map[int]string, error)
+	// How long an entry lives without being registered again
+	TTL() time.Duration
+}
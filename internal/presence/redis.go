@@ -0,0 +1,92 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisPrefix = "whirl:presence:"
+
+// Deletes the entry only if it still points at the node
+var redisUnregister = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Keeps one key per online user holding the node, the key expires after the TTL
+type RedisRegistry struct {
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+func NewRedisRegistry(rdb *redis.Client, ttl time.Duration) Registry {
+	return &RedisRegistry{
+		rdb: rdb,
+		ttl: ttl,
+	}
+}
+
+func (r *RedisRegistry) Register(ctx context.Context, node string, userIDs ...int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	pipe := r.rdb.Pipeline()
+	for _, id := range userIDs {
+		pipe.Set(ctx, redisKey(id), node, r.ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("presence: failed to register users : %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRegistry) Unregister(ctx context.Context, node string, userID int) error {
+	if err := redisUnregister.Run(ctx, r.rdb, []string{redisKey(userID)}, node).Err(); err != nil {
+		return fmt.Errorf("presence: failed to unregister user : %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRegistry) Lookup(ctx context.Context, userIDs ...int) (map[int]string, error) {
+	nodes := make(map[int]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return nodes, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = redisKey(id)
+	}
+
+	values, err := r.rdb.MGet(ctx, keys...).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("presence: failed to look up users : %w", err)
+	}
+
+	for i, v := range values {
+		if node, ok := v.(string); ok {
+			nodes[userIDs[i]] = node
+		}
+	}
+
+	return nodes, nil
+}
+
+func (r *RedisRegistry) TTL() time.Duration {
+	return r.ttl
+}
+
+func redisKey(userID int) string {
+	return redisPrefix + strconv.Itoa(userID)
+}
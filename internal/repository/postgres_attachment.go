@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+type AttachmentRepo struct{}
+
+func NewAttachmentRepository() AttachmentRepository {
+	return &AttachmentRepo{}
+}
+
+// Returns the ID of the created attachment
+func (r *AttachmentRepo) CreateAttachment(ctx context.Context, qr Queryer, a *model.Attachment) (int, error) {
+	qry := `INSERT INTO attachment (uploader_id, storage_key, thumbnail_key, file_name, mime_type, size, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	var aid int // Attachment ID
+	if err := qr.QueryRow(ctx, qry, a.UploaderID, a.StorageKey, a.ThumbnailKey, a.FileName, a.MimeType, a.Size, a.CreatedAt).Scan(&aid); err != nil {
+		return 0, fmt.Errorf("repo: failed to create attachment : %w", err)
+	}
+
+	return aid, nil
+}
+
+func (r *AttachmentRepo) GetAttachment(ctx context.Context, qr Queryer, attachmentID int) (*model.Attachment, error) {
+	qry := `SELECT id, uploader_id, message_id, storage_key, thumbnail_key, file_name, mime_type, size, created_at
+		FROM attachment
+		WHERE id = $1`
+
+	a := new(model.Attachment)
+	if err := qr.QueryRow(ctx, qry, attachmentID).Scan(&a.ID, &a.UploaderID, &a.MessageID, &a.StorageKey, &a.ThumbnailKey, &a.FileName, &a.MimeType, &a.Size, &a.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get attachment : %w", err)
+	}
+
+	return a, nil
+}
+
+/*
+Links an uploaded attachment to the message it was sent with.
+
+Only the uploader can link the attachment and only once, otherwise ErrNoRowsFound is returned.
+*/
+func (r *AttachmentRepo) LinkAttachment(ctx context.Context, qr Queryer, attachmentID, messageID, uploaderID int) error {
+	qry := `UPDATE attachment SET message_id = $1 WHERE id = $2 AND uploader_id = $3 AND message_id IS NULL`
+
+	result, err := qr.Exec(ctx, qry, messageID, attachmentID, uploaderID)
+	if err != nil {
+		return fmt.Errorf("repo: failed to link attachment : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+var ErrDuplicateMember = errors.New("repo: user is already a member of the conversation")
+
+type ConversationRepo struct{}
+
+func NewConversationRepository() ConversationRepository {
+	return &ConversationRepo{}
+}
+
+// Returns the ID of the created conversation
+func (r *ConversationRepo) CreateConversation(ctx context.Context, qr Queryer, c *model.Conversation) (int, error) {
+	qry := `INSERT INTO conversation (name, created_by, created_at) VALUES ($1, $2, $3) RETURNING id`
+
+	var cid int // Conversation ID
+	if err := qr.QueryRow(ctx, qry, c.Name, c.CreatedBy, c.CreatedAt).Scan(&cid); err != nil {
+		return 0, fmt.Errorf("repo: failed to create conversation : %w", err)
+	}
+
+	return cid, nil
+}
+
+func (r *ConversationRepo) GetConversation(ctx context.Context, qr Queryer, conversationID int) (*model.Conversation, error) {
+	qry := `SELECT id, name, created_by, created_at FROM conversation WHERE id = $1`
+
+	c := new(model.Conversation)
+	if err := qr.QueryRow(ctx, qry, conversationID).Scan(&c.ID, &c.Name, &c.CreatedBy, &c.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get conversation : %w", err)
+	}
+
+	return c, nil
+}
+
+// Retrieves the conversations the user is a member of, the most recently joined first
+func (r *ConversationRepo) GetConversations(ctx context.Context, qr Queryer, userID int) ([]*model.Conversation, error) {
+	qry := `SELECT c.id, c.name, c.created_by, c.created_at
+		FROM conversation AS c
+		JOIN conversation_member AS cm ON cm.conversation_id = c.id
+		WHERE cm.user_id = $1
+		ORDER BY cm.joined_at DESC`
+
+	rows, err := qr.Query(ctx, qry, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get conversations : %w", err)
+	}
+	defer rows.Close()
+
+	conversations := make([]*model.Conversation, 0, 8)
+	for rows.Next() {
+		var c model.Conversation
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedBy, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan conversation row : %w", err)
+		}
+
+		conversations = append(conversations, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return conversations, nil
+}
+
+func (r *ConversationRepo) AddMember(ctx context.Context, qr Queryer, m *model.ConversationMember) error {
+	qry := `INSERT INTO conversation_member (conversation_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`
+
+	if _, err := qr.Exec(ctx, qry, m.ConversationID, m.UserID, m.Role, m.JoinedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == pgerrcode.UniqueViolation {
+				return ErrDuplicateMember
+			}
+		}
+
+		return fmt.Errorf("repo: failed to add conversation member : %w", err)
+	}
+
+	return nil
+}
+
+func (r *ConversationRepo) GetMember(ctx context.Context, qr Queryer, conversationID, userID int) (*model.ConversationMember, error) {
+	qry := `SELECT conversation_id, user_id, role, joined_at FROM conversation_member WHERE conversation_id = $1 AND user_id = $2`
+
+	m := new(model.ConversationMember)
+	if err := qr.QueryRow(ctx, qry, conversationID, userID).Scan(&m.ConversationID, &m.UserID, &m.Role, &m.JoinedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get conversation member : %w", err)
+	}
+
+	return m, nil
+}
+
+// Retrieves the members of the conversation, the earliest to join first
+func (r *ConversationRepo) GetMembers(ctx context.Context, qr Queryer, conversationID int) ([]*model.ConversationMember, error) {
+	qry := `SELECT conversation_id, user_id, role, joined_at
+		FROM conversation_member
+		WHERE conversation_id = $1
+		ORDER BY joined_at ASC`
+
+	rows, err := qr.Query(ctx, qry, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get conversation members : %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]*model.ConversationMember, 0, 8)
+	for rows.Next() {
+		var m model.ConversationMember
+		if err := rows.Scan(&m.ConversationID, &m.UserID, &m.Role, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan conversation member row : %w", err)
+		}
+
+		members = append(members, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return members, nil
+}
+
+func (r *ConversationRepo) UpdateMemberRole(ctx context.Context, qr Queryer, m *model.ConversationMember) error {
+	qry := `UPDATE conversation_member SET role = $1 WHERE conversation_id = $2 AND user_id = $3`
+
+	result, err := qr.Exec(ctx, qry, m.Role, m.ConversationID, m.UserID)
+	if err != nil {
+		return fmt.Errorf("repo: failed to update conversation member role : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+func (r *ConversationRepo) RemoveMember(ctx context.Context, qr Queryer, conversationID, userID int) error {
+	qry := `DELETE FROM conversation_member WHERE conversation_id = $1 AND user_id = $2`
+
+	result, err := qr.Exec(ctx, qry, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("repo: failed to remove conversation member : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jlry-dev/whirl/internal/model"
 	"github.com/jlry-dev/whirl/internal/model/dto"
@@ -109,6 +110,21 @@ func (f *FriendshipRepo) GetFriends(ctx context.Context, qr Queryer, userID, pag
 	return friends, nil
 }
 
+func (f *FriendshipRepo) GetFriendshipStatus(ctx context.Context, qr Queryer, fr *model.Friendship) (model.FriendshipStatus, error) {
+	qry := `SELECT status FROM "friendship" as f WHERE (f.user1_id = $1 AND f.user2_id = $2) OR (f.user1_id = $2 AND f.user2_id = $1)`
+
+	var status model.FriendshipStatus
+	if err := qr.QueryRow(ctx, qry, fr.UID_1, fr.UID_2).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRowsFound
+		}
+
+		return "", fmt.Errorf("repo: failed to get friendship status : %w", err)
+	}
+
+	return status, nil
+}
+
 func (f *FriendshipRepo) CheckRelationship(ctx context.Context, qr Queryer, fr *model.Friendship) (bool, error) {
 	qry := `SELECT status FROM "friendship" as f WHERE (f.user1_id = $1 AND f.user2_id = $2) OR (f.user1_id = $2 AND f.user2_id = $1)`
 
@@ -123,3 +139,32 @@ func (f *FriendshipRepo) CheckRelationship(ctx context.Context, qr Queryer, fr *
 
 	return true, nil
 }
+
+// Returns the users having a relationship record with the user, whatever its status
+func (f *FriendshipRepo) GetRelatedUserIDs(ctx context.Context, qr Queryer, userID int) ([]int, error) {
+	qry := `SELECT CASE WHEN f.user1_id = $1 THEN f.user2_id ELSE f.user1_id END
+		FROM "friendship" as f
+		WHERE f.user1_id = $1 OR f.user2_id = $1`
+
+	rows, err := qr.Query(ctx, qry, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get related users : %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, 16)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan related user row : %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return ids, nil
+}
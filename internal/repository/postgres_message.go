@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jlry-dev/whirl/internal/model"
 )
 
@@ -13,20 +16,64 @@ func NewMessageRepository() MessageRepository {
 	return &MessageRepo{}
 }
 
-func (r *MessageRepo) CreateMessage(ctx context.Context, qr Queryer, ch *model.Message) error {
-	qry := `INSERT INTO message (sender_id, receiver_id, content, timestamp) VALUES ($1, $2, $3, $4)`
+// Returns the ID of the created message, group messages are stored without a receiver
+func (r *MessageRepo) CreateMessage(ctx context.Context, qr Queryer, ch *model.Message) (int, error) {
+	qry := `INSERT INTO message (sender_id, receiver_id, conversation_id, content, timestamp, reply_to) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) RETURNING id`
 
-	if _, err := qr.Exec(ctx, qry, ch.SenderID, ch.ReceiverID, ch.Content, ch.Timestamp); err != nil {
-		return fmt.Errorf("repo: failed to create message: %w", err)
+	var mid int // Message ID
+	if err := qr.QueryRow(ctx, qry, ch.SenderID, ch.ReceiverID, ch.ConversationID, ch.Content, ch.Timestamp, ch.ReplyTo).Scan(&mid); err != nil {
+		return 0, fmt.Errorf("repo: failed to create message: %w", err)
 	}
 
-	return nil
+	return mid, nil
+}
+
+func (r *MessageRepo) GetMessage(ctx context.Context, qr Queryer, messageID int) (*model.Message, error) {
+	qry := `SELECT id, sender_id, COALESCE(receiver_id, 0), conversation_id, COALESCE(content, ''), timestamp, edited_at, deleted_at, reply_to
+		FROM message
+		WHERE id = $1`
+
+	m := new(model.Message)
+	if err := qr.QueryRow(ctx, qry, messageID).Scan(&m.ID, &m.SenderID, &m.ReceiverID, &m.ConversationID, &m.Content, &m.Timestamp, &m.EditedAt, &m.DeletedAt, &m.ReplyTo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get message : %w", err)
+	}
+
+	return m, nil
+}
+
+// Reports if the two users ever sent each other a direct message, deleted ones included
+func (r *MessageRepo) HasMessages(ctx context.Context, qr Queryer, uidOne, uidTwo int) (bool, error) {
+	qry := `SELECT EXISTS (
+			SELECT 1 FROM message
+			WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
+		)`
+
+	var exists bool
+	if err := qr.QueryRow(ctx, qry, uidOne, uidTwo).Scan(&exists); err != nil {
+		return false, fmt.Errorf("repo: failed to check messages : %w", err)
+	}
+
+	return exists, nil
 }
 
+/*
+Retrieves the messages between the two users, newest first.
+
+Messages uidOne deleted for themselves are left out. Replies carry a preview of the quoted message.
+*/
 func (r *MessageRepo) GetMessages(ctx context.Context, qr Queryer, uidOne, uidTwo, page int) ([]*model.Message, error) {
-	qry := `SELECT id, sender_id, receiver_id, content, timestamp 
+	qry := `SELECT m.id, m.sender_id, m.receiver_id, COALESCE(m.content, ''), m.timestamp, m.edited_at, m.deleted_at, m.reply_to,
+			q.id, q.sender_id, LEFT(COALESCE(q.content, ''), 100), q.deleted_at IS NOT NULL,
+			a.id, a.uploader_id, a.storage_key, a.thumbnail_key, a.file_name, a.mime_type, a.size, a.created_at
 		FROM message as m 
-		WHERE (m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1)
+		LEFT JOIN message AS q ON q.id = m.reply_to
+		LEFT JOIN attachment AS a ON a.message_id = m.id AND m.deleted_at IS NULL
+		WHERE ((m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1))
+			AND NOT EXISTS (SELECT 1 FROM message_hidden AS h WHERE h.message_id = m.id AND h.user_id = $1)
 		ORDER BY m.timestamp DESC
 		LIMIT $3`
 
@@ -40,11 +87,28 @@ func (r *MessageRepo) GetMessages(ctx context.Context, qr Queryer, uidOne, uidTw
 	messages := make([]*model.Message, 0, 100)
 	for rows.Next() {
 		var m model.Message
-		err := rows.Scan(&m.ID, &m.SenderID, &m.ReceiverID, &m.Content, &m.Timestamp)
+		var qID, qSenderID *int
+		var qContent *string
+		var qDeleted *bool
+		var a nullableAttachment
+
+		err := rows.Scan(append([]any{&m.ID, &m.SenderID, &m.ReceiverID, &m.Content, &m.Timestamp, &m.EditedAt, &m.DeletedAt, &m.ReplyTo,
+			&qID, &qSenderID, &qContent, &qDeleted}, a.fields()...)...)
 		if err != nil {
 			return nil, fmt.Errorf("repo: failed to scan message row : %w", err)
 		}
 
+		m.Attachment = a.toModel(m.ID)
+
+		if qID != nil {
+			m.Quote = &model.MessageQuote{
+				ID:       *qID,
+				SenderID: *qSenderID,
+				Content:  *qContent,
+				Deleted:  *qDeleted,
+			}
+		}
+
 		messages = append(messages, &m)
 	}
 
@@ -54,3 +118,283 @@ func (r *MessageRepo) GetMessages(ctx context.Context, qr Queryer, uidOne, uidTw
 
 	return messages, nil
 }
+
+/*
+Retrieves the messages of a group conversation sent from the since time onwards, newest first.
+
+The since time is the join time of the member retrieving the history.
+*/
+func (r *MessageRepo) GetConversationMessages(ctx context.Context, qr Queryer, conversationID int, since time.Time, page int) ([]*model.Message, error) {
+	qry := `SELECT id, sender_id, conversation_id, COALESCE(content, ''), timestamp, edited_at, deleted_at
+		FROM message
+		WHERE conversation_id = $1 AND timestamp >= $2
+		ORDER BY timestamp DESC
+		LIMIT $3`
+
+	p := 10 * page
+	rows, err := qr.Query(ctx, qry, conversationID, since, p)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get conversation messages : %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*model.Message, 0, p)
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.SenderID, &m.ConversationID, &m.Content, &m.Timestamp, &m.EditedAt, &m.DeletedAt); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan message row : %w", err)
+		}
+
+		messages = append(messages, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return messages, nil
+}
+
+/*
+Retrieves the messages received by the user with an ID greater than afterID, oldest first.
+
+This is used to sync the messages a client missed while it was offline.
+*/
+func (r *MessageRepo) GetMessagesAfter(ctx context.Context, qr Queryer, receiverID, afterID, limit int) ([]*model.Message, error) {
+	qry := `SELECT m.id, m.sender_id, m.receiver_id, COALESCE(m.content, ''), m.timestamp, m.edited_at, m.deleted_at, m.reply_to,
+			a.id, a.uploader_id, a.storage_key, a.thumbnail_key, a.file_name, a.mime_type, a.size, a.created_at
+		FROM message as m
+		LEFT JOIN attachment AS a ON a.message_id = m.id
+		WHERE m.receiver_id = $1 AND m.id > $2
+			AND NOT EXISTS (SELECT 1 FROM message_hidden AS h WHERE h.message_id = m.id AND h.user_id = $1)
+		ORDER BY m.id ASC
+		LIMIT $3`
+
+	rows, err := qr.Query(ctx, qry, receiverID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get messages after id : %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*model.Message, 0, limit)
+	for rows.Next() {
+		var m model.Message
+		var a nullableAttachment
+
+		err := rows.Scan(append([]any{&m.ID, &m.SenderID, &m.ReceiverID, &m.Content, &m.Timestamp, &m.EditedAt, &m.DeletedAt, &m.ReplyTo}, a.fields()...)...)
+		if err != nil {
+			return nil, fmt.Errorf("repo: failed to scan message row : %w", err)
+		}
+
+		m.Attachment = a.toModel(m.ID)
+
+		messages = append(messages, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return messages, nil
+}
+
+// Marks the matched terms in a search snippet, control characters are used since they do not show up in chat text
+const (
+	SearchMatchStart = "\x02"
+	SearchMatchStop  = "\x03"
+)
+
+var searchHeadlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=" ... "`, SearchMatchStart, SearchMatchStop)
+
+/*
+Full-text searches the conversations of the user, newest first.
+
+Group conversations are searched from the time the user joined them. When withID is not zero only the
+direct conversation with that user is searched. When beforeID is not zero only messages older than it
+are returned, which is used as the pagination cursor. Deleted messages and messages the user hid are left out.
+*/
+func (r *MessageRepo) SearchMessages(ctx context.Context, qr Queryer, userID, withID int, query string, beforeID, limit int) ([]*model.MessageSearchResult, error) {
+	qry := `SELECT m.id, m.sender_id, COALESCE(m.receiver_id, 0), m.conversation_id, m.timestamp, ts_headline('simple', m.content, q, $6)
+		FROM message AS m, websearch_to_tsquery('simple', $2) AS q
+		WHERE m.search @@ q
+			AND (
+				(m.conversation_id IS NULL AND (m.sender_id = $1 OR m.receiver_id = $1))
+				OR EXISTS (SELECT 1 FROM conversation_member AS cm
+					WHERE cm.conversation_id = m.conversation_id AND cm.user_id = $1 AND cm.joined_at <= m.timestamp)
+			)
+			AND ($3 = 0 OR (m.conversation_id IS NULL AND (m.sender_id = $3 OR m.receiver_id = $3)))
+			AND ($4 = 0 OR m.id < $4)
+			AND m.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM message_hidden AS h WHERE h.message_id = m.id AND h.user_id = $1)
+		ORDER BY m.id DESC
+		LIMIT $5`
+
+	rows, err := qr.Query(ctx, qry, userID, query, withID, beforeID, limit, searchHeadlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to search messages : %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]*model.MessageSearchResult, 0, limit)
+	for rows.Next() {
+		var sr model.MessageSearchResult
+		if err := rows.Scan(&sr.ID, &sr.SenderID, &sr.ReceiverID, &sr.ConversationID, &sr.Timestamp, &sr.Snippet); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan search row : %w", err)
+		}
+
+		results = append(results, &sr)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return results, nil
+}
+
+func (r *MessageRepo) UpdateMessageContent(ctx context.Context, qr Queryer, m *model.Message) error {
+	qry := `UPDATE message SET content = $1, edited_at = $2 WHERE id = $3 AND deleted_at IS NULL`
+
+	result, err := qr.Exec(ctx, qry, m.Content, m.EditedAt, m.ID)
+	if err != nil {
+		return fmt.Errorf("repo: failed to update message : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+// Deletes the message for both participants, the content is cleared but the row is kept
+func (r *MessageRepo) DeleteMessage(ctx context.Context, qr Queryer, messageID int, deletedAt time.Time) error {
+	qry := `UPDATE message SET content = NULL, deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	result, err := qr.Exec(ctx, qry, deletedAt, messageID)
+	if err != nil {
+		return fmt.Errorf("repo: failed to delete message : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+// Hides the message from the user's history, the other participant still sees it
+func (r *MessageRepo) HideMessage(ctx context.Context, qr Queryer, messageID, userID int) error {
+	qry := `INSERT INTO message_hidden (message_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	if _, err := qr.Exec(ctx, qry, messageID, userID); err != nil {
+		return fmt.Errorf("repo: failed to hide message : %w", err)
+	}
+
+	return nil
+}
+
+func (r *MessageRepo) CreateRevision(ctx context.Context, qr Queryer, rev *model.MessageRevision) error {
+	qry := `INSERT INTO message_revision (message_id, content, action, revised_at) VALUES ($1, $2, $3, $4)`
+
+	if _, err := qr.Exec(ctx, qry, rev.MessageID, rev.Content, rev.Action, rev.RevisedAt); err != nil {
+		return fmt.Errorf("repo: failed to create message revision : %w", err)
+	}
+
+	return nil
+}
+
+func (r *MessageRepo) AddReaction(ctx context.Context, qr Queryer, rc *model.Reaction) error {
+	qry := `INSERT INTO message_reaction (message_id, user_id, emoji, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+
+	if _, err := qr.Exec(ctx, qry, rc.MessageID, rc.UserID, rc.Emoji, rc.CreatedAt); err != nil {
+		return fmt.Errorf("repo: failed to add reaction : %w", err)
+	}
+
+	return nil
+}
+
+func (r *MessageRepo) RemoveReaction(ctx context.Context, qr Queryer, rc *model.Reaction) error {
+	qry := `DELETE FROM message_reaction WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+
+	result, err := qr.Exec(ctx, qry, rc.MessageID, rc.UserID, rc.Emoji)
+	if err != nil {
+		return fmt.Errorf("repo: failed to remove reaction : %w", err)
+	}
+
+	if result.RowsAffected() != 1 {
+		return ErrNoRowsFound
+	}
+
+	return nil
+}
+
+/*
+Aggregates the reactions of the given messages, keyed by message ID.
+
+The userID is used to flag the reactions the user is part of.
+*/
+func (r *MessageRepo) GetReactionCounts(ctx context.Context, qr Queryer, messageIDs []int, userID int) (map[int][]*model.ReactionCount, error) {
+	qry := `SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reaction
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)`
+
+	rows, err := qr.Query(ctx, qry, messageIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get reaction counts : %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int][]*model.ReactionCount, len(messageIDs))
+	for rows.Next() {
+		var mid int
+		var rc model.ReactionCount
+		if err := rows.Scan(&mid, &rc.Emoji, &rc.Count, &rc.Reacted); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan reaction row : %w", err)
+		}
+
+		counts[mid] = append(counts[mid], &rc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: error during iteration : %w", err)
+	}
+
+	return counts, nil
+}
+
+// The attachment columns of a LEFT JOIN, every column is null when the message has no attachment
+type nullableAttachment struct {
+	ID           *int
+	UploaderID   *int
+	StorageKey   *string
+	ThumbnailKey *string
+	FileName     *string
+	MimeType     *string
+	Size         *int64
+	CreatedAt    *time.Time
+}
+
+func (a *nullableAttachment) fields() []any {
+	return []any{&a.ID, &a.UploaderID, &a.StorageKey, &a.ThumbnailKey, &a.FileName, &a.MimeType, &a.Size, &a.CreatedAt}
+}
+
+func (a *nullableAttachment) toModel(messageID int) *model.Attachment {
+	if a.ID == nil {
+		return nil
+	}
+
+	return &model.Attachment{
+		ID:           *a.ID,
+		UploaderID:   *a.UploaderID,
+		MessageID:    &messageID,
+		StorageKey:   *a.StorageKey,
+		ThumbnailKey: a.ThumbnailKey,
+		FileName:     *a.FileName,
+		MimeType:     *a.MimeType,
+		Size:         *a.Size,
+		CreatedAt:    *a.CreatedAt,
+	}
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+var (
+	ErrDuplicateReport = errors.New("repo: session already reported")
+	ErrDuplicateRating = errors.New("repo: session already rated")
+)
+
+type RandomRepo struct{}
+
+func NewRandomRepository() RandomRepository {
+	return &RandomRepo{}
+}
+
+func (r *RandomRepo) CreateReport(ctx context.Context, qr Queryer, rp *model.RandomReport) (int, error) {
+	qry := `INSERT INTO random_report (session_id, reporter_id, reported_id, reason, transcript, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	var rid int // Report ID
+	if err := qr.QueryRow(ctx, qry, rp.SessionID, rp.ReporterID, rp.ReportedID, rp.Reason, rp.Transcript, rp.CreatedAt).Scan(&rid); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return 0, ErrDuplicateReport
+		}
+
+		return 0, fmt.Errorf("repo: failed to create random report : %w", err)
+	}
+
+	return rid, nil
+}
+
+func (r *RandomRepo) CreateRating(ctx context.Context, qr Queryer, rt *model.RandomRating) error {
+	qry := `INSERT INTO random_rating (session_id, rater_id, rated_id, positive, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	if _, err := qr.Exec(ctx, qry, rt.SessionID, rt.RaterID, rt.RatedID, rt.Positive, rt.CreatedAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return ErrDuplicateRating
+		}
+
+		return fmt.Errorf("repo: failed to create random rating : %w", err)
+	}
+
+	return nil
+}
+
+// Returns how many thumbs up and down the user received
+func (r *RandomRepo) GetRatingCounts(ctx context.Context, qr Queryer, userID int) (int, int, error) {
+	qry := `SELECT COUNT(*) FILTER (WHERE positive), COUNT(*) FILTER (WHERE NOT positive)
+		FROM random_rating
+		WHERE rated_id = $1`
+
+	var up, down int
+	if err := qr.QueryRow(ctx, qry, userID).Scan(&up, &down); err != nil {
+		return 0, 0, fmt.Errorf("repo: failed to count random ratings : %w", err)
+	}
+
+	return up, down, nil
+}
+
+/*
+Saves the session, once when it starts and again when it ends.
+
+Both saves are upserts so the end can be written before the start without losing either,
+an end that is already saved is never cleared.
+*/
+func (r *RandomRepo) SaveSession(ctx context.Context, qr Queryer, s *model.RandomSession) error {
+	qry := `INSERT INTO random_session (id, user_a, user_b, interests, started_at, ended_at, end_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			ended_at = COALESCE(random_session.ended_at, EXCLUDED.ended_at),
+			end_reason = COALESCE(random_session.end_reason, EXCLUDED.end_reason)`
+
+	interests := s.Interests
+	if interests == nil {
+		interests = []string{}
+	}
+
+	if _, err := qr.Exec(ctx, qry, s.ID, s.UserA, s.UserB, interests, s.StartedAt, s.EndedAt, s.EndReason); err != nil {
+		return fmt.Errorf("repo: failed to save random session : %w", err)
+	}
+
+	return nil
+}
+
+func (r *RandomRepo) GetSession(ctx context.Context, qr Queryer, sessionID string) (*model.RandomSession, error) {
+	qry := `SELECT id, user_a, user_b, interests, started_at, ended_at, end_reason
+		FROM random_session
+		WHERE id = $1`
+
+	s := new(model.RandomSession)
+	if err := qr.QueryRow(ctx, qry, sessionID).Scan(&s.ID, &s.UserA, &s.UserB, &s.Interests, &s.StartedAt, &s.EndedAt, &s.EndReason); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get random session : %w", err)
+	}
+
+	return s, nil
+}
+
+// Returns the sessions the user took part in, newest first
+func (r *RandomRepo) GetSessionsByUser(ctx context.Context, qr Queryer, userID, limit, offset int) ([]*model.RandomSession, error) {
+	qry := `SELECT id, user_a, user_b, interests, started_at, ended_at, end_reason
+		FROM random_session
+		WHERE user_a = $1 OR user_b = $1
+		ORDER BY started_at DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := qr.Query(ctx, qry, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get random sessions : %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.RandomSession, 0, limit)
+	for rows.Next() {
+		s := new(model.RandomSession)
+		if err := rows.Scan(&s.ID, &s.UserA, &s.UserB, &s.Interests, &s.StartedAt, &s.EndedAt, &s.EndReason); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan random session : %w", err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: rows error : %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Returns the sessions started after since, oldest first
+func (r *RandomRepo) GetSessionsSince(ctx context.Context, qr Queryer, since time.Time) ([]*model.RandomSession, error) {
+	qry := `SELECT id, user_a, user_b, interests, started_at, ended_at, end_reason
+		FROM random_session
+		WHERE started_at > $1
+		ORDER BY started_at ASC`
+
+	rows, err := qr.Query(ctx, qry, since)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to get random sessions : %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.RandomSession, 0)
+	for rows.Next() {
+		s := new(model.RandomSession)
+		if err := rows.Scan(&s.ID, &s.UserA, &s.UserB, &s.Interests, &s.StartedAt, &s.EndedAt, &s.EndReason); err != nil {
+			return nil, fmt.Errorf("repo: failed to scan random session : %w", err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo: rows error : %w", err)
+	}
+
+	return sessions, nil
+}
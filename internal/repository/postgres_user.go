@@ -77,6 +77,26 @@ func (r *UserRepo) GetUserWithCountryByUsername(ctx context.Context, qr Queryer,
 	return userInfo, nil
 }
 
+// Same as GetUserWithCountryByUsername but looks the user up by ID
+func (r *UserRepo) GetUserWithCountryByID(ctx context.Context, qr Queryer, userID int) (*dto.UserWithCountryDTO, error) {
+	qry := `SELECT u.id, u.username, u.email, u.password, u.bio, u.bdate, c.iso_code_3, c.name, a.url
+		FROM "app_user" AS u
+		JOIN "country" AS c ON u.country_id = c.id
+		LEFT JOIN avatar AS a ON u.avatar_id = a.id
+		WHERE u.id = $1`
+
+	userInfo := new(dto.UserWithCountryDTO)
+	if err := qr.QueryRow(ctx, qry, userID).Scan(&userInfo.ID, &userInfo.Username, &userInfo.Email, &userInfo.Password, &userInfo.Bio, &userInfo.Bdate, &userInfo.CountryCode, &userInfo.CountryName, &userInfo.AvatarURL); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRowsFound
+		}
+
+		return nil, fmt.Errorf("repo: failed to get user: %w", err)
+	}
+
+	return userInfo, nil
+}
+
 /*
  Checks if a slice of given userIDs is present in the database
 
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -13,6 +14,7 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, qr Queryer, user *model.User) (id int, err error)
 	UpdateAvatar(ctx context.Context, qr Queryer, user *model.User) (err error)
 	GetUserWithCountryByUsername(ctx context.Context, qr Queryer, username string) (*dto.UserWithCountryDTO, error)
+	GetUserWithCountryByID(ctx context.Context, qr Queryer, userID int) (*dto.UserWithCountryDTO, error)
 	CheckUsers(ctx context.Context, qr Queryer, userIDs ...int) (bool, error)
 }
 
@@ -31,11 +33,52 @@ type FriendshipRepository interface {
 	UpdateFriendshipStatus(ctx context.Context, qr Queryer, fr *model.Friendship) error
 	GetFriends(ctx context.Context, qr Queryer, userID, page int) ([]*dto.FriendDetails, error)
 	CheckRelationship(ctx context.Context, qr Queryer, fr *model.Friendship) (bool, error)
+	GetFriendshipStatus(ctx context.Context, qr Queryer, fr *model.Friendship) (model.FriendshipStatus, error)
+	GetRelatedUserIDs(ctx context.Context, qr Queryer, userID int) ([]int, error)
 }
 
 type MessageRepository interface {
-	CreateMessage(ctx context.Context, qr Queryer, ch *model.Message) error
+	CreateMessage(ctx context.Context, qr Queryer, ch *model.Message) (id int, err error)
 	GetMessages(ctx context.Context, qr Queryer, uidOne, uidTwo, page int) ([]*model.Message, error)
+	GetConversationMessages(ctx context.Context, qr Queryer, conversationID int, since time.Time, page int) ([]*model.Message, error)
+	GetMessagesAfter(ctx context.Context, qr Queryer, receiverID, afterID, limit int) ([]*model.Message, error)
+	SearchMessages(ctx context.Context, qr Queryer, userID, withID int, query string, beforeID, limit int) ([]*model.MessageSearchResult, error)
+	GetMessage(ctx context.Context, qr Queryer, messageID int) (*model.Message, error)
+	HasMessages(ctx context.Context, qr Queryer, uidOne, uidTwo int) (bool, error)
+	UpdateMessageContent(ctx context.Context, qr Queryer, m *model.Message) error
+	DeleteMessage(ctx context.Context, qr Queryer, messageID int, deletedAt time.Time) error
+	HideMessage(ctx context.Context, qr Queryer, messageID, userID int) error
+	CreateRevision(ctx context.Context, qr Queryer, rev *model.MessageRevision) error
+	AddReaction(ctx context.Context, qr Queryer, rc *model.Reaction) error
+	RemoveReaction(ctx context.Context, qr Queryer, rc *model.Reaction) error
+	GetReactionCounts(ctx context.Context, qr Queryer, messageIDs []int, userID int) (map[int][]*model.ReactionCount, error)
+}
+
+type ConversationRepository interface {
+	CreateConversation(ctx context.Context, qr Queryer, c *model.Conversation) (id int, err error)
+	GetConversation(ctx context.Context, qr Queryer, conversationID int) (*model.Conversation, error)
+	GetConversations(ctx context.Context, qr Queryer, userID int) ([]*model.Conversation, error)
+	AddMember(ctx context.Context, qr Queryer, m *model.ConversationMember) error
+	GetMember(ctx context.Context, qr Queryer, conversationID, userID int) (*model.ConversationMember, error)
+	GetMembers(ctx context.Context, qr Queryer, conversationID int) ([]*model.ConversationMember, error)
+	UpdateMemberRole(ctx context.Context, qr Queryer, m *model.ConversationMember) error
+	RemoveMember(ctx context.Context, qr Queryer, conversationID, userID int) error
+}
+
+type AttachmentRepository interface {
+	CreateAttachment(ctx context.Context, qr Queryer, a *model.Attachment) (id int, err error)
+	GetAttachment(ctx context.Context, qr Queryer, attachmentID int) (*model.Attachment, error)
+	LinkAttachment(ctx context.Context, qr Queryer, attachmentID, messageID, uploaderID int) error
+}
+
+type RandomRepository interface {
+	CreateReport(ctx context.Context, qr Queryer, rp *model.RandomReport) (id int, err error)
+	CreateRating(ctx context.Context, qr Queryer, rt *model.RandomRating) error
+	GetRatingCounts(ctx context.Context, qr Queryer, userID int) (up, down int, err error)
+	SaveSession(ctx context.Context, qr Queryer, s *model.RandomSession) error
+	GetSessionsByUser(ctx context.Context, qr Queryer, userID, limit, offset int) ([]*model.RandomSession, error)
+	GetSessionsSince(ctx context.Context, qr Queryer, since time.Time) ([]*model.RandomSession, error)
+	GetSession(ctx context.Context, qr Queryer, sessionID string) (*model.RandomSession, error)
 }
 
 type Queryer interface {
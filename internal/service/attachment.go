@@ -0,0 +1,297 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/jlry-dev/whirl/internal/storage"
+	"github.com/nfnt/resize"
+	"golang.org/x/image/webp"
+)
+
+const (
+	MaxAttachmentSize = 10 * 1024 * 1024 // 10MB
+
+	// Thumbnails fit inside a thumbnailSize x thumbnailSize box
+	thumbnailSize = 320
+
+	// Images with more pixels do not get a thumbnail, a small compressed file can decode to gigabytes
+	maxThumbnailPixels = 40_000_000
+)
+
+// The accepted attachment types mapped to the extension used for the stored file
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+	"audio/mpeg":      ".mp3",
+	"video/mp4":       ".mp4",
+}
+
+var (
+	ErrAttachmentNotExist     = errors.New("service: attachment does not exist")
+	ErrAttachmentTooLarge     = errors.New("service: attachment exceeds the max size")
+	ErrUnsupportedAttachment  = errors.New("service: attachment type not supported")
+	ErrAttachmentAccessDenied = errors.New("service: user cannot access the attachment")
+)
+
+type AttachmentService interface {
+	Upload(ctx context.Context, data *dto.UploadAttachmentDTO) (*dto.UploadAttachmentSuccessDTO, error)
+	Open(ctx context.Context, userID, attachmentID int, thumbnail bool) (*dto.AttachmentFileDTO, error)
+}
+
+type AttachmentSrv struct {
+	logger     *slog.Logger
+	attachRepo repository.AttachmentRepository
+	msgRepo    repository.MessageRepository
+	store      storage.Storage
+	db         *pgxpool.Pool
+}
+
+func NewAttachmentService(logger *slog.Logger, attachRepo repository.AttachmentRepository, msgRepo repository.MessageRepository, store storage.Storage, db *pgxpool.Pool) AttachmentService {
+	return &AttachmentSrv{
+		logger:     logger,
+		attachRepo: attachRepo,
+		msgRepo:    msgRepo,
+		store:      store,
+		db:         db,
+	}
+}
+
+/*
+Validates and stores an uploaded file, the attachment is linked to a message once it is sent.
+
+The type is sniffed from the content rather than trusting the client, images also get a thumbnail.
+*/
+func (srv *AttachmentSrv) Upload(ctx context.Context, data *dto.UploadAttachmentDTO) (*dto.UploadAttachmentSuccessDTO, error) {
+	// Read one byte past the limit to know if the file is too large
+	buf, err := io.ReadAll(io.LimitReader(data.File, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to read attachment : %w", err)
+	}
+
+	if len(buf) > MaxAttachmentSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	if len(buf) == 0 {
+		return nil, ErrUnsupportedAttachment
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(buf))
+	if err != nil {
+		return nil, ErrUnsupportedAttachment
+	}
+
+	ext, ok := attachmentTypes[mimeType]
+	if !ok {
+		return nil, ErrUnsupportedAttachment
+	}
+
+	name := uuid.New().String()
+	a := &model.Attachment{
+		UploaderID: data.UserID,
+		StorageKey: "attachments/" + name + ext,
+		FileName:   attachmentFileName(data.FileName, ext),
+		MimeType:   mimeType,
+		Size:       int64(len(buf)),
+		CreatedAt:  time.Now(),
+	}
+
+	if err := srv.store.Put(ctx, a.StorageKey, bytes.NewReader(buf)); err != nil {
+		return nil, fmt.Errorf("service: failed to store attachment : %w", err)
+	}
+
+	thumb, thumbExt, err := thumbnail(buf, mimeType)
+	if err != nil {
+		// The attachment is still usable without a thumbnail
+		srv.logger.Error("attachment upload: failed to create thumbnail", slog.String("error", err.Error()))
+	}
+
+	if thumb != nil {
+		thumbKey := "attachments/" + name + "_thumb" + thumbExt
+		if err := srv.store.Put(ctx, thumbKey, thumb); err != nil {
+			srv.logger.Error("attachment upload: failed to store thumbnail", slog.String("error", err.Error()))
+		} else {
+			a.ThumbnailKey = &thumbKey
+		}
+	}
+
+	id, err := srv.attachRepo.CreateAttachment(ctx, srv.db, a)
+	if err != nil {
+		srv.removeObjects(a)
+		return nil, fmt.Errorf("service: failed to create attachment : %w", err)
+	}
+	a.ID = id
+
+	return &dto.UploadAttachmentSuccessDTO{
+		Attachment: dto.NewAttachmentDTO(a),
+	}, nil
+}
+
+/*
+Opens the attachment or its thumbnail for reading.
+
+Before it is sent only the uploader can open an attachment, afterwards both participants of the message can
+until the message is deleted for everyone.
+*/
+func (srv *AttachmentSrv) Open(ctx context.Context, userID, attachmentID int, thumbnail bool) (*dto.AttachmentFileDTO, error) {
+	a, err := srv.attachRepo.GetAttachment(ctx, srv.db, attachmentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrAttachmentNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve attachment : %w", err)
+	}
+
+	if a.MessageID == nil {
+		if a.UploaderID != userID {
+			return nil, ErrAttachmentAccessDenied
+		}
+	} else {
+		m, err := srv.msgRepo.GetMessage(ctx, srv.db, *a.MessageID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoRowsFound) {
+				return nil, ErrAttachmentNotExist
+			}
+
+			return nil, fmt.Errorf("service: failed to retrieve attachment message : %w", err)
+		}
+
+		if m.SenderID != userID && m.ReceiverID != userID {
+			return nil, ErrAttachmentAccessDenied
+		}
+
+		// Deleting the message for everyone removes its attachment, the uploader included
+		if m.DeletedAt != nil {
+			return nil, ErrAttachmentNotExist
+		}
+	}
+
+	key := a.StorageKey
+	mimeType := a.MimeType
+	if thumbnail {
+		if a.ThumbnailKey == nil {
+			return nil, ErrAttachmentNotExist
+		}
+
+		key = *a.ThumbnailKey
+		mimeType = mime.TypeByExtension(filepath.Ext(key))
+	}
+
+	content, err := srv.store.Open(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, ErrAttachmentNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to open attachment : %w", err)
+	}
+
+	return &dto.AttachmentFileDTO{
+		Content:   content,
+		FileName:  a.FileName,
+		MimeType:  mimeType,
+		CreatedAt: a.CreatedAt,
+	}, nil
+}
+
+func (srv *AttachmentSrv) removeObjects(a *model.Attachment) {
+	if err := srv.store.Delete(context.Background(), a.StorageKey); err != nil {
+		srv.logger.Error("attachment: failed to clean up stored file", slog.String("error", err.Error()))
+	}
+
+	if a.ThumbnailKey != nil {
+		if err := srv.store.Delete(context.Background(), *a.ThumbnailKey); err != nil {
+			srv.logger.Error("attachment: failed to clean up stored thumbnail", slog.String("error", err.Error()))
+		}
+	}
+}
+
+/*
+Creates a thumbnail for the decodable image types.
+
+Returns a nil reader for types that do not get a thumbnail. The dimensions are read from the header
+before decoding, images over maxThumbnailPixels are refused.
+*/
+func thumbnail(buf []byte, mimeType string) (io.Reader, string, error) {
+	var decode func(io.Reader) (image.Image, error)
+	var decodeConfig func(io.Reader) (image.Config, error)
+
+	switch mimeType {
+	case "image/jpeg":
+		decode, decodeConfig = jpeg.Decode, jpeg.DecodeConfig
+	case "image/png":
+		decode, decodeConfig = png.Decode, png.DecodeConfig
+	case "image/gif":
+		decode, decodeConfig = gif.Decode, gif.DecodeConfig
+	case "image/webp":
+		decode, decodeConfig = webp.Decode, webp.DecodeConfig
+	default:
+		return nil, "", nil
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", fmt.Errorf("service: failed to decode image config : %w", err)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return nil, "", fmt.Errorf("service: image of %dx%d is too large for a thumbnail", cfg.Width, cfg.Height)
+	}
+
+	img, err := decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, "", fmt.Errorf("service: failed to decode image : %w", err)
+	}
+
+	thumb := resize.Thumbnail(thumbnailSize, thumbnailSize, img, resize.Bilinear)
+
+	var out bytes.Buffer
+	if mimeType == "image/png" {
+		// Keep the transparency
+		err = png.Encode(&out, thumb)
+		return &out, ".png", err
+	}
+
+	err = jpeg.Encode(&out, thumb, &jpeg.Options{
+		Quality: 80,
+	})
+	return &out, ".jpg", err
+}
+
+// Keeps the base name the client gave, falling back to a generic one
+func attachmentFileName(name, ext string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "attachment" + ext
+	}
+
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+
+	return name
+}
@@ -0,0 +1,479 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+)
+
+const (
+	MaxConversationNameLen = 64
+	MaxConversationMembers = 50
+)
+
+var (
+	ErrConversationNotExist      = errors.New("service: conversation does not exist")
+	ErrNotConversationMember     = errors.New("service: user is not a member of the conversation")
+	ErrAlreadyConversationMember = errors.New("service: user is already a member of the conversation")
+	ErrConversationForbidden     = errors.New("service: member role does not allow the action")
+	ErrInvalidConversationName   = errors.New("service: invalid conversation name")
+	ErrInvalidConversationRole   = errors.New("service: invalid conversation role")
+	ErrConversationFull          = errors.New("service: conversation has reached the max members")
+	ErrNotFriends                = errors.New("service: users are not friends")
+	ErrKickSelf                  = errors.New("service: members cannot kick themselves")
+)
+
+type ConversationService interface {
+	CreateConversation(ctx context.Context, data *dto.CreateConversationDTO) (*dto.ConversationDTO, error)
+	RetrieveConversation(ctx context.Context, conversationID, userID int) (*dto.ConversationDTO, error)
+	RetrieveConversations(ctx context.Context, userID int) (*dto.ConversationsDTO, error)
+	InviteMember(ctx context.Context, data *dto.ConversationMemberDTO) (*model.ConversationMember, error)
+	KickMember(ctx context.Context, data *dto.ConversationMemberDTO) error
+	ChangeMemberRole(ctx context.Context, data *dto.ConversationMemberDTO) (*model.ConversationMember, error)
+	LeaveConversation(ctx context.Context, conversationID, userID int) error
+	SendMessage(ctx context.Context, data *dto.GroupMessageDTO) (*model.Message, []int, error)
+	RetrieveMessages(ctx context.Context, conversationID, userID, page int) (*dto.MessagesDTO, error)
+	MemberIDs(ctx context.Context, conversationID int) ([]int, error)
+}
+
+type ConversationSrv struct {
+	logger   *slog.Logger
+	convRepo repository.ConversationRepository
+	msgRepo  repository.MessageRepository
+	frRepo   repository.FriendshipRepository
+	db       *pgxpool.Pool
+}
+
+func NewConversationService(logger *slog.Logger, convRepo repository.ConversationRepository, msgRepo repository.MessageRepository, frRepo repository.FriendshipRepository, db *pgxpool.Pool) ConversationService {
+	return &ConversationSrv{
+		logger:   logger,
+		convRepo: convRepo,
+		msgRepo:  msgRepo,
+		frRepo:   frRepo,
+		db:       db,
+	}
+}
+
+/*
+Creates a group conversation owned by the requester.
+
+The initial members have to be friends of the owner, duplicates and the owner itself are ignored.
+*/
+func (srv *ConversationSrv) CreateConversation(ctx context.Context, data *dto.CreateConversationDTO) (*dto.ConversationDTO, error) {
+	name := strings.TrimSpace(data.Name)
+	if name == "" || utf8.RuneCountInString(name) > MaxConversationNameLen {
+		return nil, ErrInvalidConversationName
+	}
+
+	memberIDs := make([]int, 0, len(data.Members))
+	seen := make(map[int]bool, len(data.Members))
+	for _, id := range data.Members {
+		if id == data.OwnerID || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		memberIDs = append(memberIDs, id)
+	}
+
+	if len(memberIDs)+1 > MaxConversationMembers {
+		return nil, ErrConversationFull
+	}
+
+	for _, id := range memberIDs {
+		if err := srv.checkFriends(ctx, data.OwnerID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	c := &model.Conversation{
+		Name:      name,
+		CreatedBy: data.OwnerID,
+		CreatedAt: now,
+	}
+
+	tx, err := srv.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to begin transaction : %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	c.ID, err = srv.convRepo.CreateConversation(ctx, tx, c)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create conversation : %w", err)
+	}
+
+	members := make([]*model.ConversationMember, 0, len(memberIDs)+1)
+	members = append(members, &model.ConversationMember{
+		ConversationID: c.ID,
+		UserID:         data.OwnerID,
+		Role:           model.RoleOwner,
+		JoinedAt:       now,
+	})
+
+	for _, id := range memberIDs {
+		members = append(members, &model.ConversationMember{
+			ConversationID: c.ID,
+			UserID:         id,
+			Role:           model.RoleMember,
+			JoinedAt:       now,
+		})
+	}
+
+	for _, m := range members {
+		if err := srv.convRepo.AddMember(ctx, tx, m); err != nil {
+			return nil, fmt.Errorf("service: failed to add conversation member : %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to create conversation : %w", err)
+	}
+
+	return &dto.ConversationDTO{
+		Conversation: c,
+		Members:      members,
+	}, nil
+}
+
+// Retrieves the conversation and its members, only members can see them
+func (srv *ConversationSrv) RetrieveConversation(ctx context.Context, conversationID, userID int) (*dto.ConversationDTO, error) {
+	if _, err := srv.getMember(ctx, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	c, err := srv.convRepo.GetConversation(ctx, srv.db, conversationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrConversationNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve conversation : %w", err)
+	}
+
+	members, err := srv.convRepo.GetMembers(ctx, srv.db, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve conversation members : %w", err)
+	}
+
+	return &dto.ConversationDTO{
+		Conversation: c,
+		Members:      members,
+	}, nil
+}
+
+func (srv *ConversationSrv) RetrieveConversations(ctx context.Context, userID int) (*dto.ConversationsDTO, error) {
+	conversations, err := srv.convRepo.GetConversations(ctx, srv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve conversations : %w", err)
+	}
+
+	return &dto.ConversationsDTO{
+		Conversations: conversations,
+	}, nil
+}
+
+/*
+Adds a user to the conversation as a member, only owners and admins can invite.
+
+The invited user has to be a friend of the inviter. The new member only sees the messages sent after joining.
+*/
+func (srv *ConversationSrv) InviteMember(ctx context.Context, data *dto.ConversationMemberDTO) (*model.ConversationMember, error) {
+	actor, err := srv.getMember(ctx, data.ConversationID, data.ActorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.Role.Rank() < model.RoleAdmin.Rank() {
+		return nil, ErrConversationForbidden
+	}
+
+	members, err := srv.convRepo.GetMembers(ctx, srv.db, data.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve conversation members : %w", err)
+	}
+
+	for _, m := range members {
+		if m.UserID == data.UserID {
+			return nil, ErrAlreadyConversationMember
+		}
+	}
+
+	if len(members) >= MaxConversationMembers {
+		return nil, ErrConversationFull
+	}
+
+	if err := srv.checkFriends(ctx, data.ActorID, data.UserID); err != nil {
+		return nil, err
+	}
+
+	m := &model.ConversationMember{
+		ConversationID: data.ConversationID,
+		UserID:         data.UserID,
+		Role:           model.RoleMember,
+		JoinedAt:       time.Now(),
+	}
+
+	if err := srv.convRepo.AddMember(ctx, srv.db, m); err != nil {
+		if errors.Is(err, repository.ErrDuplicateMember) {
+			return nil, ErrAlreadyConversationMember
+		}
+
+		return nil, fmt.Errorf("service: failed to add conversation member : %w", err)
+	}
+
+	return m, nil
+}
+
+// Removes a member from the conversation, the actor has to outrank the member being kicked
+func (srv *ConversationSrv) KickMember(ctx context.Context, data *dto.ConversationMemberDTO) error {
+	if data.ActorID == data.UserID {
+		return ErrKickSelf
+	}
+
+	actor, err := srv.getMember(ctx, data.ConversationID, data.ActorID)
+	if err != nil {
+		return err
+	}
+
+	target, err := srv.getMember(ctx, data.ConversationID, data.UserID)
+	if err != nil {
+		return err
+	}
+
+	if actor.Role.Rank() < model.RoleAdmin.Rank() || actor.Role.Rank() <= target.Role.Rank() {
+		return ErrConversationForbidden
+	}
+
+	if err := srv.convRepo.RemoveMember(ctx, srv.db, data.ConversationID, data.UserID); err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return ErrNotConversationMember
+		}
+
+		return fmt.Errorf("service: failed to remove conversation member : %w", err)
+	}
+
+	return nil
+}
+
+// Promotes a member to admin or demotes an admin to member, only the owner can change roles
+func (srv *ConversationSrv) ChangeMemberRole(ctx context.Context, data *dto.ConversationMemberDTO) (*model.ConversationMember, error) {
+	role := model.ConversationRole(data.Role)
+	if role != model.RoleAdmin && role != model.RoleMember {
+		return nil, ErrInvalidConversationRole
+	}
+
+	actor, err := srv.getMember(ctx, data.ConversationID, data.ActorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.Role != model.RoleOwner || data.ActorID == data.UserID {
+		return nil, ErrConversationForbidden
+	}
+
+	target, err := srv.getMember(ctx, data.ConversationID, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	target.Role = role
+	if err := srv.convRepo.UpdateMemberRole(ctx, srv.db, target); err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrNotConversationMember
+		}
+
+		return nil, fmt.Errorf("service: failed to update conversation member role : %w", err)
+	}
+
+	return target, nil
+}
+
+/*
+Removes the user from the conversation.
+
+When the owner leaves, ownership goes to the earliest admin to join, or to the earliest member when there are no admins.
+*/
+func (srv *ConversationSrv) LeaveConversation(ctx context.Context, conversationID, userID int) error {
+	member, err := srv.getMember(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+
+	if member.Role != model.RoleOwner {
+		if err := srv.convRepo.RemoveMember(ctx, srv.db, conversationID, userID); err != nil {
+			if errors.Is(err, repository.ErrNoRowsFound) {
+				return ErrNotConversationMember
+			}
+
+			return fmt.Errorf("service: failed to remove conversation member : %w", err)
+		}
+
+		return nil
+	}
+
+	tx, err := srv.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("service: failed to begin transaction : %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	members, err := srv.convRepo.GetMembers(ctx, tx, conversationID)
+	if err != nil {
+		return fmt.Errorf("service: failed to retrieve conversation members : %w", err)
+	}
+
+	// Members are ordered by join time so the first match is the earliest
+	var successor *model.ConversationMember
+	for _, m := range members {
+		if m.UserID == userID {
+			continue
+		}
+
+		if successor == nil || (m.Role == model.RoleAdmin && successor.Role != model.RoleAdmin) {
+			successor = m
+		}
+	}
+
+	if successor != nil {
+		successor.Role = model.RoleOwner
+		if err := srv.convRepo.UpdateMemberRole(ctx, tx, successor); err != nil {
+			return fmt.Errorf("service: failed to transfer conversation ownership : %w", err)
+		}
+	}
+
+	if err := srv.convRepo.RemoveMember(ctx, tx, conversationID, userID); err != nil {
+		return fmt.Errorf("service: failed to remove conversation member : %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("service: failed to leave conversation : %w", err)
+	}
+
+	return nil
+}
+
+/*
+Stores a message sent to a group conversation.
+
+Returns the stored message with the IDs of the other members it has to be delivered to.
+*/
+func (srv *ConversationSrv) SendMessage(ctx context.Context, data *dto.GroupMessageDTO) (*model.Message, []int, error) {
+	if strings.TrimSpace(data.Content) == "" {
+		return nil, nil, ErrEmptyMessage
+	}
+
+	if _, err := srv.getMember(ctx, data.ConversationID, data.From); err != nil {
+		return nil, nil, err
+	}
+
+	m := &model.Message{
+		SenderID:       data.From,
+		ConversationID: &data.ConversationID,
+		Content:        data.Content,
+		Timestamp:      data.Timestamp,
+	}
+
+	id, err := srv.msgRepo.CreateMessage(ctx, srv.db, m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("service: error storing group message : %w", err)
+	}
+	m.ID = id
+
+	memberIDs, err := srv.MemberIDs(ctx, data.ConversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recipients := make([]int, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if id != data.From {
+			recipients = append(recipients, id)
+		}
+	}
+
+	return m, recipients, nil
+}
+
+// Retrieves the history of the conversation starting from the time the user joined it
+func (srv *ConversationSrv) RetrieveMessages(ctx context.Context, conversationID, userID, page int) (*dto.MessagesDTO, error) {
+	member, err := srv.getMember(ctx, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	messages, err := srv.msgRepo.GetConversationMessages(ctx, srv.db, conversationID, member.JoinedAt, page)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve conversation messages : %w", err)
+	}
+
+	return &dto.MessagesDTO{
+		Messages: dto.NewHistoryMessages(messages),
+	}, nil
+}
+
+func (srv *ConversationSrv) MemberIDs(ctx context.Context, conversationID int) ([]int, error) {
+	members, err := srv.convRepo.GetMembers(ctx, srv.db, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve conversation members : %w", err)
+	}
+
+	ids := make([]int, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.UserID)
+	}
+
+	return ids, nil
+}
+
+func (srv *ConversationSrv) getMember(ctx context.Context, conversationID, userID int) (*model.ConversationMember, error) {
+	m, err := srv.convRepo.GetMember(ctx, srv.db, conversationID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrNotConversationMember
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve conversation member : %w", err)
+	}
+
+	return m, nil
+}
+
+// Only accepted friends can add each other to a conversation
+func (srv *ConversationSrv) checkFriends(ctx context.Context, userID, friendID int) error {
+	status, err := srv.frRepo.GetFriendshipStatus(ctx, srv.db, &model.Friendship{
+		UID_1: userID,
+		UID_2: friendID,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return ErrNotFriends
+		}
+
+		return fmt.Errorf("service: failed to check friendship : %w", err)
+	}
+
+	if status != model.FriendshipAccepted {
+		return ErrNotFriends
+	}
+
+	return nil
+}
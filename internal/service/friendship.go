@@ -22,6 +22,8 @@ type FriendshipService interface {
 	UpdateFriendshipStatus(context.Context, *dto.FriendshipDTO) (*dto.FrienshipServiceSuccessDTO, error)
 	RetrieveFriends(ctx context.Context, userID, page int) (*dto.FriendsDetailsResponse, error)
 	CheckStatus(context.Context, *dto.FriendshipDTO) (bool, error)
+	AreFriends(context.Context, *dto.FriendshipDTO) (bool, error)
+	RelatedUsers(ctx context.Context, userID int) (map[int]bool, error)
 }
 
 func NewFriendshipService(validate validator.Validate, logger *slog.Logger, frRepo repository.FriendshipRepository, userRepo *repository.UserRepository, db *pgxpool.Pool) FriendshipService {
@@ -169,3 +171,39 @@ func (srv *FriendshipSrv) CheckStatus(ctx context.Context, data *dto.FriendshipD
 
 	return exists, nil
 }
+
+// Reports if the two users are friends, a blocked friendship does not count
+func (srv *FriendshipSrv) AreFriends(ctx context.Context, data *dto.FriendshipDTO) (bool, error) {
+	status, err := srv.frRepo.GetFriendshipStatus(ctx, srv.db, &model.Friendship{
+		UID_1: data.From,
+		UID_2: data.To,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("service: failed to get the friendship status : %w", err)
+	}
+
+	return status == model.FriendshipAccepted, nil
+}
+
+/*
+Returns the users the user has a relationship record with, the same ones CheckStatus reports.
+
+Used to check many pairs with a single query.
+*/
+func (srv *FriendshipSrv) RelatedUsers(ctx context.Context, userID int) (map[int]bool, error) {
+	ids, err := srv.frRepo.GetRelatedUserIDs(ctx, srv.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get related users : %w", err)
+	}
+
+	related := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		related[id] = true
+	}
+
+	return related, nil
+}
@@ -2,9 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"log/slog"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jlry-dev/whirl/internal/model"
@@ -12,39 +17,141 @@ import (
 	"github.com/jlry-dev/whirl/internal/repository"
 )
 
+// How long after sending a message the sender can still edit it
+const MessageEditWindow = 15 * time.Minute
+
+const (
+	DeleteForMe       = "me"
+	DeleteForEveryone = "everyone"
+)
+
+var (
+	ErrMessageNotExist       = errors.New("service: message does not exist")
+	ErrMessageDeleted        = errors.New("service: message has been deleted")
+	ErrNotMessageSender      = errors.New("service: user is not the sender of the message")
+	ErrNotMessageParticipant = errors.New("service: user is not a participant of the message")
+	ErrEditWindowExpired     = errors.New("service: message edit window has expired")
+	ErrEmptyMessage          = errors.New("service: message content is empty")
+	ErrInvalidDeleteScope    = errors.New("service: invalid message delete scope")
+	ErrInvalidReaction       = errors.New("service: invalid reaction emoji")
+	ErrReactionNotExist      = errors.New("service: reaction does not exist")
+	ErrReplyNotExist         = errors.New("service: replied message does not exist")
+	ErrReplyNotInChat        = errors.New("service: replied message belongs to another conversation")
+	ErrInvalidSearchQuery    = errors.New("service: invalid search query")
+)
+
+const (
+	SearchPageSize    = 20
+	maxSearchQueryLen = 200
+)
+
+// An emoji can be several runes long when it has modifiers (skin tone, zero width joiners)
+const maxReactionRunes = 8
+
 type MessageService interface {
-	StoreMessage(ctx context.Context, sender int, receiver int, content string, timestamp time.Time) error
+	StoreMessage(ctx context.Context, data *dto.StoreMessageDTO) (*model.Message, error)
 	RetreiveMessages(ctx context.Context, participantOne, participantTwo, page int) (*dto.MessagesDTO, error)
+	SyncMessages(ctx context.Context, receiver, afterID, limit int) ([]*model.Message, error)
+	HasConversation(ctx context.Context, participantOne, participantTwo int) (bool, error)
+	SearchMessages(ctx context.Context, data *dto.SearchMessagesDTO) (*dto.MessageSearchDTO, error)
+	EditMessage(ctx context.Context, data *dto.EditMessageDTO) (*model.Message, error)
+	DeleteMessage(ctx context.Context, data *dto.DeleteMessageDTO) (*model.Message, error)
+	React(ctx context.Context, data *dto.ReactionDTO) (*model.Message, error)
+	Unreact(ctx context.Context, data *dto.ReactionDTO) (*model.Message, error)
 }
 
 type MessageSrv struct {
-	logger  *slog.Logger
-	msgRepo repository.MessageRepository
-	db      *pgxpool.Pool
+	logger     *slog.Logger
+	msgRepo    repository.MessageRepository
+	attachRepo repository.AttachmentRepository
+	db         *pgxpool.Pool
 }
 
-func NewMessageService(logger *slog.Logger, msgRepo repository.MessageRepository, db *pgxpool.Pool) MessageService {
+func NewMessageService(logger *slog.Logger, msgRepo repository.MessageRepository, attachRepo repository.AttachmentRepository, db *pgxpool.Pool) MessageService {
 	return &MessageSrv{
-		logger:  logger,
-		msgRepo: msgRepo,
-		db:      db,
+		logger:     logger,
+		msgRepo:    msgRepo,
+		attachRepo: attachRepo,
+		db:         db,
 	}
 }
 
-func (srv *MessageSrv) StoreMessage(ctx context.Context, senderID int, receiverID int, content string, timestamp time.Time) error {
+/*
+Stores a direct message and returns it with its ID.
+
+When the message is a reply, the replied message must belong to the same conversation.
+When the message has an attachment, the attachment must be an unsent upload of the sender.
+*/
+func (srv *MessageSrv) StoreMessage(ctx context.Context, data *dto.StoreMessageDTO) (*model.Message, error) {
 	m := &model.Message{
-		SenderID:   senderID,
-		ReceiverID: receiverID,
-		Content:    content,
-		Timestamp:  timestamp,
+		SenderID:   data.From,
+		ReceiverID: data.To,
+		Content:    data.Content,
+		Timestamp:  data.Timestamp,
 	}
 
-	err := srv.msgRepo.CreateMessage(ctx, srv.db, m)
+	if data.ReplyTo != 0 {
+		replied, err := srv.msgRepo.GetMessage(ctx, srv.db, data.ReplyTo)
+		if err != nil {
+			if errors.Is(err, repository.ErrNoRowsFound) {
+				return nil, ErrReplyNotExist
+			}
+
+			return nil, fmt.Errorf("service: error storing message : %w", err)
+		}
+
+		sameChat := (replied.SenderID == data.From && replied.ReceiverID == data.To) ||
+			(replied.SenderID == data.To && replied.ReceiverID == data.From)
+		if !sameChat {
+			return nil, ErrReplyNotInChat
+		}
+
+		m.ReplyTo = &replied.ID
+	}
+
+	if data.AttachmentID == 0 {
+		id, err := srv.msgRepo.CreateMessage(ctx, srv.db, m)
+		if err != nil {
+			return nil, fmt.Errorf("service: error storing message : %w", err)
+		}
+
+		m.ID = id
+		return m, nil
+	}
+
+	tx, err := srv.db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("service: error storing message : %w", err)
+		return nil, fmt.Errorf("service: failed to begin transaction : %w", err)
 	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
 
-	return nil
+	id, err := srv.msgRepo.CreateMessage(ctx, tx, m)
+	if err != nil {
+		return nil, fmt.Errorf("service: error storing message : %w", err)
+	}
+	m.ID = id
+
+	err = srv.attachRepo.LinkAttachment(ctx, tx, data.AttachmentID, m.ID, data.From)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrAttachmentNotExist
+		}
+
+		return nil, fmt.Errorf("service: error storing message : %w", err)
+	}
+
+	m.Attachment, err = srv.attachRepo.GetAttachment(ctx, tx, data.AttachmentID)
+	if err != nil {
+		return nil, fmt.Errorf("service: error storing message : %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("service: error storing message : %w", err)
+	}
+
+	return m, nil
 }
 
 func (srv *MessageSrv) RetreiveMessages(ctx context.Context, participantOne, participantTwo, page int) (*dto.MessagesDTO, error) {
@@ -53,9 +160,339 @@ func (srv *MessageSrv) RetreiveMessages(ctx context.Context, participantOne, par
 		return nil, fmt.Errorf("service: failed to retrieve messages : %w", err)
 	}
 
+	if len(messages) > 0 {
+		ids := make([]int, 0, len(messages))
+		for _, m := range messages {
+			ids = append(ids, m.ID)
+		}
+
+		counts, err := srv.msgRepo.GetReactionCounts(ctx, srv.db, ids, participantOne)
+		if err != nil {
+			return nil, fmt.Errorf("service: failed to retrieve message reactions : %w", err)
+		}
+
+		for _, m := range messages {
+			m.Reactions = counts[m.ID]
+		}
+	}
+
 	dto := &dto.MessagesDTO{
-		Messages: messages,
+		Messages: dto.NewHistoryMessages(messages),
 	}
 
 	return dto, nil
 }
+
+/*
+Retrieves up to limit messages received by the user after the message with ID afterID.
+
+Messages are ordered oldest first so the client can replay them in order.
+*/
+func (srv *MessageSrv) SyncMessages(ctx context.Context, receiverID, afterID, limit int) ([]*model.Message, error) {
+	if afterID < 0 {
+		afterID = 0
+	}
+
+	messages, err := srv.msgRepo.GetMessagesAfter(ctx, srv.db, receiverID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to sync messages : %w", err)
+	}
+
+	return messages, nil
+}
+
+// Reports if the two users already have a direct message conversation
+func (srv *MessageSrv) HasConversation(ctx context.Context, participantOne, participantTwo int) (bool, error) {
+	exists, err := srv.msgRepo.HasMessages(ctx, srv.db, participantOne, participantTwo)
+	if err != nil {
+		return false, fmt.Errorf("service: failed to check conversation : %w", err)
+	}
+
+	return exists, nil
+}
+
+/*
+Full-text searches the conversations of the user, newest first, SearchPageSize results at a time.
+
+The matched terms in the snippets are wrapped in <mark> tags, the rest of the snippet is HTML escaped.
+*/
+func (srv *MessageSrv) SearchMessages(ctx context.Context, data *dto.SearchMessagesDTO) (*dto.MessageSearchDTO, error) {
+	query := strings.TrimSpace(data.Query)
+	if query == "" || utf8.RuneCountInString(query) > maxSearchQueryLen {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	cursor := max(data.Cursor, 0)
+
+	// Fetch one extra result to know if there is a next page
+	results, err := srv.msgRepo.SearchMessages(ctx, srv.db, data.UserID, data.With, query, cursor, SearchPageSize+1)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to search messages : %w", err)
+	}
+
+	rsp := new(dto.MessageSearchDTO)
+	if len(results) > SearchPageSize {
+		results = results[:SearchPageSize]
+		rsp.NextCursor = results[len(results)-1].ID
+	}
+
+	for _, sr := range results {
+		sr.Snippet = highlightSnippet(sr.Snippet)
+	}
+
+	rsp.Results = results
+
+	return rsp, nil
+}
+
+// Escapes the snippet and turns the match markers into <mark> tags
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		repository.SearchMatchStart, "<mark>",
+		repository.SearchMatchStop, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
+
+/*
+Replaces the content of a message, only the sender can edit and only within the MessageEditWindow.
+
+The previous content is kept as a revision for moderation. Returns the updated message.
+*/
+func (srv *MessageSrv) EditMessage(ctx context.Context, data *dto.EditMessageDTO) (*model.Message, error) {
+	if strings.TrimSpace(data.Content) == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	m, err := srv.getMessage(ctx, data.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.SenderID != data.UserID {
+		return nil, ErrNotMessageSender
+	}
+
+	if m.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	now := time.Now()
+	if now.Sub(m.Timestamp) > MessageEditWindow {
+		return nil, ErrEditWindowExpired
+	}
+
+	tx, err := srv.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to begin transaction : %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	err = srv.msgRepo.CreateRevision(ctx, tx, &model.MessageRevision{
+		MessageID: m.ID,
+		Content:   m.Content,
+		Action:    model.MessageEdited,
+		RevisedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to edit message : %w", err)
+	}
+
+	m.Content = data.Content
+	m.EditedAt = &now
+
+	err = srv.msgRepo.UpdateMessageContent(ctx, tx, m)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			// Deleted between the check and the update
+			return nil, ErrMessageDeleted
+		}
+
+		return nil, fmt.Errorf("service: failed to edit message : %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to edit message : %w", err)
+	}
+
+	return m, nil
+}
+
+/*
+Deletes a message either for the requesting user only or for both participants.
+
+Deleting for everyone is only allowed to the sender, the content is kept as a revision for moderation.
+Returns the affected message.
+*/
+func (srv *MessageSrv) DeleteMessage(ctx context.Context, data *dto.DeleteMessageDTO) (*model.Message, error) {
+	if data.Scope != DeleteForMe && data.Scope != DeleteForEveryone {
+		return nil, ErrInvalidDeleteScope
+	}
+
+	m, err := srv.getMessage(ctx, data.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.SenderID != data.UserID && m.ReceiverID != data.UserID {
+		return nil, ErrNotMessageParticipant
+	}
+
+	if data.Scope == DeleteForMe {
+		if err := srv.msgRepo.HideMessage(ctx, srv.db, m.ID, data.UserID); err != nil {
+			return nil, fmt.Errorf("service: failed to delete message : %w", err)
+		}
+
+		return m, nil
+	}
+
+	if m.SenderID != data.UserID {
+		return nil, ErrNotMessageSender
+	}
+
+	if m.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	now := time.Now()
+
+	tx, err := srv.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to begin transaction : %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(context.Background())
+	}()
+
+	err = srv.msgRepo.CreateRevision(ctx, tx, &model.MessageRevision{
+		MessageID: m.ID,
+		Content:   m.Content,
+		Action:    model.MessageDeleted,
+		RevisedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to delete message : %w", err)
+	}
+
+	err = srv.msgRepo.DeleteMessage(ctx, tx, m.ID, now)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrMessageDeleted
+		}
+
+		return nil, fmt.Errorf("service: failed to delete message : %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to delete message : %w", err)
+	}
+
+	m.Content = ""
+	m.DeletedAt = &now
+
+	return m, nil
+}
+
+/*
+Adds the user's emoji reaction to a message, reacting twice with the same emoji is a no-op.
+
+Only the participants of the message can react. Returns the message reacted to.
+*/
+func (srv *MessageSrv) React(ctx context.Context, data *dto.ReactionDTO) (*model.Message, error) {
+	m, err := srv.checkReaction(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.msgRepo.AddReaction(ctx, srv.db, &model.Reaction{
+		MessageID: m.ID,
+		UserID:    data.UserID,
+		Emoji:     data.Emoji,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to react to message : %w", err)
+	}
+
+	return m, nil
+}
+
+// Removes the user's emoji reaction from a message. Returns the message the reaction was removed from.
+func (srv *MessageSrv) Unreact(ctx context.Context, data *dto.ReactionDTO) (*model.Message, error) {
+	m, err := srv.checkReaction(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.msgRepo.RemoveReaction(ctx, srv.db, &model.Reaction{
+		MessageID: m.ID,
+		UserID:    data.UserID,
+		Emoji:     data.Emoji,
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrReactionNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to remove reaction : %w", err)
+	}
+
+	return m, nil
+}
+
+// Validates the emoji and that the user is a participant of a message that still exists
+func (srv *MessageSrv) checkReaction(ctx context.Context, data *dto.ReactionDTO) (*model.Message, error) {
+	if !validReaction(data.Emoji) {
+		return nil, ErrInvalidReaction
+	}
+
+	m, err := srv.getMessage(ctx, data.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.SenderID != data.UserID && m.ReceiverID != data.UserID {
+		return nil, ErrNotMessageParticipant
+	}
+
+	if m.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	return m, nil
+}
+
+// Reactions are short emoji sequences, plain text is rejected
+func validReaction(emoji string) bool {
+	n := utf8.RuneCountInString(emoji)
+	if n == 0 || n > maxReactionRunes || !utf8.ValidString(emoji) {
+		return false
+	}
+
+	for _, r := range emoji {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (srv *MessageSrv) getMessage(ctx context.Context, messageID int) (*model.Message, error) {
+	m, err := srv.msgRepo.GetMessage(ctx, srv.db, messageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrMessageNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve message : %w", err)
+	}
+
+	// Group messages are not managed as direct messages
+	if m.ConversationID != nil {
+		return nil, ErrMessageNotExist
+	}
+
+	return m, nil
+}
@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+)
+
+const (
+	// Users under this age are only ever matched with other minors and adults only with adults
+	AdultAge = 18
+
+	MinRandomAge       = 13 // Same as the minimum age on registration
+	MaxRandomAge       = 120
+	MaxRandomCountries = 10
+	MaxRandomLanguages = 10
+
+	MaxTranscriptLen = 4000
+
+	// Sessions per page when looking up the random chat history of a user
+	SessionPageSize = 20
+)
+
+var (
+	ErrInvalidRandomPreferences = errors.New("service: invalid random chat preferences")
+	ErrUserNotExist             = errors.New("service: user does not exist")
+	ErrRandomSessionNotExist    = errors.New("service: random session does not exist")
+	ErrInvalidReportReason      = errors.New("service: invalid report reason")
+	ErrTranscriptTooLong        = errors.New("service: transcript is too long")
+	ErrAlreadyReported          = errors.New("service: random session already reported")
+	ErrInvalidRating            = errors.New("service: invalid rating")
+	ErrAlreadyRated             = errors.New("service: random session already rated")
+)
+
+type RandomService interface {
+	Profile(ctx context.Context, data *dto.JoinRandomDTO) (*dto.RandomProfileDTO, error)
+	PublicProfile(ctx context.Context, userID int) (*dto.PublicProfileDTO, error)
+	Report(ctx context.Context, data *dto.RandomReportDTO) (*dto.RandomReportSuccessDTO, error)
+	Rate(ctx context.Context, data *dto.RandomRatingDTO) error
+	SaveSession(ctx context.Context, s *model.RandomSession) error
+	UserSessions(ctx context.Context, userID, page int) ([]*model.RandomSession, error)
+	RecentSessions(ctx context.Context, since time.Time) ([]*model.RandomSession, error)
+	Session(ctx context.Context, sessionID string) (*model.RandomSession, error)
+}
+
+type RandomSrv struct {
+	logger      *slog.Logger
+	userRepo    repository.UserRepository
+	countryRepo repository.CountryRepository
+	randomRepo  repository.RandomRepository
+	db          *pgxpool.Pool
+}
+
+func NewRandomService(logger *slog.Logger, userRepo repository.UserRepository, countryRepo repository.CountryRepository, randomRepo repository.RandomRepository, db *pgxpool.Pool) RandomService {
+	return &RandomSrv{
+		logger:      logger,
+		userRepo:    userRepo,
+		countryRepo: countryRepo,
+		randomRepo:  randomRepo,
+		db:          db,
+	}
+}
+
+/*
+Validates the match preferences of the user and builds the profile the matcher pairs users with.
+
+Country codes are uppercased and have to exist in the country table, language codes are lowercased.
+The age and country of the user are taken from the database, never from the client.
+*/
+func (srv *RandomSrv) Profile(ctx context.Context, data *dto.JoinRandomDTO) (*dto.RandomProfileDTO, error) {
+	prefs, err := srv.normalizePreferences(ctx, data.Preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := srv.userRepo.GetUserWithCountryByID(ctx, srv.db, data.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrUserNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve random profile : %w", err)
+	}
+
+	up, down, err := srv.randomRepo.GetRatingCounts(ctx, srv.db, data.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve random reputation : %w", err)
+	}
+
+	return &dto.RandomProfileDTO{
+		UserID:      user.ID,
+		Age:         Age(user.Bdate, time.Now()),
+		Country:     user.CountryCode,
+		Reputation:  Reputation(up, down),
+		Preferences: prefs,
+	}, nil
+}
+
+// Returns the profile revealed to the random partner, private fields like the email and birthdate are left out
+func (srv *RandomSrv) PublicProfile(ctx context.Context, userID int) (*dto.PublicProfileDTO, error) {
+	user, err := srv.userRepo.GetUserWithCountryByID(ctx, srv.db, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrUserNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve public profile : %w", err)
+	}
+
+	return &dto.PublicProfileDTO{
+		ID:          user.ID,
+		Username:    user.Username,
+		AvatarURL:   user.AvatarURL,
+		CountryCode: user.CountryCode,
+		CountryName: user.CountryName,
+	}, nil
+}
+
+func (srv *RandomSrv) normalizePreferences(ctx context.Context, prefs dto.RandomPreferencesDTO) (dto.RandomPreferencesDTO, error) {
+	if len(prefs.Countries) > MaxRandomCountries || len(prefs.Languages) > MaxRandomLanguages {
+		return prefs, ErrInvalidRandomPreferences
+	}
+
+	for _, age := range []int{prefs.MinAge, prefs.MaxAge} {
+		if age != 0 && (age < MinRandomAge || age > MaxRandomAge) {
+			return prefs, ErrInvalidRandomPreferences
+		}
+	}
+
+	if prefs.MinAge != 0 && prefs.MaxAge != 0 && prefs.MinAge > prefs.MaxAge {
+		return prefs, ErrInvalidRandomPreferences
+	}
+
+	countries := make([]string, 0, len(prefs.Countries))
+	for _, code := range prefs.Countries {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if slices.Contains(countries, code) {
+			continue
+		}
+
+		if _, err := srv.countryRepo.GetIDByISO(ctx, srv.db, code); err != nil {
+			if errors.Is(err, repository.ErrCountryNotExist) {
+				return prefs, ErrInvalidRandomPreferences
+			}
+
+			return prefs, fmt.Errorf("service: failed to check preferred country : %w", err)
+		}
+
+		countries = append(countries, code)
+	}
+
+	languages := make([]string, 0, len(prefs.Languages))
+	for _, code := range prefs.Languages {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if len(code) != 2 || code[0] < 'a' || code[0] > 'z' || code[1] < 'a' || code[1] > 'z' {
+			return prefs, ErrInvalidRandomPreferences
+		}
+
+		if !slices.Contains(languages, code) {
+			languages = append(languages, code)
+		}
+	}
+
+	prefs.Countries = countries
+	prefs.Languages = languages
+
+	return prefs, nil
+}
+
+/*
+Records a report on the random partner of the session.
+
+The reporter and the reported user are resolved from the session by the caller, a user reports a session once.
+*/
+func (srv *RandomSrv) Report(ctx context.Context, data *dto.RandomReportDTO) (*dto.RandomReportSuccessDTO, error) {
+	reason := model.RandomReportReason(data.Reason)
+	if !reason.Valid() {
+		return nil, ErrInvalidReportReason
+	}
+
+	if len(data.Transcript) > MaxTranscriptLen {
+		return nil, ErrTranscriptTooLong
+	}
+
+	var transcript *string
+	if t := strings.TrimSpace(data.Transcript); t != "" {
+		transcript = &t
+	}
+
+	rid, err := srv.randomRepo.CreateReport(ctx, srv.db, &model.RandomReport{
+		SessionID:  data.SessionID,
+		ReporterID: data.ReporterID,
+		ReportedID: data.ReportedID,
+		Reason:     reason,
+		Transcript: transcript,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateReport) {
+			return nil, ErrAlreadyReported
+		}
+
+		return nil, fmt.Errorf("service: failed to report random partner : %w", err)
+	}
+
+	srv.logger.Info("random partner reported", slog.Int("report_id", rid), slog.String("reason", data.Reason))
+
+	return &dto.RandomReportSuccessDTO{ReportID: rid}, nil
+}
+
+// Records the thumbs up or down the rater gave the random partner of the session, a session is rated once
+func (srv *RandomSrv) Rate(ctx context.Context, data *dto.RandomRatingDTO) error {
+	if data.Rating != "up" && data.Rating != "down" {
+		return ErrInvalidRating
+	}
+
+	err := srv.randomRepo.CreateRating(ctx, srv.db, &model.RandomRating{
+		SessionID: data.SessionID,
+		RaterID:   data.RaterID,
+		RatedID:   data.RatedID,
+		Positive:  data.Rating == "up",
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateRating) {
+			return ErrAlreadyRated
+		}
+
+		return fmt.Errorf("service: failed to rate random partner : %w", err)
+	}
+
+	return nil
+}
+
+// Records the random chat session, called when it starts and again when it ends
+func (srv *RandomSrv) SaveSession(ctx context.Context, s *model.RandomSession) error {
+	if err := srv.randomRepo.SaveSession(ctx, srv.db, s); err != nil {
+		return fmt.Errorf("service: failed to save random session : %w", err)
+	}
+
+	return nil
+}
+
+/*
+Returns the random chat sessions the user took part in, newest first, for moderators handling reports.
+
+Pages start at 1 and hold up to SessionPageSize sessions.
+*/
+func (srv *RandomSrv) UserSessions(ctx context.Context, userID, page int) ([]*model.RandomSession, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	sessions, err := srv.randomRepo.GetSessionsByUser(ctx, srv.db, userID, SessionPageSize, (page-1)*SessionPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve random sessions : %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Returns the saved random chat session, the hub keeps only the sessions of its own node
+func (srv *RandomSrv) Session(ctx context.Context, sessionID string) (*model.RandomSession, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return nil, ErrRandomSessionNotExist
+	}
+
+	s, err := srv.randomRepo.GetSession(ctx, srv.db, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNoRowsFound) {
+			return nil, ErrRandomSessionNotExist
+		}
+
+		return nil, fmt.Errorf("service: failed to retrieve random session : %w", err)
+	}
+
+	return s, nil
+}
+
+// Returns the random chat sessions started after since, oldest first, so recent partners are known after a restart
+func (srv *RandomSrv) RecentSessions(ctx context.Context, since time.Time) ([]*model.RandomSession, error) {
+	sessions, err := srv.randomRepo.GetSessionsSince(ctx, srv.db, since)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to retrieve recent random sessions : %w", err)
+	}
+
+	return sessions, nil
+}
+
+/*
+Turns the ratings of a user into a score between 0 and 1.
+
+Every user starts with one thumbs up and one down, so a few ratings do not swing the score to either end.
+*/
+func Reputation(up, down int) float64 {
+	return float64(up+1) / float64(up+down+2)
+}
+
+// Returns the age in whole years of someone born on bdate at the given time
+func Age(bdate, now time.Time) int {
+	age := now.Year() - bdate.Year()
+	if now.Month() < bdate.Month() || (now.Month() == bdate.Month() && now.Day() < bdate.Day()) {
+		age--
+	}
+
+	return age
+}
+
+/*
+Reports if the two users may be matched together.
+
+Adults and minors are never matched. Otherwise each user has to fit the country and age preferences of
+the other, and when both listed languages they need one in common.
+*/
+func RandomCompatible(a, b *dto.RandomProfileDTO) bool {
+	if (a.Age >= AdultAge) != (b.Age >= AdultAge) {
+		return false
+	}
+
+	if !acceptsPartner(a.Preferences, b) || !acceptsPartner(b.Preferences, a) {
+		return false
+	}
+
+	if len(a.Preferences.Languages) == 0 || len(b.Preferences.Languages) == 0 {
+		return true
+	}
+
+	for _, lang := range a.Preferences.Languages {
+		if slices.Contains(b.Preferences.Languages, lang) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func acceptsPartner(prefs dto.RandomPreferencesDTO, partner *dto.RandomProfileDTO) bool {
+	if len(prefs.Countries) > 0 && !slices.Contains(prefs.Countries, partner.Country) {
+		return false
+	}
+
+	if prefs.MinAge != 0 && partner.Age < prefs.MinAge {
+		return false
+	}
+
+	if prefs.MaxAge != 0 && partner.Age > prefs.MaxAge {
+		return false
+	}
+
+	return true
+}
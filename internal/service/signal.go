@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/config"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+)
+
+const (
+	// Offers with audio, video and a data channel stay well under this
+	MaxSDPLen       = 16 * 1024
+	MaxCandidateLen = 1024
+	MaxSDPMidLen    = 64
+)
+
+var (
+	ErrInvalidSignal  = errors.New("service: invalid signaling message")
+	ErrSignalTooLarge = errors.New("service: signaling message is too large")
+)
+
+type SignalService interface {
+	Validate(data *dto.SignalDTO) error
+	IceServers(userID int, now time.Time) *dto.RTCConfigDTO
+}
+
+type SignalSrv struct {
+	logger *slog.Logger
+	cfg    config.RTC
+}
+
+func NewSignalService(logger *slog.Logger, cfg config.RTC) SignalService {
+	return &SignalSrv{
+		logger: logger,
+		cfg:    cfg,
+	}
+}
+
+/*
+Checks the signaling message before it is relayed to the peer.
+
+The server does not parse the SDP, it only makes sure the payload has the right shape and size
+so peers cannot use the relay to push arbitrary data at each other.
+*/
+func (srv *SignalSrv) Validate(data *dto.SignalDTO) error {
+	switch data.Type {
+	case "rtc_offer", "rtc_answer":
+		if len(data.SDP) > MaxSDPLen {
+			return ErrSignalTooLarge
+		}
+
+		if data.Candidate != nil || !strings.HasPrefix(data.SDP, "v=0") || strings.ContainsRune(data.SDP, 0) {
+			return ErrInvalidSignal
+		}
+
+	case "rtc_ice":
+		c := data.Candidate
+		if c == nil || data.SDP != "" {
+			return ErrInvalidSignal
+		}
+
+		if len(c.Candidate) > MaxCandidateLen || (c.SDPMid != nil && len(*c.SDPMid) > MaxSDPMidLen) ||
+			(c.UsernameFragment != nil && len(*c.UsernameFragment) > MaxSDPMidLen) {
+			return ErrSignalTooLarge
+		}
+
+		// An empty candidate is the end of candidates marker
+		if c.Candidate != "" && !strings.HasPrefix(c.Candidate, "candidate:") {
+			return ErrInvalidSignal
+		}
+
+		if strings.ContainsAny(c.Candidate, "\r\n\x00") || (c.SDPMLineIndex != nil && *c.SDPMLineIndex < 0) {
+			return ErrInvalidSignal
+		}
+
+	case "rtc_hangup":
+		if data.SDP != "" || data.Candidate != nil {
+			return ErrInvalidSignal
+		}
+
+	default:
+		return ErrInvalidSignal
+	}
+
+	return nil
+}
+
+/*
+Returns the ICE servers the user connects to the peer with.
+
+With a TURN secret the credentials are generated for the user: the username is the expiry unix time
+and the user ID, the credential the base64 HMAC-SHA1 of the username keyed with the secret.
+*/
+func (srv *SignalSrv) IceServers(userID int, now time.Time) *dto.RTCConfigDTO {
+	rsp := &dto.RTCConfigDTO{
+		IceServers: []dto.IceServerDTO{},
+	}
+
+	if len(srv.cfg.STUNURLs) > 0 {
+		rsp.IceServers = append(rsp.IceServers, dto.IceServerDTO{URLs: srv.cfg.STUNURLs})
+	}
+
+	if len(srv.cfg.TURNURLs) == 0 {
+		return rsp
+	}
+
+	turn := dto.IceServerDTO{
+		URLs:       srv.cfg.TURNURLs,
+		Username:   srv.cfg.TURNUsername,
+		Credential: srv.cfg.TURNCredential,
+	}
+
+	if srv.cfg.TURNSecret != "" {
+		expiry := now.Add(srv.cfg.TURNCredentialTTL).Unix()
+		turn.Username = strconv.FormatInt(expiry, 10) + ":" + strconv.Itoa(userID)
+		turn.Credential = TURNCredential(srv.cfg.TURNSecret, turn.Username)
+		rsp.TTL = int(srv.cfg.TURNCredentialTTL.Seconds())
+	}
+
+	rsp.IceServers = append(rsp.IceServers, turn)
+	return rsp
+}
+
+// Derives the TURN password of the username the same way the TURN server checks it
+func TURNCredential(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
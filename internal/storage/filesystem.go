@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Keeps the objects as files under a root directory
+type FSStorage struct {
+	root string
+}
+
+func NewFSStorage(root string) (Storage, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("storage: failed to create root directory : %w", err)
+	}
+
+	return &FSStorage{
+		root: root,
+	}, nil
+}
+
+func (s *FSStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return fmt.Errorf("storage: failed to create directory : %w", err)
+	}
+
+	// Write to a temporary file first so a failed upload never leaves a partial object behind
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: failed to create file : %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("storage: failed to write file : %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("storage: failed to write file : %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("storage: failed to move file : %w", err)
+	}
+
+	return nil
+}
+
+func (s *FSStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrObjectNotExist
+		}
+
+		return nil, fmt.Errorf("storage: failed to open file : %w", err)
+	}
+
+	return f, nil
+}
+
+func (s *FSStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("storage: failed to delete file : %w", err)
+	}
+
+	return nil
+}
+
+// Resolves the key to a path under the root, keys escaping the root are rejected
+func (s *FSStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, "..") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
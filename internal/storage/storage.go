@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrObjectNotExist = errors.New("storage: object does not exist")
+	ErrInvalidKey     = errors.New("storage: invalid object key")
+)
+
+/*
+Storage abstracts where uploaded files are kept.
+
+Keys are slash separated paths like "attachments/<uuid>.png", backends map them to their own layout.
+*/
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
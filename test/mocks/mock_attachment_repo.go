@@ -0,0 +1,33 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAttachmentRepo struct {
+	mock.Mock
+}
+
+func (m *MockAttachmentRepo) CreateAttachment(ctx context.Context, qr repository.Queryer, a *model.Attachment) (int, error) {
+	args := m.Called(ctx, qr, a)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAttachmentRepo) GetAttachment(ctx context.Context, qr repository.Queryer, attachmentID int) (*model.Attachment, error) {
+	args := m.Called(ctx, qr, attachmentID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.Attachment), args.Error(1)
+}
+
+func (m *MockAttachmentRepo) LinkAttachment(ctx context.Context, qr repository.Queryer, attachmentID, messageID, uploaderID int) error {
+	args := m.Called(ctx, qr, attachmentID, messageID, uploaderID)
+	return args.Error(0)
+}
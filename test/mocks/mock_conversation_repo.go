@@ -0,0 +1,73 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockConversationRepo struct {
+	mock.Mock
+}
+
+func (m *MockConversationRepo) CreateConversation(ctx context.Context, qr repository.Queryer, c *model.Conversation) (int, error) {
+	args := m.Called(ctx, qr, c)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockConversationRepo) GetConversation(ctx context.Context, qr repository.Queryer, conversationID int) (*model.Conversation, error) {
+	args := m.Called(ctx, qr, conversationID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.Conversation), args.Error(1)
+}
+
+func (m *MockConversationRepo) GetConversations(ctx context.Context, qr repository.Queryer, userID int) ([]*model.Conversation, error) {
+	args := m.Called(ctx, qr, userID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.Conversation), args.Error(1)
+}
+
+func (m *MockConversationRepo) AddMember(ctx context.Context, qr repository.Queryer, cm *model.ConversationMember) error {
+	args := m.Called(ctx, qr, cm)
+	return args.Error(0)
+}
+
+func (m *MockConversationRepo) GetMember(ctx context.Context, qr repository.Queryer, conversationID, userID int) (*model.ConversationMember, error) {
+	args := m.Called(ctx, qr, conversationID, userID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.ConversationMember), args.Error(1)
+}
+
+func (m *MockConversationRepo) GetMembers(ctx context.Context, qr repository.Queryer, conversationID int) ([]*model.ConversationMember, error) {
+	args := m.Called(ctx, qr, conversationID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.ConversationMember), args.Error(1)
+}
+
+func (m *MockConversationRepo) UpdateMemberRole(ctx context.Context, qr repository.Queryer, cm *model.ConversationMember) error {
+	args := m.Called(ctx, qr, cm)
+	return args.Error(0)
+}
+
+func (m *MockConversationRepo) RemoveMember(ctx context.Context, qr repository.Queryer, conversationID, userID int) error {
+	args := m.Called(ctx, qr, conversationID, userID)
+	return args.Error(0)
+}
@@ -42,3 +42,18 @@ func (m *MockFriendshipRepo) CheckRelationship(ctx context.Context, qr repositor
 	args := m.Called(ctx, qr, fr)
 	return args.Bool(0), args.Error(1)
 }
+
+func (m *MockFriendshipRepo) GetFriendshipStatus(ctx context.Context, qr repository.Queryer, fr *model.Friendship) (model.FriendshipStatus, error) {
+	args := m.Called(ctx, qr, fr)
+	return args.Get(0).(model.FriendshipStatus), args.Error(1)
+}
+
+func (m *MockFriendshipRepo) GetRelatedUserIDs(ctx context.Context, qr repository.Queryer, userID int) ([]int, error) {
+	args := m.Called(ctx, qr, userID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]int), args.Error(1)
+}
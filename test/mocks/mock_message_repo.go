@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/jlry-dev/whirl/internal/model"
 	"github.com/jlry-dev/whirl/internal/repository"
@@ -12,9 +13,9 @@ type MockMessageRepo struct {
 	mock.Mock
 }
 
-func (m *MockMessageRepo) CreateMessage(ctx context.Context, qr repository.Queryer, msg *model.Message) error {
+func (m *MockMessageRepo) CreateMessage(ctx context.Context, qr repository.Queryer, msg *model.Message) (int, error) {
 	args := m.Called(ctx, qr, msg)
-	return args.Error(0)
+	return args.Int(0), args.Error(1)
 }
 
 func (m *MockMessageRepo) GetMessages(ctx context.Context, qr repository.Queryer, uidOne, uidTwo, page int) ([]*model.Message, error) {
@@ -26,3 +27,88 @@ func (m *MockMessageRepo) GetMessages(ctx context.Context, qr repository.Queryer
 
 	return args.Get(0).([]*model.Message), args.Error(1)
 }
+
+func (m *MockMessageRepo) GetConversationMessages(ctx context.Context, qr repository.Queryer, conversationID int, since time.Time, page int) ([]*model.Message, error) {
+	args := m.Called(ctx, qr, conversationID, since, page)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.Message), args.Error(1)
+}
+
+func (m *MockMessageRepo) GetMessagesAfter(ctx context.Context, qr repository.Queryer, receiverID, afterID, limit int) ([]*model.Message, error) {
+	args := m.Called(ctx, qr, receiverID, afterID, limit)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.Message), args.Error(1)
+}
+
+func (m *MockMessageRepo) SearchMessages(ctx context.Context, qr repository.Queryer, userID, withID int, query string, beforeID, limit int) ([]*model.MessageSearchResult, error) {
+	args := m.Called(ctx, qr, userID, withID, query, beforeID, limit)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.MessageSearchResult), args.Error(1)
+}
+
+func (m *MockMessageRepo) HasMessages(ctx context.Context, qr repository.Queryer, uidOne, uidTwo int) (bool, error) {
+	args := m.Called(ctx, qr, uidOne, uidTwo)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMessageRepo) GetMessage(ctx context.Context, qr repository.Queryer, messageID int) (*model.Message, error) {
+	args := m.Called(ctx, qr, messageID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.Message), args.Error(1)
+}
+
+func (m *MockMessageRepo) UpdateMessageContent(ctx context.Context, qr repository.Queryer, msg *model.Message) error {
+	args := m.Called(ctx, qr, msg)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) DeleteMessage(ctx context.Context, qr repository.Queryer, messageID int, deletedAt time.Time) error {
+	args := m.Called(ctx, qr, messageID, deletedAt)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) HideMessage(ctx context.Context, qr repository.Queryer, messageID, userID int) error {
+	args := m.Called(ctx, qr, messageID, userID)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) CreateRevision(ctx context.Context, qr repository.Queryer, rev *model.MessageRevision) error {
+	args := m.Called(ctx, qr, rev)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) AddReaction(ctx context.Context, qr repository.Queryer, rc *model.Reaction) error {
+	args := m.Called(ctx, qr, rc)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) RemoveReaction(ctx context.Context, qr repository.Queryer, rc *model.Reaction) error {
+	args := m.Called(ctx, qr, rc)
+	return args.Error(0)
+}
+
+func (m *MockMessageRepo) GetReactionCounts(ctx context.Context, qr repository.Queryer, messageIDs []int, userID int) (map[int][]*model.ReactionCount, error) {
+	args := m.Called(ctx, qr, messageIDs, userID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(map[int][]*model.ReactionCount), args.Error(1)
+}
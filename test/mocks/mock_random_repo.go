@@ -0,0 +1,64 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRandomRepo struct {
+	mock.Mock
+}
+
+func (m *MockRandomRepo) CreateReport(ctx context.Context, qr repository.Queryer, rp *model.RandomReport) (int, error) {
+	args := m.Called(ctx, qr, rp)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRandomRepo) CreateRating(ctx context.Context, qr repository.Queryer, rt *model.RandomRating) error {
+	args := m.Called(ctx, qr, rt)
+	return args.Error(0)
+}
+
+func (m *MockRandomRepo) GetRatingCounts(ctx context.Context, qr repository.Queryer, userID int) (int, int, error) {
+	args := m.Called(ctx, qr, userID)
+	return args.Int(0), args.Int(1), args.Error(2)
+}
+
+func (m *MockRandomRepo) SaveSession(ctx context.Context, qr repository.Queryer, s *model.RandomSession) error {
+	args := m.Called(ctx, qr, s)
+	return args.Error(0)
+}
+
+func (m *MockRandomRepo) GetSessionsByUser(ctx context.Context, qr repository.Queryer, userID, limit, offset int) ([]*model.RandomSession, error) {
+	args := m.Called(ctx, qr, userID, limit, offset)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.RandomSession), args.Error(1)
+}
+
+func (m *MockRandomRepo) GetSessionsSince(ctx context.Context, qr repository.Queryer, since time.Time) ([]*model.RandomSession, error) {
+	args := m.Called(ctx, qr, since)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*model.RandomSession), args.Error(1)
+}
+
+func (m *MockRandomRepo) GetSession(ctx context.Context, qr repository.Queryer, sessionID string) (*model.RandomSession, error) {
+	args := m.Called(ctx, qr, sessionID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*model.RandomSession), args.Error(1)
+}
@@ -36,6 +36,16 @@ func (m *MockUserRepo) GetUserWithCountryByUsername(ctx context.Context, qr repo
 	return args.Get(0).(*dto.UserWithCountryDTO), args.Error(1)
 }
 
+func (m *MockUserRepo) GetUserWithCountryByID(ctx context.Context, qr repository.Queryer, userID int) (*dto.UserWithCountryDTO, error) {
+	args := m.Called(ctx, qr, userID)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*dto.UserWithCountryDTO), args.Error(1)
+}
+
 func (m *MockUserRepo) CheckUsers(ctx context.Context, qr repository.Queryer, userIDs ...int) (bool, error) {
 	args := m.Called(ctx, qr, userIDs)
 
@@ -0,0 +1,344 @@
+package bus_test
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres refuses NOTIFY payloads of this many bytes or more
+const postgresMaxNotify = 8000
+
+// Type OIDs of the columns the fake returns
+const (
+	oidBool  = 16
+	oidBytea = 17
+	oidInt8  = 20
+	oidVoid  = 2278
+)
+
+// The simple protocol sends every argument as a quoted literal
+var sqlLiteral = regexp.MustCompile(`'((?:[^']|'')*)'`)
+
+/*
+Speaks just enough of the Postgres protocol for a PostgresBus, the way miniredis stands in for Redis.
+
+The pools of the tests run every query over the simple protocol, so the arguments arrive inlined in the SQL.
+NOTIFY payloads are limited like on a real server, and advisory locks are released when their connection closes.
+*/
+type fakePostgres struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[*fakeConn]struct{}
+	payloads map[int64][]byte
+	lastID   int64
+	locks    map[string]*fakeConn
+	notified []string // Payloads of every NOTIFY, in order
+}
+
+type fakeConn struct {
+	pid     uint32
+	backend *pgproto3.Backend
+
+	// Notifications wait while a query runs, like they wait for the end of a transaction on a real server
+	mu        sync.Mutex
+	busy      bool
+	pending   []*pgproto3.NotificationResponse
+	listening map[string]bool
+}
+
+func newFakePostgres(t *testing.T) *fakePostgres {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	pg := &fakePostgres{
+		ln:       ln,
+		conns:    make(map[*fakeConn]struct{}),
+		payloads: make(map[int64][]byte),
+		locks:    make(map[string]*fakeConn),
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go pg.accept()
+
+	return pg
+}
+
+// Returns a pool on the fake server, closed when the test ends
+func (pg *fakePostgres) pool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	cfg, err := pgxpool.ParseConfig("postgres://whirl@" + pg.ln.Addr().String() + "/whirl?sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to parse the pool config: %v", err)
+	}
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create the pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// Number of connections listening on the channel
+func (pg *fakePostgres) listeners(channel string) int {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	n := 0
+	for c := range pg.conns {
+		c.mu.Lock()
+		if c.listening[channel] {
+			n++
+		}
+		c.mu.Unlock()
+	}
+
+	return n
+}
+
+func (pg *fakePostgres) stored() int {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	return len(pg.payloads)
+}
+
+func (pg *fakePostgres) notifications() []string {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	return append([]string(nil), pg.notified...)
+}
+
+func (pg *fakePostgres) accept() {
+	for pid := uint32(1); ; pid++ {
+		nc, err := pg.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &fakeConn{
+			pid:       pid,
+			backend:   pgproto3.NewBackend(nc, nc),
+			listening: make(map[string]bool),
+		}
+
+		go pg.serve(nc, c)
+	}
+}
+
+func (pg *fakePostgres) serve(nc net.Conn, c *fakeConn) {
+	defer nc.Close()
+
+	if _, err := c.backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+
+	c.backend.Send(&pgproto3.AuthenticationOk{})
+	for name, value := range map[string]string{
+		"server_version":              "16.0",
+		"client_encoding":             "UTF8",
+		"standard_conforming_strings": "on",
+	} {
+		c.backend.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+	}
+	c.backend.Send(&pgproto3.BackendKeyData{ProcessID: c.pid})
+	c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := c.backend.Flush(); err != nil {
+		return
+	}
+
+	pg.mu.Lock()
+	pg.conns[c] = struct{}{}
+	pg.mu.Unlock()
+
+	// Closing the connection releases its locks and ends its LISTENs
+	defer func() {
+		pg.mu.Lock()
+		delete(pg.conns, c)
+		for name, holder := range pg.locks {
+			if holder == c {
+				delete(pg.locks, name)
+			}
+		}
+		pg.mu.Unlock()
+	}()
+
+	for {
+		msg, err := c.backend.Receive()
+		if err != nil {
+			return
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			c.mu.Lock()
+			c.busy = true
+			c.mu.Unlock()
+
+			pg.query(c, strings.TrimSpace(msg.String))
+
+			c.mu.Lock()
+			c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			for _, n := range c.pending {
+				c.backend.Send(n)
+			}
+			c.pending = nil
+			c.busy = false
+			err = c.backend.Flush()
+			c.mu.Unlock()
+
+			if err != nil {
+				return
+			}
+		case *pgproto3.Terminate:
+			return
+		default:
+			c.mu.Lock()
+			c.backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "0A000", Message: "only the simple protocol is supported"})
+			c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			c.backend.Flush()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Answers the queries a PostgresBus sends, the caller sends the ReadyForQuery
+func (pg *fakePostgres) query(c *fakeConn, sql string) {
+	var literals []string
+	for _, m := range sqlLiteral.FindAllStringSubmatch(sql, -1) {
+		literals = append(literals, strings.ReplaceAll(m[1], "''", "'"))
+	}
+
+	switch {
+	case sql == "" || strings.HasPrefix(sql, "--"):
+		c.backend.Send(&pgproto3.EmptyQueryResponse{})
+
+	case strings.HasPrefix(sql, "LISTEN "), strings.HasPrefix(sql, "UNLISTEN "):
+		command, channel, _ := strings.Cut(sql, " ")
+
+		c.mu.Lock()
+		c.listening[strings.Trim(channel, `"`)] = command == "LISTEN"
+		c.mu.Unlock()
+
+		c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(command)})
+
+	case strings.HasPrefix(sql, "SELECT pg_notify(") && len(literals) == 2:
+		if len(literals[1]) >= postgresMaxNotify {
+			c.backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "22023", Message: "payload string too long"})
+			return
+		}
+
+		pg.notify(literals[0], literals[1])
+		row(c, "pg_notify", oidVoid, []byte{})
+
+	case strings.HasPrefix(sql, "INSERT INTO bus_payload") && len(literals) == 1:
+		payload, err := hex.DecodeString(strings.TrimPrefix(literals[0], `\x`))
+		if err != nil {
+			c.backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "22P02", Message: "invalid bytea"})
+			return
+		}
+
+		pg.mu.Lock()
+		pg.lastID++
+		id := pg.lastID
+		pg.payloads[id] = payload
+		pg.mu.Unlock()
+
+		row(c, "id", oidInt8, []byte(strconv.FormatInt(id, 10)))
+
+	case strings.HasPrefix(sql, "DELETE FROM bus_payload"):
+		// Every payload of a test is younger than the TTL
+		c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("DELETE 0")})
+
+	case strings.HasPrefix(sql, "SELECT payload FROM bus_payload"):
+		var id int64
+		if len(literals) == 1 {
+			id, _ = strconv.ParseInt(literals[0], 10, 64)
+		}
+
+		pg.mu.Lock()
+		payload, ok := pg.payloads[id]
+		pg.mu.Unlock()
+
+		if !ok {
+			c.backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{field("payload", oidBytea)}})
+			c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 0")})
+			return
+		}
+
+		row(c, "payload", oidBytea, []byte(`\x`+hex.EncodeToString(payload)))
+
+	case strings.HasPrefix(sql, "SELECT pg_try_advisory_lock(") && len(literals) == 2:
+		pg.mu.Lock()
+		holder, held := pg.locks[literals[1]]
+		locked := !held || holder == c
+		if locked {
+			pg.locks[literals[1]] = c
+		}
+		pg.mu.Unlock()
+
+		value := "f"
+		if locked {
+			value = "t"
+		}
+		row(c, "pg_try_advisory_lock", oidBool, []byte(value))
+
+	default:
+		c.backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "unexpected query: " + sql})
+	}
+}
+
+// Sends the notification to every connection listening on the channel
+func (pg *fakePostgres) notify(channel, payload string) {
+	pg.mu.Lock()
+	pg.notified = append(pg.notified, payload)
+	conns := make([]*fakeConn, 0, len(pg.conns))
+	for c := range pg.conns {
+		conns = append(conns, c)
+	}
+	pg.mu.Unlock()
+
+	for _, c := range conns {
+		c.mu.Lock()
+		if c.listening[channel] {
+			n := &pgproto3.NotificationResponse{PID: c.pid, Channel: channel, Payload: payload}
+			if c.busy {
+				c.pending = append(c.pending, n)
+			} else {
+				c.backend.Send(n)
+				c.backend.Flush()
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Sends a result of one row with one text column
+func row(c *fakeConn, name string, oid uint32, value []byte) {
+	c.backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{field(name, oid)}})
+	c.backend.Send(&pgproto3.DataRow{Values: [][]byte{value}})
+	c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+}
+
+func field(name string, oid uint32) pgproto3.FieldDescription {
+	return pgproto3.FieldDescription{Name: []byte(name), DataTypeOID: oid, DataTypeSize: -1, TypeModifier: -1}
+}
@@ -0,0 +1,124 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+)
+
+// Collects the payloads a handler receives
+func collect(t *testing.T, b bus.Bus, topic string) (<-chan string, func()) {
+	t.Helper()
+
+	received := make(chan string, 16)
+	cancel, err := b.Subscribe(topic, func(payload []byte) {
+		received <- string(payload)
+	})
+	assert.NoError(t, err)
+
+	return received, cancel
+}
+
+func next(t *testing.T, received <-chan string) string {
+	t.Helper()
+
+	select {
+	case p := <-received:
+		return p
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func nothing(t *testing.T, received <-chan string) {
+	t.Helper()
+
+	select {
+	case p := <-received:
+		t.Fatalf("unexpected message %q", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func Test_MemoryPublish(t *testing.T) {
+	broker := bus.NewMemoryBroker()
+	a, b := broker.Connect(), broker.Connect()
+
+	fromA, _ := collect(t, a, "hub_deliver")
+	fromB, _ := collect(t, b, "hub_deliver")
+	other, _ := collect(t, b, "hub_random")
+
+	ctx := context.Background()
+	for _, p := range []string{"one", "two", "three"} {
+		assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte(p)))
+	}
+
+	for _, received := range []<-chan string{fromA, fromB} {
+		assert.Equal(t, "one", next(t, received), "the publisher receives its own messages")
+		assert.Equal(t, "two", next(t, received))
+		assert.Equal(t, "three", next(t, received))
+	}
+
+	nothing(t, other)
+}
+
+func Test_MemoryUnsubscribe(t *testing.T) {
+	broker := bus.NewMemoryBroker()
+	a, b := broker.Connect(), broker.Connect()
+
+	received, cancel := collect(t, b, "hub_deliver")
+	cancel()
+
+	assert.NoError(t, a.Publish(context.Background(), "hub_deliver", []byte("one")))
+	nothing(t, received)
+}
+
+func Test_MemoryTryLock(t *testing.T) {
+	broker := bus.NewMemoryBroker()
+	a, b := broker.Connect(), broker.Connect()
+	ctx := context.Background()
+
+	ok, err := a.TryLock(ctx, "random_queue")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _ = a.TryLock(ctx, "random_queue")
+	assert.True(t, ok, "still held by the same node")
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.False(t, ok)
+
+	ok, _ = b.TryLock(ctx, "other")
+	assert.True(t, ok, "locks are independent")
+
+	// The lock goes with the node
+	assert.NoError(t, a.Close())
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.True(t, ok)
+}
+
+func Test_MemoryClose(t *testing.T) {
+	broker := bus.NewMemoryBroker()
+	a, b := broker.Connect(), broker.Connect()
+
+	received, _ := collect(t, a, "hub_deliver")
+	assert.NoError(t, a.Close())
+
+	ctx := context.Background()
+	assert.NoError(t, b.Publish(ctx, "hub_deliver", []byte("one")))
+	nothing(t, received)
+
+	assert.ErrorIs(t, a.Publish(ctx, "hub_deliver", []byte("one")), bus.ErrClosed)
+
+	_, err := a.Subscribe("hub_deliver", func([]byte) {})
+	assert.ErrorIs(t, err, bus.ErrClosed)
+
+	_, err = a.TryLock(ctx, "random_queue")
+	assert.ErrorIs(t, err, bus.ErrClosed)
+}
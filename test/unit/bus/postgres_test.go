@@ -0,0 +1,106 @@
+package bus_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+)
+
+// Subscribes to the topic and waits until the listening connection of the bus picked it up
+func listen(t *testing.T, pg *fakePostgres, b bus.Bus, topic string, listeners int) <-chan string {
+	t.Helper()
+
+	received, _ := collect(t, b, topic)
+	assert.Eventually(t, func() bool { return pg.listeners(topic) == listeners }, 2*time.Second, 10*time.Millisecond)
+
+	return received
+}
+
+func Test_PostgresPublish(t *testing.T) {
+	pg := newFakePostgres(t)
+	a := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	b := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	defer a.Close()
+	defer b.Close()
+
+	fromA := listen(t, pg, a, "hub_deliver", 1)
+	fromB := listen(t, pg, b, "hub_deliver", 2)
+	other := listen(t, pg, b, "hub_random", 1)
+
+	ctx := context.Background()
+	for _, p := range []string{"one", "two", "three"} {
+		assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte(p)))
+	}
+
+	for _, received := range []<-chan string{fromA, fromB} {
+		assert.Equal(t, "one", next(t, received), "the publisher receives its own messages")
+		assert.Equal(t, "two", next(t, received))
+		assert.Equal(t, "three", next(t, received))
+	}
+
+	nothing(t, other)
+	assert.Zero(t, pg.stored(), "small payloads are sent inline")
+
+	assert.ErrorIs(t, a.Publish(ctx, "Hub Deliver", []byte("one")), bus.ErrInvalidTopic)
+}
+
+func Test_PostgresLargePayload(t *testing.T) {
+	pg := newFakePostgres(t)
+	a := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	b := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	defer a.Close()
+	defer b.Close()
+
+	received := listen(t, pg, b, "hub_deliver", 1)
+
+	ctx := context.Background()
+	for _, size := range []int{7998, 7999, 64 * 1024} {
+		payload := strings.Repeat("x", size)
+
+		assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte(payload)))
+		assert.Equal(t, payload, next(t, received))
+	}
+
+	assert.Equal(t, 2, pg.stored(), "payloads too large for a NOTIFY are stored")
+	for _, n := range pg.notifications() {
+		assert.Less(t, len(n), 8000, "every NOTIFY fits")
+	}
+}
+
+func Test_PostgresTryLock(t *testing.T) {
+	pg := newFakePostgres(t)
+	a := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	b := bus.NewPostgresBus(pg.pool(t), slog.Default())
+	defer b.Close()
+	ctx := context.Background()
+
+	ok, err := a.TryLock(ctx, "random_queue")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _ = a.TryLock(ctx, "random_queue")
+	assert.True(t, ok, "still held by the same node")
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.False(t, ok)
+
+	ok, _ = b.TryLock(ctx, "other")
+	assert.True(t, ok, "locks are independent")
+
+	// Closing the listening connection releases the locks of the node
+	assert.NoError(t, a.Close())
+
+	assert.Eventually(t, func() bool {
+		ok, _ := b.TryLock(ctx, "random_queue")
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err = a.TryLock(ctx, "random_queue")
+	assert.ErrorIs(t, err, bus.ErrClosed)
+}
@@ -0,0 +1,147 @@
+package bus_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+)
+
+func newRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return mr, rdb
+}
+
+func Test_RedisPublish(t *testing.T) {
+	for _, mode := range []string{bus.RedisPubSub, bus.RedisStreams} {
+		t.Run(mode, func(t *testing.T) {
+			_, rdb := newRedis(t)
+			a := bus.NewRedisBus(rdb, mode, 100, slog.Default())
+			b := bus.NewRedisBus(rdb, mode, 100, slog.Default())
+			defer a.Close()
+			defer b.Close()
+
+			fromA, _ := collect(t, a, "hub_deliver")
+			fromB, _ := collect(t, b, "hub_deliver")
+			other, _ := collect(t, b, "hub_random")
+
+			ctx := context.Background()
+			for _, p := range []string{"one", "two", "three"} {
+				assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte(p)))
+			}
+
+			for _, received := range []<-chan string{fromA, fromB} {
+				assert.Equal(t, "one", next(t, received), "the publisher receives its own messages")
+				assert.Equal(t, "two", next(t, received))
+				assert.Equal(t, "three", next(t, received))
+			}
+
+			nothing(t, other)
+		})
+	}
+}
+
+func Test_RedisStreamsSkipOldMessages(t *testing.T) {
+	_, rdb := newRedis(t)
+	a := bus.NewRedisBus(rdb, bus.RedisStreams, 100, slog.Default())
+	defer a.Close()
+
+	ctx := context.Background()
+	assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte("before")))
+
+	received, _ := collect(t, a, "hub_deliver")
+	nothing(t, received)
+
+	assert.NoError(t, a.Publish(ctx, "hub_deliver", []byte("after")))
+	assert.Equal(t, "after", next(t, received))
+}
+
+func Test_RedisUnsubscribe(t *testing.T) {
+	for _, mode := range []string{bus.RedisPubSub, bus.RedisStreams} {
+		t.Run(mode, func(t *testing.T) {
+			_, rdb := newRedis(t)
+			a := bus.NewRedisBus(rdb, mode, 100, slog.Default())
+			defer a.Close()
+
+			received, cancel := collect(t, a, "hub_deliver")
+			cancel()
+
+			assert.NoError(t, a.Publish(context.Background(), "hub_deliver", []byte("one")))
+			nothing(t, received)
+		})
+	}
+}
+
+func Test_RedisTryLock(t *testing.T) {
+	mr, rdb := newRedis(t)
+	a := bus.NewRedisBus(rdb, bus.RedisPubSub, 100, slog.Default())
+	b := bus.NewRedisBus(rdb, bus.RedisPubSub, 100, slog.Default())
+	c := bus.NewRedisBus(rdb, bus.RedisPubSub, 100, slog.Default())
+	defer b.Close()
+	defer c.Close()
+	ctx := context.Background()
+
+	ok, err := a.TryLock(ctx, "random_queue")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, _ = a.TryLock(ctx, "random_queue")
+	assert.True(t, ok, "still held by the same node")
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.False(t, ok)
+
+	ok, _ = b.TryLock(ctx, "other")
+	assert.True(t, ok, "locks are independent")
+
+	// Closing gives the lock up right away
+	assert.NoError(t, a.Close())
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.True(t, ok)
+
+	// A holder that stops calling TryLock loses the lock once it expires
+	mr.FastForward(5 * time.Second)
+	ok, _ = c.TryLock(ctx, "random_queue")
+	assert.False(t, ok)
+
+	mr.FastForward(11 * time.Second)
+	ok, _ = c.TryLock(ctx, "random_queue")
+	assert.True(t, ok)
+
+	ok, _ = b.TryLock(ctx, "random_queue")
+	assert.False(t, ok)
+}
+
+func Test_RedisClose(t *testing.T) {
+	_, rdb := newRedis(t)
+	a := bus.NewRedisBus(rdb, bus.RedisStreams, 100, slog.Default())
+	b := bus.NewRedisBus(rdb, bus.RedisStreams, 100, slog.Default())
+	defer b.Close()
+
+	received, _ := collect(t, a, "hub_deliver")
+	assert.NoError(t, a.Close())
+
+	ctx := context.Background()
+	assert.NoError(t, b.Publish(ctx, "hub_deliver", []byte("one")))
+	nothing(t, received)
+
+	assert.ErrorIs(t, a.Publish(ctx, "hub_deliver", []byte("one")), bus.ErrClosed)
+
+	_, err := a.Subscribe("hub_deliver", func([]byte) {})
+	assert.ErrorIs(t, err, bus.ErrClosed)
+
+	_, err = a.TryLock(ctx, "random_queue")
+	assert.ErrorIs(t, err, bus.ErrClosed)
+}
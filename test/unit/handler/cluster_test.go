@@ -0,0 +1,212 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/presence"
+)
+
+// Starts n nodes on one broker, the first node runs the random queues
+func (s *services) cluster(t *testing.T, n int, registry presence.Registry) ([]*handler.Hub, []string) {
+	t.Helper()
+
+	broker := bus.NewMemoryBroker()
+
+	hubs, urls := make([]*handler.Hub, n), make([]string, n)
+	for i := range n {
+		hubs[i], urls[i] = s.node(t, broker.Connect(), registry)
+
+		// The first hub to try takes the queue lock, so the others start once it did
+		if i == 0 {
+			join(t, urls[0], 0).ws.Close()
+		}
+	}
+
+	return hubs, urls
+}
+
+func Test_ClusterRandomSession(t *testing.T) {
+	srv := newServices()
+
+	hubs, urls := srv.cluster(t, 3, nil)
+	first, second := join(t, urls[0], 1), join(t, urls[1], 2)
+
+	first.send(&handler.Message{Type: "join_random"})
+	second.send(&handler.Message{Type: "join_random"})
+
+	sessionID := first.expect("random_joined").Session
+	assert.Equal(t, sessionID, second.expect("random_joined").Session)
+
+	// The third node took no part in the pair, the session is read from the saved ones once it was saved
+	var sess *matchmaking.Session
+	assert.Eventually(t, func() bool {
+		var ok bool
+		sess, ok = hubs[2].RandomSession(sessionID, 1)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	if assert.NotNil(t, sess) {
+		assert.Equal(t, 2, sess.Partner(1))
+	}
+
+	sess, ok := hubs[2].RandomSession("", 2)
+	if assert.True(t, ok, "the current session of a user on another node") {
+		assert.Equal(t, sessionID, sess.ID)
+	}
+
+	_, ok = hubs[2].RandomSession(sessionID, 3)
+	assert.False(t, ok, "only the users of the session get it")
+}
+
+func Test_ClusterGroupRoom(t *testing.T) {
+	srv := newServices()
+
+	_, urls := srv.cluster(t, 2, nil)
+	first, second, third := join(t, urls[0], 1), join(t, urls[0], 2), join(t, urls[1], 3)
+
+	for _, p := range []*peer{first, second, third} {
+		p.send(&handler.Message{Type: "join_random", Mode: "group"})
+	}
+
+	joined := first.expect("room_joined")
+	assert.Len(t, joined.Members, 3)
+	assert.Equal(t, joined.Session, second.expect("room_joined").Session)
+
+	remote := third.expect("room_joined")
+	assert.Equal(t, joined.Session, remote.Session, "the node of the last member opens the same room")
+	assert.Equal(t, joined.Members, remote.Members)
+
+	third.send(&handler.Message{Type: "message_random", Content: "hello"})
+	for _, p := range []*peer{first, second} {
+		m := p.expect("message_random")
+		assert.Equal(t, "hello", m.Content)
+		assert.Equal(t, remote.Alias, m.Alias)
+	}
+
+	third.send(&handler.Message{Type: "leave_random"})
+	left := first.expect("notification")
+	assert.Equal(t, "random_room_left", left.Content)
+	assert.Equal(t, remote.Alias, left.Alias)
+
+	assert.Equal(t, "random_room_left", second.expect("notification").Content)
+
+	first.send(&handler.Message{Type: "leave_random"})
+	closed := second.expect("notification")
+	assert.Equal(t, "random_room_closed", closed.Content, "the last member is told the room closed")
+}
+
+// Presence kept in memory, a failing registry errors on every lookup
+type fakePresence struct {
+	mu    sync.Mutex
+	nodes map[int]string
+	fail  bool
+}
+
+func (f *fakePresence) Register(ctx context.Context, node string, userIDs ...int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range userIDs {
+		f.nodes[id] = node
+	}
+
+	return nil
+}
+
+func (f *fakePresence) Unregister(ctx context.Context, node string, userID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.nodes[userID] == node {
+		delete(f.nodes, userID)
+	}
+
+	return nil
+}
+
+func (f *fakePresence) Lookup(ctx context.Context, userIDs ...int) (map[int]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fail {
+		return nil, errors.New("presence: registry is down")
+	}
+
+	nodes := make(map[int]string)
+	for _, id := range userIDs {
+		if node, ok := f.nodes[id]; ok {
+			nodes[id] = node
+		}
+	}
+
+	return nodes, nil
+}
+
+func (f *fakePresence) TTL() time.Duration {
+	return time.Minute
+}
+
+func Test_ClusterDirectMessage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		registry presence.Registry
+	}{
+		{name: "broadcast without a registry"},
+		{name: "node of the receiver from the registry", registry: &fakePresence{nodes: make(map[int]string)}},
+		{name: "broadcast when the lookup fails", registry: &fakePresence{nodes: make(map[int]string), fail: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, urls := newServices().cluster(t, 2, tc.registry)
+			sender, receiver := join(t, urls[0], 1), join(t, urls[1], 2)
+
+			sender.send(&handler.Message{Type: "direct_message", To: 2, Content: "hello"})
+
+			m := receiver.expect("direct_message")
+			assert.Equal(t, 1, m.From)
+			assert.Equal(t, "hello", m.Content)
+			assert.NotZero(t, m.ID, "the stored message ID is sent along")
+		})
+	}
+}
+
+func Test_ClusterRandomPair(t *testing.T) {
+	_, urls := newServices().cluster(t, 2, nil)
+	first, second := join(t, urls[0], 1), join(t, urls[1], 2)
+
+	first.send(&handler.Message{Type: "join_random"})
+	second.send(&handler.Message{Type: "join_random"})
+
+	sessionID := first.expect("random_joined").Session
+	assert.Equal(t, sessionID, second.expect("random_joined").Session, "both nodes pair their side in one session")
+
+	second.send(&handler.Message{Type: "message_random", To: 1, Content: "hello"})
+	assert.Equal(t, "hello", first.expect("message_random").Content)
+
+	second.send(&handler.Message{Type: "leave_random"})
+	left := first.expect("notification")
+	assert.Equal(t, "random_pair_left", left.Content)
+	assert.Equal(t, "LEFT", left.Code)
+	assert.Equal(t, sessionID, left.Session)
+
+	first.send(&handler.Message{Type: "join_random"})
+	second.send(&handler.Message{Type: "join_random"})
+
+	sessionID = first.expect("random_joined").Session
+	assert.Equal(t, sessionID, second.expect("random_joined").Session)
+
+	first.ws.Close()
+	left = second.expect("notification")
+	assert.Equal(t, "random_pair_left", left.Content)
+	assert.Equal(t, "DISCONNECTED", left.Code)
+	assert.Equal(t, sessionID, left.Session)
+}
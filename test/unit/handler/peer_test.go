@@ -0,0 +1,303 @@
+package handler_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/config"
+	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/presence"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+// Friendships kept in memory, the services the tests do not need are left unimplemented
+type fakeFriendships struct {
+	service.FriendshipService
+
+	mu       sync.Mutex
+	statuses map[[2]int]model.FriendshipStatus
+}
+
+func (f *fakeFriendships) set(a, b int, status model.FriendshipStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.statuses[pairOf(a, b)] = status
+}
+
+func (f *fakeFriendships) CheckStatus(ctx context.Context, data *dto.FriendshipDTO) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.statuses[pairOf(data.From, data.To)]
+	return ok, nil
+}
+
+func (f *fakeFriendships) RelatedUsers(ctx context.Context, userID int) (map[int]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	related := make(map[int]bool)
+	for pair := range f.statuses {
+		switch userID {
+		case pair[0]:
+			related[pair[1]] = true
+		case pair[1]:
+			related[pair[0]] = true
+		}
+	}
+
+	return related, nil
+}
+
+func (f *fakeFriendships) AreFriends(ctx context.Context, data *dto.FriendshipDTO) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.statuses[pairOf(data.From, data.To)] == model.FriendshipAccepted, nil
+}
+
+// Direct messages kept in memory, nothing is synced
+type fakeMessages struct {
+	service.MessageService
+
+	mu      sync.Mutex
+	lastID  int
+	chatted map[[2]int]bool
+}
+
+func (f *fakeMessages) StoreMessage(ctx context.Context, data *dto.StoreMessageDTO) (*model.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastID++
+	f.chatted[pairOf(data.From, data.To)] = true
+
+	return &model.Message{
+		ID:         f.lastID,
+		SenderID:   data.From,
+		ReceiverID: data.To,
+		Content:    data.Content,
+		Timestamp:  data.Timestamp,
+	}, nil
+}
+
+func (f *fakeMessages) SyncMessages(ctx context.Context, receiverID, afterID, limit int) ([]*model.Message, error) {
+	return nil, nil
+}
+
+func (f *fakeMessages) HasConversation(ctx context.Context, a, b int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.chatted[pairOf(a, b)], nil
+}
+
+// Every user is an adult without preferences, sessions are saved like the upserts of the repository
+type fakeRandom struct {
+	service.RandomService
+
+	mu       sync.Mutex
+	sessions map[string]*model.RandomSession
+	reports  []*dto.RandomReportDTO
+}
+
+func (f *fakeRandom) Profile(ctx context.Context, data *dto.JoinRandomDTO) (*dto.RandomProfileDTO, error) {
+	return &dto.RandomProfileDTO{UserID: data.UserID, Age: 20, Reputation: 0.5}, nil
+}
+
+func (f *fakeRandom) SaveSession(ctx context.Context, s *model.RandomSession) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	saved, ok := f.sessions[s.ID]
+	if !ok {
+		saved = &model.RandomSession{ID: s.ID, UserA: s.UserA, UserB: s.UserB, Interests: s.Interests, StartedAt: s.StartedAt}
+		f.sessions[s.ID] = saved
+	}
+
+	if saved.EndedAt == nil {
+		saved.EndedAt, saved.EndReason = s.EndedAt, s.EndReason
+	}
+
+	return nil
+}
+
+func (f *fakeRandom) Session(ctx context.Context, sessionID string) (*model.RandomSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, service.ErrRandomSessionNotExist
+	}
+
+	found := *s
+	return &found, nil
+}
+
+func (f *fakeRandom) UserSessions(ctx context.Context, userID, page int) ([]*model.RandomSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var sessions []*model.RandomSession
+	for _, s := range f.sessions {
+		if s.UserA == userID || s.UserB == userID {
+			found := *s
+			sessions = append(sessions, &found)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b *model.RandomSession) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+
+	return sessions, nil
+}
+
+func (f *fakeRandom) Report(ctx context.Context, data *dto.RandomReportDTO) (*dto.RandomReportSuccessDTO, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reports = append(f.reports, data)
+	return &dto.RandomReportSuccessDTO{ReportID: len(f.reports)}, nil
+}
+
+func pairOf(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+
+	return [2]int{a, b}
+}
+
+// The services behind the hubs of a test, shared by every node like a database would be
+type services struct {
+	friends  *fakeFriendships
+	messages *fakeMessages
+	random   *fakeRandom
+}
+
+func newServices() *services {
+	return &services{
+		friends:  &fakeFriendships{statuses: make(map[[2]int]model.FriendshipStatus)},
+		messages: &fakeMessages{chatted: make(map[[2]int]bool)},
+		random:   &fakeRandom{sessions: make(map[string]*model.RandomSession)},
+	}
+}
+
+// Starts a hub on the bus and returns the URL of its websockets
+func (s *services) node(t *testing.T, b bus.Bus, registry presence.Registry) (*handler.Hub, string) {
+	t.Helper()
+
+	hub := handler.NewHub(s.friends, s.messages, nil, s.random, nil, config.RandomChat{Matcher: config.MatcherFIFO}, b, registry, discard)
+	go hub.Run()
+
+	return hub, serveHub(t, hub, peerSocket)
+}
+
+// Keep alive of the peers, long enough to never get in the way of a test
+var peerSocket = config.Socket{
+	PingInterval:    time.Second,
+	PongTimeout:     10 * time.Second,
+	WriteTimeout:    time.Second,
+	MaxMessageSize:  64 * 1024,
+	SendBuffer:      64,
+	ControlBuffer:   16,
+	OverflowTimeout: 10 * time.Second,
+}
+
+// A connected user, the messages it receives are read in the background
+type peer struct {
+	t      *testing.T
+	userID int
+	ws     *websocket.Conn
+	in     chan *handler.Message
+}
+
+// Connects the user to the hub at url and waits until the hub registered the connection
+func join(t *testing.T, url string, userID int) *peer {
+	t.Helper()
+
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?user="+strconv.Itoa(userID), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	p := &peer{t: t, userID: userID, ws: ws, in: make(chan *handler.Message, 64)}
+	go func() {
+		defer close(p.in)
+
+		for {
+			var m handler.Message
+			if err := ws.ReadJSON(&m); err != nil {
+				return
+			}
+
+			p.in <- &m
+		}
+	}()
+
+	// A sync is only answered once the hub registered the connection
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		p.send(&handler.Message{Type: "sync"})
+		if p.await("sync_complete", 100*time.Millisecond) != nil {
+			return p
+		}
+	}
+
+	t.Fatalf("user %d was not registered by the hub", userID)
+	return nil
+}
+
+func (p *peer) send(m *handler.Message) {
+	p.t.Helper()
+
+	if err := p.ws.WriteJSON(m); err != nil {
+		p.t.Fatalf("user %d failed to send %s: %v", p.userID, m.Type, err)
+	}
+}
+
+// Returns the next message of the type, skipping the others, nil if none arrived within the timeout
+func (p *peer) await(typ string, timeout time.Duration) *handler.Message {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case m, ok := <-p.in:
+			if !ok {
+				return nil
+			}
+
+			if m.Type == typ {
+				return m
+			}
+		case <-t.C:
+			return nil
+		}
+	}
+}
+
+// Like await, fails the test if the message does not arrive
+func (p *peer) expect(typ string) *handler.Message {
+	p.t.Helper()
+
+	m := p.await(typ, 2*time.Second)
+	if m == nil {
+		p.t.Fatalf("user %d did not receive %s", p.userID, typ)
+	}
+
+	return m
+}
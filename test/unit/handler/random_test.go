@@ -0,0 +1,69 @@
+package handler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+func Test_JoinRandomSkipsRelatedUsers(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status model.FriendshipStatus
+	}{
+		{
+			name:   "friends",
+			status: model.FriendshipAccepted,
+		},
+		{
+			name:   "blocked",
+			status: model.FriendshipBlocked,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServices()
+			srv.friends.set(1, 2, tc.status)
+
+			_, url := srv.node(t, bus.NewMemoryBroker().Connect(), nil)
+			first, related, stranger := join(t, url, 1), join(t, url, 2), join(t, url, 3)
+
+			first.send(&handler.Message{Type: "join_random"})
+			time.Sleep(50 * time.Millisecond)
+			related.send(&handler.Message{Type: "join_random"})
+
+			assert.Nil(t, first.await("random_joined", 200*time.Millisecond), "related users are never paired")
+
+			stranger.send(&handler.Message{Type: "join_random"})
+
+			m := stranger.expect("random_joined")
+			assert.Equal(t, m.Session, first.expect("random_joined").Session)
+			assert.Nil(t, related.await("random_joined", 100*time.Millisecond))
+		})
+	}
+}
+
+func Test_RandomPairDisconnect(t *testing.T) {
+	srv := newServices()
+
+	_, url := srv.node(t, bus.NewMemoryBroker().Connect(), nil)
+	first, second := join(t, url, 1), join(t, url, 2)
+
+	first.send(&handler.Message{Type: "join_random"})
+	second.send(&handler.Message{Type: "join_random"})
+
+	sessionID := first.expect("random_joined").Session
+	second.expect("random_joined")
+
+	first.ws.Close()
+
+	m := second.expect("notification")
+	assert.Equal(t, "DISCONNECTED", m.Code)
+	assert.Equal(t, sessionID, m.Session)
+}
@@ -0,0 +1,67 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/handler"
+)
+
+func Test_HubShutdown(t *testing.T) {
+	hub, url := serve(t, socket)
+	ws := connect(t, url)
+
+	// The connection is registered by the hub on its own time
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- hub.Shutdown(ctx) }()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var notice struct {
+		Type       string `json:"type"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	assert.NoError(t, ws.ReadJSON(&notice))
+	assert.Equal(t, "server_shutdown", notice.Type)
+	assert.GreaterOrEqual(t, notice.RetryAfter, 1, "the client is told when to reconnect")
+
+	assert.Equal(t, websocket.CloseGoingAway, closeCode(t, ws))
+	assert.NoError(t, <-done)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake, "new websockets are refused")
+	if resp != nil {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	}
+}
+
+func Test_HubShutdownWithRandomPair(t *testing.T) {
+	srv := newServices()
+
+	hub, url := srv.node(t, bus.NewMemoryBroker().Connect(), nil)
+	first, second := join(t, url, 1), join(t, url, 2)
+
+	first.send(&handler.Message{Type: "join_random"})
+	second.send(&handler.Message{Type: "join_random"})
+
+	first.expect("random_joined")
+	second.expect("random_joined")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Both disconnects end the pair, neither may hold up the shutdown
+	assert.NoError(t, hub.Shutdown(ctx))
+}
@@ -0,0 +1,231 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/config"
+	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/origin"
+)
+
+// Starts a hub without services and returns it with the websocket URL, every connection is user 1
+func serve(t *testing.T, socket config.Socket) (*handler.Hub, string) {
+	t.Helper()
+
+	hub := handler.NewHub(nil, nil, nil, nil, nil, config.RandomChat{Matcher: config.MatcherFIFO}, bus.NewMemoryBroker().Connect(), nil, discard)
+	go hub.Run()
+
+	return hub, serveHub(t, hub, socket)
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// Serves the websockets of the hub and returns their URL, the user of a connection is the user query parameter, 1 without one
+func serveHub(t *testing.T, hub *handler.Hub, socket config.Socket) string {
+	t.Helper()
+
+	origins, _ := origin.NewPolicy([]string{"https://whirl.app"}, false)
+	chat := handler.NewChatHandler(discard, handler.NewResponseHandler(discard), hub, socket, origins)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := 1
+		if user := r.URL.Query().Get("user"); user != "" {
+			userID, _ = strconv.Atoi(user)
+		}
+
+		chat.SocketConnect(w, r.WithContext(context.WithValue(r.Context(), "userID", userID)))
+	}))
+
+	// A small send buffer makes a client that does not read block the writes within a few messages
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if tcp, ok := conn.(*net.TCPConn); ok && state == http.StateNew {
+			tcp.SetWriteBuffer(4096)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	// Runs before the server is closed, once the connections of the test are
+	t.Cleanup(func() {
+		assert.Eventually(t, func() bool { return counter("open") == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func connect(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() {
+		ws.Close()
+
+		// The server counts the close on its own time, the next test must not see it
+		assert.Eventually(t, func() bool { return counter("open") == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	return ws
+}
+
+func dial(t *testing.T, socket config.Socket) *websocket.Conn {
+	t.Helper()
+
+	_, url := serve(t, socket)
+
+	return connect(t, url)
+}
+
+func counter(key string) int64 {
+	v, ok := expvar.Get("websocket").(*expvar.Map).Get(key).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+
+	return v.Value()
+}
+
+// Reads until the connection fails and returns the close code, zero if it was not closed with a close frame
+func closeCode(t *testing.T, ws *websocket.Conn) int {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return closeErr.Code
+			}
+
+			return 0
+		}
+	}
+}
+
+var socket = config.Socket{
+	PingInterval:    20 * time.Millisecond,
+	PongTimeout:     100 * time.Millisecond,
+	WriteTimeout:    time.Second,
+	MaxMessageSize:  128,
+	SendBuffer:      8,
+	ControlBuffer:   4,
+	OverflowTimeout: time.Second,
+}
+
+func Test_SocketReadLimit(t *testing.T) {
+	before := counter("reaped_read_limit")
+	ws := dial(t, socket)
+
+	large := `{"type":"typing_start","content":"` + strings.Repeat("a", 200) + `"}`
+	assert.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte(large)))
+
+	assert.Equal(t, websocket.CloseMessageTooBig, closeCode(t, ws))
+	assert.Equal(t, before+1, counter("reaped_read_limit"))
+}
+
+func Test_SocketPongTimeout(t *testing.T) {
+	before := counter("reaped_pong_timeout")
+	ws := dial(t, socket)
+
+	// A client that never answers the pings
+	ws.SetPingHandler(func(string) error { return nil })
+
+	assert.Equal(t, websocket.CloseGoingAway, closeCode(t, ws))
+	assert.Equal(t, before+1, counter("reaped_pong_timeout"))
+}
+
+func Test_SocketKeepAlive(t *testing.T) {
+	before := counter("reaped_pong_timeout")
+	ws := dial(t, socket)
+
+	// The default ping handler answers with a pong, which keeps the connection open well past the pong timeout
+	ws.SetReadDeadline(time.Now().Add(5 * socket.PongTimeout))
+	_, _, err := ws.ReadMessage()
+
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "the connection is still open")
+	assert.Equal(t, before, counter("reaped_pong_timeout"))
+}
+
+func Test_SocketClientClose(t *testing.T) {
+	before := counter("closed_by_client")
+	ws := dial(t, socket)
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	assert.NoError(t, ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)))
+
+	assert.Equal(t, websocket.CloseNormalClosure, closeCode(t, ws), "the server echoes the close frame")
+	assert.Eventually(t, func() bool {
+		return counter("closed_by_client") == before+1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_SocketSlowConsumer(t *testing.T) {
+	before := counter("reaped_slow_consumer")
+
+	slow := socket
+	slow.PongTimeout = 10 * time.Second
+	slow.WriteTimeout = 10 * time.Second
+	slow.OverflowTimeout = 50 * time.Millisecond
+
+	_, url := serve(t, slow)
+	ws := connect(t, url)
+
+	// Every unknown message is answered with an error, a client that never reads fills its queues
+	go func() {
+		for {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"unknown"}`)); err != nil {
+				return
+			}
+		}
+	}()
+
+	assert.Eventually(t, func() bool {
+		return counter("reaped_slow_consumer") == before+1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// The next connection learns how many messages the last one missed
+	ws = connect(t, url)
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var notice struct {
+		Type    string `json:"type"`
+		Dropped int64  `json:"dropped"`
+	}
+	assert.NoError(t, ws.ReadJSON(&notice))
+	assert.Equal(t, "messages_dropped", notice.Type)
+	assert.Positive(t, notice.Dropped)
+}
+
+func Test_SocketOrigin(t *testing.T) {
+	_, url := serve(t, socket)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example"}})
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	if resp != nil {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://whirl.app"}})
+	assert.NoError(t, err)
+	if ws != nil {
+		ws.Close()
+		assert.Eventually(t, func() bool { return counter("open") == 0 }, time.Second, 10*time.Millisecond)
+	}
+}
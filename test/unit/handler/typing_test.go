@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/bus"
+	"github.com/jlry-dev/whirl/internal/handler"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+func Test_RelayTyping(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  model.FriendshipStatus // Empty without a relationship
+		chatted bool
+		relayed bool
+	}{
+		{
+			name:    "friends",
+			status:  model.FriendshipAccepted,
+			relayed: true,
+		},
+		{
+			name:    "existing conversation",
+			chatted: true,
+			relayed: true,
+		},
+		{
+			name:    "stranger",
+			relayed: false,
+		},
+		{
+			name:    "blocked despite a conversation",
+			status:  model.FriendshipBlocked,
+			chatted: true,
+			relayed: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServices()
+			if tc.status != "" {
+				srv.friends.set(1, 2, tc.status)
+			}
+			srv.messages.chatted[pairOf(1, 2)] = tc.chatted
+
+			_, url := srv.node(t, bus.NewMemoryBroker().Connect(), nil)
+			sender, receiver := join(t, url, 1), join(t, url, 2)
+
+			sender.send(&handler.Message{Type: "typing_start", To: 2})
+
+			if tc.relayed {
+				m := receiver.expect("typing_start")
+				assert.Equal(t, 1, m.From)
+
+				sender.send(&handler.Message{Type: "typing_stop", To: 2})
+				receiver.expect("typing_stop")
+				return
+			}
+
+			assert.Equal(t, "NOT_CHAT_PEER", sender.expect("error").Code)
+			assert.Nil(t, receiver.await("typing_start", 100*time.Millisecond), "a stranger does not learn the sender is online")
+		})
+	}
+}
+
+func Test_RelayTypingStopWithoutStart(t *testing.T) {
+	srv := newServices()
+
+	_, url := srv.node(t, bus.NewMemoryBroker().Connect(), nil)
+	sender, receiver := join(t, url, 1), join(t, url, 3)
+
+	// Nothing is showing so nothing is relayed, and the stranger check is not needed to know that
+	sender.send(&handler.Message{Type: "typing_stop", To: 3})
+
+	assert.Nil(t, receiver.await("typing_stop", 100*time.Millisecond))
+	assert.Nil(t, sender.await("error", 50*time.Millisecond))
+}
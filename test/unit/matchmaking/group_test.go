@@ -0,0 +1,104 @@
+package matchmaking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+)
+
+// Returns the rooms as lists of user IDs so they are easy to compare
+func groupIDs(groups []*matchmaking.Group) [][]int {
+	ids := make([][]int, 0, len(groups))
+	for _, g := range groups {
+		members := make([]int, 0, len(g.Members))
+		for _, e := range g.Members {
+			members = append(members, e.UserID)
+		}
+
+		ids = append(ids, members)
+	}
+
+	return ids
+}
+
+func Test_GroupMatch(t *testing.T) {
+	wait := 10 * time.Second
+
+	testCases := []struct {
+		name      string
+		entries   []*matchmaking.Entry
+		allow     matchmaking.AllowFunc
+		after     time.Duration
+		exp       [][]int
+		expShared [][]string
+		expLeft   int
+	}{
+		{
+			name:    "waits for the minimum size",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0)},
+			exp:     [][]int{},
+			expLeft: 2,
+		},
+		{
+			name:      "fills rooms up to the maximum size",
+			entries:   []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0), entry(4, 0), entry(5, 0)},
+			exp:       [][]int{{1, 2, 3, 4}},
+			expShared: [][]string{nil},
+			expLeft:   1,
+		},
+		{
+			name: "users sharing interests are grouped first",
+			entries: []*matchmaking.Entry{
+				entry(1, 0, "go"), entry(2, 0, "music"), entry(3, 0, "go", "music"), entry(4, 0, "music"), entry(5, 0, "go"),
+			},
+			exp:       [][]int{{1, 3, 5}},
+			expShared: [][]string{{"go"}},
+			expLeft:   2,
+		},
+		{
+			name:    "users with interests wait before joining anyone",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0), entry(3, 0)},
+			after:   5 * time.Second,
+			exp:     [][]int{},
+			expLeft: 3,
+		},
+		{
+			name:      "anyone once the wait is over",
+			entries:   []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0), entry(3, 0, "music")},
+			after:     wait,
+			exp:       [][]int{{1, 2, 3}},
+			expShared: [][]string{nil},
+			expLeft:   0,
+		},
+		{
+			name:    "every member has to accept every other member",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0), entry(4, 0)},
+			allow: func(a, b *matchmaking.Entry) bool {
+				return !(a.UserID == 2 && b.UserID == 3)
+			},
+			exp:       [][]int{{1, 2, 4}},
+			expShared: [][]string{nil},
+			expLeft:   1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := matchmaking.NewGroupMatcher(matchmaking.Config{Allow: tc.allow, InterestWait: wait}, 3, 4)
+			for _, e := range tc.entries {
+				m.Enqueue(e)
+			}
+
+			groups := m.Match(start.Add(tc.after))
+			assert.Equal(t, tc.exp, groupIDs(groups))
+			assert.Equal(t, tc.expLeft, m.Len())
+
+			for i, g := range groups {
+				assert.Equal(t, tc.expShared[i], g.Shared)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package matchmaking_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/model"
+)
+
+func Test_MemoryHistory(t *testing.T) {
+	h := matchmaking.NewMemoryHistory(time.Minute)
+	h.Record(1, 2, start)
+
+	assert.True(t, h.Recent(1, 2, start.Add(30*time.Second)))
+	assert.True(t, h.Recent(2, 1, start.Add(30*time.Second)), "order of the users does not matter")
+	assert.False(t, h.Recent(1, 3, start.Add(30*time.Second)))
+	assert.False(t, h.Recent(1, 2, start.Add(time.Minute)), "outside the window")
+
+	// Recording after the window prunes the expired pairings
+	h.Record(3, 4, start.Add(2*time.Minute))
+	assert.Equal(t, 1, h.Len())
+}
+
+func Test_RecentPartners(t *testing.T) {
+	wait := 10 * time.Second
+
+	testCases := []struct {
+		name    string
+		entries []*matchmaking.Entry
+		after   time.Duration
+		exp     [][2]int
+	}{
+		{
+			name:    "avoids the recent partner",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0), entry(4, 0), entry(5, 0)},
+			exp:     [][2]int{{1, 3}, {2, 4}},
+		},
+		{
+			name:    "thin queue waits before pairing recent partners",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0)},
+			after:   5 * time.Second,
+			exp:     [][2]int{},
+		},
+		{
+			name:    "thin queue pairs recent partners after the wait",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0)},
+			after:   wait,
+			exp:     [][2]int{{1, 2}},
+		},
+		{
+			name:    "busy queue never pairs recent partners",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0, "go"), entry(4, 0, "music"), entry(5, 0, "art")},
+			after:   5 * time.Second,
+			exp:     [][2]int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, newMatcher := range map[string]func(matchmaking.Config) matchmaking.Matcher{
+				"fifo": matchmaking.NewFIFO,
+				"scored": func(cfg matchmaking.Config) matchmaking.Matcher {
+					return matchmaking.NewScored(cfg, matchmaking.InterestScore(cfg.InterestWait, 0))
+				},
+			} {
+				t.Run(name, func(t *testing.T) {
+					history := matchmaking.NewMemoryHistory(time.Hour)
+					history.Record(1, 2, start)
+
+					m := newMatcher(matchmaking.Config{InterestWait: wait, History: history, ThinQueue: 3})
+					for _, e := range tc.entries {
+						m.Enqueue(e)
+					}
+
+					assert.Equal(t, tc.exp, pairIDs(m.Match(start.Add(tc.after))))
+				})
+			}
+		})
+	}
+}
+
+func Test_MatchLeavesHistoryToCaller(t *testing.T) {
+	history := matchmaking.NewMemoryHistory(time.Hour)
+
+	m := matchmaking.NewFIFO(matchmaking.Config{History: history})
+	m.Enqueue(entry(1, 0))
+	m.Enqueue(entry(2, 0))
+	assert.Equal(t, [][2]int{{1, 2}}, pairIDs(m.Match(start)))
+
+	// The pair may still fall through, e.g. when one of the users went offline
+	assert.False(t, history.Recent(1, 2, start.Add(time.Minute)), "matching alone does not make recent partners")
+}
+
+type fakeStore struct {
+	sessions []*model.RandomSession
+	loadErr  error
+}
+
+func (s *fakeStore) RecentSessions(ctx context.Context, since time.Time) ([]*model.RandomSession, error) {
+	return s.sessions, s.loadErr
+}
+
+func Test_PersistentHistory(t *testing.T) {
+	store := &fakeStore{
+		sessions: []*model.RandomSession{{ID: "s1", UserA: 1, UserB: 2, StartedAt: start}},
+	}
+
+	h := matchmaking.NewPersistentHistory(matchmaking.NewMemoryHistory(time.Hour), store)
+	assert.NoError(t, h.Load(context.Background(), start.Add(time.Minute)))
+	assert.True(t, h.Recent(1, 2, start.Add(time.Minute)))
+
+	h.Record(3, 4, start.Add(time.Minute))
+	assert.True(t, h.Recent(3, 4, start.Add(time.Minute)))
+
+	store.loadErr = errors.New("database error")
+	assert.Error(t, h.Load(context.Background(), start))
+}
@@ -0,0 +1,280 @@
+package matchmaking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+)
+
+var start = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func entry(userID int, queuedAfter time.Duration, interests ...string) *matchmaking.Entry {
+	return &matchmaking.Entry{
+		UserID:    userID,
+		Interests: interests,
+		QueuedAt:  start.Add(queuedAfter),
+	}
+}
+
+// Returns the pairs as user ID tuples so they are easy to compare
+func pairIDs(pairs []*matchmaking.Pair) [][2]int {
+	ids := make([][2]int, 0, len(pairs))
+	for _, p := range pairs {
+		ids = append(ids, [2]int{p.A.UserID, p.B.UserID})
+	}
+
+	return ids
+}
+
+func Test_Queue(t *testing.T) {
+	m := matchmaking.NewFIFO(matchmaking.Config{})
+
+	assert.True(t, m.Enqueue(entry(1, 0)))
+	assert.False(t, m.Enqueue(entry(1, 0)), "already queued")
+	assert.True(t, m.Enqueue(entry(2, 0)))
+	assert.Equal(t, 2, m.Len())
+
+	assert.True(t, m.Dequeue(1))
+	assert.False(t, m.Dequeue(1), "not queued")
+	assert.Equal(t, 1, m.Len())
+}
+
+func Test_QueueEntries(t *testing.T) {
+	m := matchmaking.NewFIFO(matchmaking.Config{})
+	m.Enqueue(entry(1, time.Second))
+	m.Enqueue(entry(2, 0))
+	m.Enqueue(entry(3, 2*time.Second))
+
+	ids := []int{}
+	for _, e := range m.Entries() {
+		ids = append(ids, e.UserID)
+	}
+	assert.Equal(t, []int{2, 1, 3}, ids, "longest waiting first")
+}
+
+func Test_QueueExpire(t *testing.T) {
+	m := matchmaking.NewFIFO(matchmaking.Config{})
+	m.Enqueue(entry(1, 0))
+	m.Enqueue(entry(2, time.Minute))
+	m.Enqueue(entry(3, 30*time.Second))
+
+	expired := m.Expire(start.Add(time.Minute))
+	assert.Len(t, expired, 2)
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, 2, m.Entries()[0].UserID)
+
+	assert.Empty(t, m.Expire(start.Add(time.Minute)))
+}
+
+func Test_FIFOMatch(t *testing.T) {
+	wait := 10 * time.Second
+
+	testCases := []struct {
+		name    string
+		entries []*matchmaking.Entry
+		allow   matchmaking.AllowFunc
+		after   time.Duration // When the match runs
+		exp     [][2]int
+		expLeft int
+	}{
+		{
+			name:    "pairs in queue order",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0), entry(4, 0), entry(5, 0)},
+			exp:     [][2]int{{1, 2}, {3, 4}},
+			expLeft: 1,
+		},
+		{
+			name:    "prefers most shared interests",
+			entries: []*matchmaking.Entry{entry(1, 0, "go", "music"), entry(2, 0, "go"), entry(3, 0, "music", "go")},
+			exp:     [][2]int{{1, 3}},
+			expLeft: 1,
+		},
+		{
+			name:    "waits for shared interests",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0, "music")},
+			after:   5 * time.Second,
+			exp:     [][2]int{},
+			expLeft: 2,
+		},
+		{
+			name:    "matches anyone after the wait",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0, "music")},
+			after:   wait,
+			exp:     [][2]int{{1, 2}},
+		},
+		{
+			name:    "both sides have to be done waiting",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 8*time.Second, "music")},
+			after:   wait,
+			exp:     [][2]int{},
+			expLeft: 2,
+		},
+		{
+			name:    "users without interests never wait",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0)},
+			exp:     [][2]int{{1, 2}},
+		},
+		{
+			name:    "skips pairs that are not allowed",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0)},
+			allow: func(a, b *matchmaking.Entry) bool {
+				return !(a.UserID == 1 && b.UserID == 2)
+			},
+			exp:     [][2]int{{1, 3}},
+			expLeft: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := matchmaking.NewFIFO(matchmaking.Config{Allow: tc.allow, InterestWait: wait})
+			for _, e := range tc.entries {
+				m.Enqueue(e)
+			}
+
+			assert.Equal(t, tc.exp, pairIDs(m.Match(start.Add(tc.after))))
+			assert.Equal(t, tc.expLeft, m.Len())
+		})
+	}
+}
+
+func Test_FIFOSharedInterests(t *testing.T) {
+	m := matchmaking.NewFIFO(matchmaking.Config{InterestWait: time.Minute})
+	m.Enqueue(entry(1, 0, "go", "music", "art"))
+	m.Enqueue(entry(2, 0, "art", "go"))
+
+	pairs := m.Match(start)
+	if assert.Len(t, pairs, 1) {
+		assert.Equal(t, []string{"go", "art"}, pairs[0].Shared)
+	}
+}
+
+func Test_ScoredMatch(t *testing.T) {
+	wait := 10 * time.Second
+
+	testCases := []struct {
+		name    string
+		entries []*matchmaking.Entry
+		allow   matchmaking.AllowFunc
+		after   time.Duration
+		exp     [][2]int
+		expLeft int
+	}{
+		{
+			name: "best pairs are taken first",
+			// FIFO would let user 1 pick first and take user 2
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0, "go", "music"), entry(3, 0, "music", "go")},
+			exp:     [][2]int{{2, 3}},
+			expLeft: 1,
+		},
+		{
+			name:    "equal scores go to the longest waiting user",
+			entries: []*matchmaking.Entry{entry(1, 0), entry(2, 0), entry(3, 0)},
+			exp:     [][2]int{{1, 2}},
+			expLeft: 1,
+		},
+		{
+			name:    "waits for shared interests",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0, "music")},
+			after:   5 * time.Second,
+			exp:     [][2]int{},
+			expLeft: 2,
+		},
+		{
+			name:    "skips pairs that are not allowed",
+			entries: []*matchmaking.Entry{entry(1, 0, "go"), entry(2, 0, "go"), entry(3, 0)},
+			allow: func(a, b *matchmaking.Entry) bool {
+				return !(a.UserID == 1 && b.UserID == 2)
+			},
+			after:   wait,
+			exp:     [][2]int{{1, 3}},
+			expLeft: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := matchmaking.NewScored(matchmaking.Config{Allow: tc.allow, InterestWait: wait}, matchmaking.InterestScore(wait, 0.1))
+			for _, e := range tc.entries {
+				m.Enqueue(e)
+			}
+
+			assert.Equal(t, tc.exp, pairIDs(m.Match(start.Add(tc.after))))
+			assert.Equal(t, tc.expLeft, m.Len())
+		})
+	}
+}
+
+func Test_ReputationScore(t *testing.T) {
+	withReputation := func(e *matchmaking.Entry, rep float64) *matchmaking.Entry {
+		e.Profile = &dto.RandomProfileDTO{UserID: e.UserID, Reputation: rep}
+		return e
+	}
+
+	m := matchmaking.NewScored(matchmaking.Config{}, matchmaking.ReputationScore(matchmaking.InterestScore(0, 0), 1))
+	m.Enqueue(withReputation(entry(1, 0), 0.9))
+	m.Enqueue(withReputation(entry(2, 0), 0.1))
+	m.Enqueue(withReputation(entry(3, 0), 0.8))
+	m.Enqueue(withReputation(entry(4, 0), 0.2))
+
+	assert.Equal(t, [][2]int{{1, 3}, {2, 4}}, pairIDs(m.Match(start)))
+}
+
+func Test_Simulation(t *testing.T) {
+	sim := matchmaking.Simulation{
+		Start:    start,
+		Tick:     time.Second,
+		Duration: 30 * time.Second,
+		Arrivals: []matchmaking.Arrival{
+			{At: 0, Entry: &matchmaking.Entry{UserID: 1, Interests: []string{"go"}}},
+			{At: time.Second, Entry: &matchmaking.Entry{UserID: 2, Interests: []string{"music"}}},
+			{At: 2 * time.Second, Entry: &matchmaking.Entry{UserID: 3, Interests: []string{"go"}}},
+			{At: 3 * time.Second, Leave: 5 * time.Second, Entry: &matchmaking.Entry{UserID: 4, Interests: []string{"art"}}},
+			{At: 20 * time.Second, Entry: &matchmaking.Entry{UserID: 5}},
+		},
+	}
+
+	res := sim.Run(matchmaking.NewFIFO(matchmaking.Config{InterestWait: 10 * time.Second}))
+
+	assert.Equal(t, []matchmaking.SimulatedPair{
+		{At: 2 * time.Second, A: 1, B: 3, Shared: []string{"go"}},
+		{At: 20 * time.Second, A: 2, B: 5},
+	}, res.Pairs)
+	assert.Equal(t, []int{4}, res.Left)
+	assert.Empty(t, res.Waiting)
+	assert.Equal(t, (2*time.Second+0+19*time.Second+0)/4, res.MeanWait)
+}
+
+func Test_SimulationDeterministic(t *testing.T) {
+	tags := []string{"go", "music", "art", "games", "movies"}
+
+	run := func(m matchmaking.Matcher) *matchmaking.SimulationResult {
+		return matchmaking.Simulation{
+			Start:    start,
+			Tick:     time.Second,
+			Duration: 2 * time.Minute,
+			Arrivals: matchmaking.RandomArrivals(42, 200, time.Minute, tags),
+		}.Run(m)
+	}
+
+	for name, newMatcher := range map[string]func() matchmaking.Matcher{
+		"fifo": func() matchmaking.Matcher {
+			return matchmaking.NewFIFO(matchmaking.Config{InterestWait: 10 * time.Second})
+		},
+		"scored": func() matchmaking.Matcher {
+			return matchmaking.NewScored(matchmaking.Config{InterestWait: 10 * time.Second}, matchmaking.InterestScore(10*time.Second, 0.1))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			first, second := run(newMatcher()), run(newMatcher())
+
+			assert.Equal(t, first, second)
+			assert.Equal(t, 100, len(first.Pairs), "everyone gets paired once the interest wait is over")
+			assert.Empty(t, first.Waiting)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package matchmaking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+)
+
+func Test_SessionLookup(t *testing.T) {
+	s := matchmaking.NewSessions(time.Hour)
+
+	sess := s.Start(1, 2, []string{"go"}, start)
+	assert.NotEmpty(t, sess.ID)
+	assert.Equal(t, 2, sess.Partner(1))
+	assert.Equal(t, 1, sess.Partner(2))
+
+	found, ok := s.Get(sess.ID, 2, start)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"go"}, found.Shared)
+
+	_, ok = s.Get(sess.ID, 3, start)
+	assert.False(t, ok, "not a participant")
+
+	_, ok = s.Get("unknown", 1, start)
+	assert.False(t, ok)
+}
+
+func Test_SessionEnd(t *testing.T) {
+	s := matchmaking.NewSessions(time.Hour)
+	sess := s.Start(1, 2, nil, start)
+
+	ended := s.End(sess.ID, start.Add(time.Minute))
+	assert.NotNil(t, ended)
+	assert.Equal(t, start.Add(time.Minute), ended.EndedAt)
+	assert.Nil(t, s.End(sess.ID, start.Add(2*time.Minute)), "already ended")
+
+	// Ended sessions can still be reported until the TTL passed
+	_, ok := s.Get(sess.ID, 1, start.Add(59*time.Minute))
+	assert.True(t, ok)
+
+	_, ok = s.Get(sess.ID, 1, start.Add(61*time.Minute))
+	assert.False(t, ok)
+}
+
+func Test_SessionAdd(t *testing.T) {
+	s := matchmaking.NewSessions(time.Hour)
+
+	// Started on another node and only handed over
+	sess := matchmaking.NewSession(1, 2, nil, start)
+	_, ok := s.Get(sess.ID, 1, start)
+	assert.False(t, ok)
+
+	s.Add(sess, start)
+	found, ok := s.Get(sess.ID, 2, start)
+	assert.True(t, ok)
+	assert.Equal(t, sess.ID, found.ID)
+}
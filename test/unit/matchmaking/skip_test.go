@@ -0,0 +1,71 @@
+package matchmaking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+)
+
+func Test_SkipInterval(t *testing.T) {
+	l := matchmaking.NewSkipLimiter(2*time.Second, 0, time.Minute, time.Minute)
+
+	_, ok := l.Skip(1, start)
+	assert.True(t, ok)
+
+	retryAfter, ok := l.Skip(1, start.Add(500*time.Millisecond))
+	assert.False(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, retryAfter)
+
+	_, ok = l.Skip(2, start.Add(500*time.Millisecond))
+	assert.True(t, ok, "limits are per user")
+
+	_, ok = l.Skip(1, start.Add(2*time.Second))
+	assert.True(t, ok)
+}
+
+func Test_SkipCooldown(t *testing.T) {
+	l := matchmaking.NewSkipLimiter(time.Second, 3, time.Minute, 2*time.Minute)
+
+	at := start
+	for i := 0; i < 3; i++ {
+		_, ok := l.Skip(1, at)
+		assert.True(t, ok)
+		at = at.Add(time.Second)
+	}
+
+	// The skip over the limit starts the cooldown
+	retryAfter, ok := l.Skip(1, at)
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Minute, retryAfter)
+	assert.Equal(t, 2*time.Minute, l.Cooldown(1, at))
+
+	retryAfter, ok = l.Skip(1, at.Add(time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute, retryAfter)
+	assert.Equal(t, time.Duration(0), l.Cooldown(2, at), "other users are not affected")
+
+	at = at.Add(2 * time.Minute)
+	assert.Equal(t, time.Duration(0), l.Cooldown(1, at))
+
+	_, ok = l.Skip(1, at)
+	assert.True(t, ok, "skips before the cooldown are forgotten")
+}
+
+func Test_SkipWindow(t *testing.T) {
+	l := matchmaking.NewSkipLimiter(0, 2, time.Minute, time.Minute)
+
+	_, ok := l.Skip(1, start)
+	assert.True(t, ok)
+	_, ok = l.Skip(1, start.Add(30*time.Second))
+	assert.True(t, ok)
+
+	// The first skip left the window
+	_, ok = l.Skip(1, start.Add(time.Minute))
+	assert.True(t, ok)
+
+	_, ok = l.Skip(1, start.Add(61*time.Second))
+	assert.False(t, ok)
+}
@@ -0,0 +1,42 @@
+package matchmaking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/matchmaking"
+)
+
+func Test_WaitEstimate(t *testing.T) {
+	w := matchmaking.NewWaitEstimator(time.Minute)
+
+	_, ok := w.Estimate(1, start)
+	assert.False(t, ok, "no matches yet")
+
+	// 6 users per minute, one every 10 seconds
+	w.Record(2, start)
+	w.Record(0, start.Add(5*time.Second))
+	w.Record(4, start.Add(10*time.Second))
+
+	wait, ok := w.Estimate(1, start.Add(20*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+
+	wait, _ = w.Estimate(3, start.Add(20*time.Second))
+	assert.Equal(t, 30*time.Second, wait)
+}
+
+func Test_WaitEstimateWindow(t *testing.T) {
+	w := matchmaking.NewWaitEstimator(time.Minute)
+	w.Record(2, start)
+	w.Record(2, start.Add(30*time.Second))
+
+	wait, ok := w.Estimate(1, start.Add(time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait, "the first match fell out of the window")
+
+	_, ok = w.Estimate(1, start.Add(2*time.Minute))
+	assert.False(t, ok)
+}
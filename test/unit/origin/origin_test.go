@@ -0,0 +1,71 @@
+package origin_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/origin"
+)
+
+func Test_PolicyAllow(t *testing.T) {
+	p, err := origin.NewPolicy([]string{"https://whirl.app", "https://*.whirl.dev", "http://staging.whirl.app:8080/"}, false)
+	assert.NoError(t, err)
+	assert.False(t, p.AllowsAll())
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://whirl.app", true},
+		{"https://WHIRL.app", true},
+		{"https://whirl.app:443", true},
+		{"", true},
+		{"http://whirl.app", false},
+		{"https://whirl.app:8443", false},
+		{"https://whirl.app.evil.com", false},
+		{"https://evilwhirl.app", false},
+		{"https://app.whirl.dev", true},
+		{"https://a.b.whirl.dev", true},
+		{"https://whirl.dev", false},
+		{"https://evilwhirl.dev", false},
+		{"http://staging.whirl.app:8080", true},
+		{"http://staging.whirl.app", false},
+		{"http://localhost:3000", false},
+		{"null", false},
+		{"https://whirl.app/path", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, p.Allow(tt.origin), tt.origin)
+	}
+}
+
+func Test_PolicyDevMode(t *testing.T) {
+	p, _ := origin.NewPolicy([]string{"https://whirl.app"}, true)
+
+	assert.True(t, p.Allow("http://localhost:3000"))
+	assert.True(t, p.Allow("https://localhost"))
+	assert.True(t, p.Allow("http://127.0.0.1:5173"))
+	assert.True(t, p.Allow("http://[::1]:5173"))
+	assert.True(t, p.Allow("https://whirl.app"))
+	assert.False(t, p.Allow("http://localhost.evil.com"))
+	assert.False(t, p.Allow("ws://localhost:3000"))
+}
+
+func Test_PolicyAllowAll(t *testing.T) {
+	for _, allowed := range [][]string{nil, {"*"}, {"https://whirl.app", "*"}} {
+		p, err := origin.NewPolicy(allowed, false)
+		assert.NoError(t, err)
+		assert.True(t, p.AllowsAll())
+		assert.True(t, p.Allow("https://anything.example"))
+		assert.True(t, p.Allow("null"))
+	}
+}
+
+func Test_PolicyInvalid(t *testing.T) {
+	for _, allowed := range []string{"whirl.app", "ftp://whirl.app", "https://*", "https://a.*.whirl.app", "https://whirl.app/path", "https://"} {
+		_, err := origin.NewPolicy([]string{allowed}, false)
+		assert.ErrorIs(t, err, origin.ErrInvalidPattern, allowed)
+	}
+}
@@ -0,0 +1,78 @@
+package presence_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/presence"
+)
+
+func newRegistry(t *testing.T) (*miniredis.Miniredis, presence.Registry) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return mr, presence.NewRedisRegistry(rdb, 30*time.Second)
+}
+
+func Test_RedisLookup(t *testing.T) {
+	_, r := newRegistry(t)
+	ctx := context.Background()
+
+	assert.NoError(t, r.Register(ctx, "a", 1, 2))
+	assert.NoError(t, r.Register(ctx, "b", 3))
+
+	nodes, err := r.Lookup(ctx, 1, 2, 3, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "a", 2: "a", 3: "b"}, nodes, "offline users are left out")
+
+	// Connecting to another node moves the user
+	assert.NoError(t, r.Register(ctx, "b", 1))
+
+	nodes, _ = r.Lookup(ctx, 1)
+	assert.Equal(t, map[int]string{1: "b"}, nodes)
+
+	nodes, err = r.Lookup(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, nodes)
+}
+
+func Test_RedisExpiry(t *testing.T) {
+	mr, r := newRegistry(t)
+	ctx := context.Background()
+
+	assert.NoError(t, r.Register(ctx, "a", 1, 2))
+
+	mr.FastForward(20 * time.Second)
+	assert.NoError(t, r.Register(ctx, "a", 1))
+
+	mr.FastForward(20 * time.Second)
+	nodes, _ := r.Lookup(ctx, 1, 2)
+	assert.Equal(t, map[int]string{1: "a"}, nodes, "only the refreshed user is still online")
+}
+
+func Test_RedisUnregister(t *testing.T) {
+	_, r := newRegistry(t)
+	ctx := context.Background()
+
+	assert.NoError(t, r.Register(ctx, "a", 1))
+	assert.NoError(t, r.Register(ctx, "b", 1))
+
+	// The user left node a after connecting to node b, it stays online on b
+	assert.NoError(t, r.Unregister(ctx, "a", 1))
+
+	nodes, _ := r.Lookup(ctx, 1)
+	assert.Equal(t, map[int]string{1: "b"}, nodes)
+
+	assert.NoError(t, r.Unregister(ctx, "b", 1))
+
+	nodes, _ = r.Lookup(ctx, 1)
+	assert.Empty(t, nodes)
+}
@@ -0,0 +1,352 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/jlry-dev/whirl/internal/service"
+	"github.com/jlry-dev/whirl/internal/storage"
+	"github.com/jlry-dev/whirl/test/mocks"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// A png whose header claims w x h pixels, it cannot be decoded past the header
+func pngHeader(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	buf := pngBytes(t, 1, 1)
+
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height, ... and a crc of type and data
+	ihdr := buf[8 : 8+8+13+4]
+	binary.BigEndian.PutUint32(ihdr[8:], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[12:], uint32(h))
+	binary.BigEndian.PutUint32(ihdr[21:], crc32.ChecksumIEEE(ihdr[4:21]))
+
+	return buf
+}
+
+// A lossless 1x1 webp
+func webpBytes(t *testing.T) []byte {
+	t.Helper()
+
+	buf, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func Test_UploadAttachment(t *testing.T) {
+	testCases := []struct {
+		name      string
+		file      func(t *testing.T) []byte
+		fileName  string
+		mockSetup func(ar *mocks.MockAttachmentRepo)
+		wantErr   bool
+		expErr    error
+		expMime   string
+		expThumb  bool
+	}{
+		{
+			name:     "valid image upload",
+			file:     func(t *testing.T) []byte { return pngBytes(t, 800, 600) },
+			fileName: "photo.png",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {
+				ar.On("CreateAttachment", mock.Anything, mock.Anything, mock.MatchedBy(func(a *model.Attachment) bool {
+					return a.UploaderID == 1 && a.MimeType == "image/png" && a.FileName == "photo.png" && a.ThumbnailKey != nil
+				})).Return(10, nil)
+			},
+			wantErr:  false,
+			expMime:  "image/png",
+			expThumb: true,
+		},
+		{
+			name:     "valid webp upload",
+			file:     webpBytes,
+			fileName: "sticker.webp",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {
+				ar.On("CreateAttachment", mock.Anything, mock.Anything, mock.MatchedBy(func(a *model.Attachment) bool {
+					return a.MimeType == "image/webp" && a.ThumbnailKey != nil
+				})).Return(12, nil)
+			},
+			wantErr:  false,
+			expMime:  "image/webp",
+			expThumb: true,
+		},
+		{
+			name:     "image with too many pixels has no thumbnail",
+			file:     func(t *testing.T) []byte { return pngHeader(t, 50000, 50000) },
+			fileName: "bomb.png",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {
+				ar.On("CreateAttachment", mock.Anything, mock.Anything, mock.MatchedBy(func(a *model.Attachment) bool {
+					return a.MimeType == "image/png" && a.ThumbnailKey == nil
+				})).Return(13, nil)
+			},
+			wantErr:  false,
+			expMime:  "image/png",
+			expThumb: false,
+		},
+		{
+			name:     "valid text upload has no thumbnail",
+			file:     func(t *testing.T) []byte { return []byte("meet me at 221B Baker Street") },
+			fileName: "../../address.txt",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {
+				ar.On("CreateAttachment", mock.Anything, mock.Anything, mock.MatchedBy(func(a *model.Attachment) bool {
+					return a.MimeType == "text/plain" && a.FileName == "address.txt" && a.ThumbnailKey == nil
+				})).Return(11, nil)
+			},
+			wantErr:  false,
+			expMime:  "text/plain",
+			expThumb: false,
+		},
+		{
+			name:      "unsupported type",
+			file:      func(t *testing.T) []byte { return []byte("PK\x03\x04 zipped content") },
+			fileName:  "archive.zip",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrUnsupportedAttachment,
+		},
+		{
+			name:      "empty file",
+			file:      func(t *testing.T) []byte { return []byte{} },
+			fileName:  "empty.txt",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrUnsupportedAttachment,
+		},
+		{
+			name:      "file too large",
+			file:      func(t *testing.T) []byte { return bytes.Repeat([]byte("a"), service.MaxAttachmentSize+1) },
+			fileName:  "large.txt",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrAttachmentTooLarge,
+		},
+		{
+			name:     "repository error",
+			file:     func(t *testing.T) []byte { return []byte("hello") },
+			fileName: "hello.txt",
+			mockSetup: func(ar *mocks.MockAttachmentRepo) {
+				ar.On("CreateAttachment", mock.Anything, mock.Anything, mock.Anything).Return(0, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attachRepo := new(mocks.MockAttachmentRepo)
+			msgRepo := new(mocks.MockMessageRepo)
+
+			store, err := storage.NewFSStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.mockSetup(attachRepo)
+
+			srv := service.NewAttachmentService(discardLogger(), attachRepo, msgRepo, store, nil)
+			resp, err := srv.Upload(context.Background(), &dto.UploadAttachmentDTO{
+				File:     bytes.NewReader(tc.file(t)),
+				FileName: tc.fileName,
+				UserID:   1,
+			})
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, resp)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expMime, resp.Attachment.MimeType)
+				assert.Equal(t, tc.expThumb, resp.Attachment.ThumbnailURL != "")
+			}
+
+			attachRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_OpenAttachment(t *testing.T) {
+	messageID := 5
+	thumbKey := "attachments/a_thumb.png"
+
+	testCases := []struct {
+		name      string
+		userID    int
+		thumbnail bool
+		mockSetup func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expErr    error
+		expBody   string
+	}{
+		{
+			name:   "uploader opens an unsent attachment",
+			userID: 1,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, StorageKey: "attachments/a.png", MimeType: "image/png"}, nil)
+			},
+			wantErr: false,
+			expBody: "original",
+		},
+		{
+			name:   "receiver opens a sent attachment",
+			userID: 2,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, MessageID: &messageID, StorageKey: "attachments/a.png", MimeType: "image/png"}, nil)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 1, ReceiverID: 2}, nil)
+			},
+			wantErr: false,
+			expBody: "original",
+		},
+		{
+			name:      "receiver opens the thumbnail",
+			userID:    2,
+			thumbnail: true,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, MessageID: &messageID, StorageKey: "attachments/a.png", ThumbnailKey: &thumbKey, MimeType: "image/png"}, nil)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 1, ReceiverID: 2}, nil)
+			},
+			wantErr: false,
+			expBody: "thumbnail",
+		},
+		{
+			name:   "receiver opens the attachment of a deleted message",
+			userID: 2,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				deletedAt := time.Now()
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, MessageID: &messageID, StorageKey: "attachments/a.png"}, nil)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 1, ReceiverID: 2, DeletedAt: &deletedAt}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrAttachmentNotExist,
+		},
+		{
+			name:   "uploader opens the attachment of a deleted message",
+			userID: 1,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				deletedAt := time.Now()
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, MessageID: &messageID, StorageKey: "attachments/a.png"}, nil)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 1, ReceiverID: 2, DeletedAt: &deletedAt}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrAttachmentNotExist,
+		},
+		{
+			name:   "someone else opens an unsent attachment",
+			userID: 2,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, StorageKey: "attachments/a.png"}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrAttachmentAccessDenied,
+		},
+		{
+			name:   "non participant opens a sent attachment",
+			userID: 3,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(&model.Attachment{ID: 3, UploaderID: 1, MessageID: &messageID, StorageKey: "attachments/a.png"}, nil)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 1, ReceiverID: 2}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrAttachmentAccessDenied,
+		},
+		{
+			name:   "attachment not found",
+			userID: 1,
+			mockSetup: func(ar *mocks.MockAttachmentRepo, mr *mocks.MockMessageRepo) {
+				ar.On("GetAttachment", mock.Anything, mock.Anything, 3).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrAttachmentNotExist,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			attachRepo := new(mocks.MockAttachmentRepo)
+			msgRepo := new(mocks.MockMessageRepo)
+
+			store, err := storage.NewFSStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = store.Put(context.Background(), "attachments/a.png", bytes.NewReader([]byte("original")))
+			_ = store.Put(context.Background(), thumbKey, bytes.NewReader([]byte("thumbnail")))
+
+			tc.mockSetup(attachRepo, msgRepo)
+
+			srv := service.NewAttachmentService(discardLogger(), attachRepo, msgRepo, store, nil)
+			file, err := srv.Open(context.Background(), tc.userID, 3, tc.thumbnail)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, file)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				body, _ := io.ReadAll(file.Content)
+				file.Content.Close()
+				assert.Equal(t, tc.expBody, string(body))
+			}
+
+			attachRepo.AssertExpectations(t)
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_StoreMessageWithAttachment(t *testing.T) {
+	// Sending an attachment runs inside a transaction, only the reply validation happens before it
+	msgRepo := new(mocks.MockMessageRepo)
+	msgRepo.On("GetMessage", mock.Anything, mock.Anything, 9).Return(nil, repository.ErrNoRowsFound)
+
+	srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+	m, err := srv.StoreMessage(context.Background(), &dto.StoreMessageDTO{
+		From:         1,
+		To:           2,
+		ReplyTo:      9,
+		AttachmentID: 3,
+		Timestamp:    time.Now(),
+	})
+
+	assert.ErrorIs(t, err, service.ErrReplyNotExist)
+	assert.Nil(t, m)
+	msgRepo.AssertExpectations(t)
+}
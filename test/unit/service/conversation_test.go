@@ -0,0 +1,544 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/jlry-dev/whirl/internal/service"
+	"github.com/jlry-dev/whirl/test/mocks"
+)
+
+func member(userID int, role model.ConversationRole) *model.ConversationMember {
+	return &model.ConversationMember{ConversationID: 1, UserID: userID, Role: role}
+}
+
+func Test_CreateConversation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inp       *dto.CreateConversationDTO
+		mockSetup func(fr *mocks.MockFriendshipRepo)
+		expErr    error
+	}{
+		{
+			name:      "empty name",
+			inp:       &dto.CreateConversationDTO{OwnerID: 1, Name: "   ", Members: []int{2}},
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {},
+			expErr:    service.ErrInvalidConversationName,
+		},
+		{
+			name:      "name too long",
+			inp:       &dto.CreateConversationDTO{OwnerID: 1, Name: strings.Repeat("a", service.MaxConversationNameLen+1)},
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {},
+			expErr:    service.ErrInvalidConversationName,
+		},
+		{
+			name: "too many members",
+			inp: func() *dto.CreateConversationDTO {
+				ids := make([]int, 0, service.MaxConversationMembers)
+				for i := 2; i <= service.MaxConversationMembers+1; i++ {
+					ids = append(ids, i)
+				}
+				return &dto.CreateConversationDTO{OwnerID: 1, Name: "Book club", Members: ids}
+			}(),
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {},
+			expErr:    service.ErrConversationFull,
+		},
+		{
+			name: "member is not a friend",
+			inp:  &dto.CreateConversationDTO{OwnerID: 1, Name: "Book club", Members: []int{2, 3}},
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.MatchedBy(func(f *model.Friendship) bool {
+					return f.UID_1 == 1 && f.UID_2 == 2
+				})).Return(model.FriendshipAccepted, nil)
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.MatchedBy(func(f *model.Friendship) bool {
+					return f.UID_1 == 1 && f.UID_2 == 3
+				})).Return(model.FriendshipStatus(""), repository.ErrNoRowsFound)
+			},
+			expErr: service.ErrNotFriends,
+		},
+		{
+			name: "member is blocked",
+			inp:  &dto.CreateConversationDTO{OwnerID: 1, Name: "Book club", Members: []int{2, 2, 1}},
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipBlocked, nil).Once()
+			},
+			expErr: service.ErrNotFriends,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+			frRepo := new(mocks.MockFriendshipRepo)
+
+			tc.mockSetup(frRepo)
+
+			srv := service.NewConversationService(nil, convRepo, new(mocks.MockMessageRepo), frRepo, nil)
+			rsp, err := srv.CreateConversation(context.Background(), tc.inp)
+
+			assert.ErrorIs(t, err, tc.expErr)
+			assert.Nil(t, rsp)
+
+			frRepo.AssertExpectations(t)
+			convRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_InviteMember(t *testing.T) {
+	inp := &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 4}
+
+	testCases := []struct {
+		name      string
+		mockSetup func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "valid invite",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleAdmin), nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return([]*model.ConversationMember{member(2, model.RoleOwner), member(1, model.RoleAdmin)}, nil)
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipAccepted, nil)
+				cr.On("AddMember", mock.Anything, mock.Anything, mock.MatchedBy(func(m *model.ConversationMember) bool {
+					return m.ConversationID == 1 && m.UserID == 4 && m.Role == model.RoleMember && !m.JoinedAt.IsZero()
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "members cannot invite",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleMember), nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationForbidden,
+		},
+		{
+			name: "inviter is not a member",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotConversationMember,
+		},
+		{
+			name: "already a member",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return([]*model.ConversationMember{member(1, model.RoleOwner), member(4, model.RoleMember)}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrAlreadyConversationMember,
+		},
+		{
+			name: "conversation is full",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				members := make([]*model.ConversationMember, 0, service.MaxConversationMembers)
+				for i := 1; i <= service.MaxConversationMembers; i++ {
+					members = append(members, member(i+10, model.RoleMember))
+				}
+
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return(members, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationFull,
+		},
+		{
+			name: "invitee is not a friend",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return([]*model.ConversationMember{member(1, model.RoleOwner)}, nil)
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipStatus(""), repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotFriends,
+		},
+		{
+			name: "concurrent invite",
+			mockSetup: func(cr *mocks.MockConversationRepo, fr *mocks.MockFriendshipRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return([]*model.ConversationMember{member(1, model.RoleOwner)}, nil)
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipAccepted, nil)
+				cr.On("AddMember", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrDuplicateMember)
+			},
+			wantErr: true,
+			expErr:  service.ErrAlreadyConversationMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+			frRepo := new(mocks.MockFriendshipRepo)
+
+			tc.mockSetup(convRepo, frRepo)
+
+			srv := service.NewConversationService(nil, convRepo, new(mocks.MockMessageRepo), frRepo, nil)
+			m, err := srv.InviteMember(context.Background(), inp)
+
+			if tc.wantErr {
+				assert.ErrorIs(t, err, tc.expErr)
+				assert.Nil(t, m)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 4, m.UserID)
+			}
+
+			convRepo.AssertExpectations(t)
+			frRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_KickMember(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inp       *dto.ConversationMemberDTO
+		mockSetup func(cr *mocks.MockConversationRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "owner kicks an admin",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 2},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleAdmin), nil)
+				cr.On("RemoveMember", mock.Anything, mock.Anything, 1, 2).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "admin kicks a member",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 2, UserID: 3},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleAdmin), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(member(3, model.RoleMember), nil)
+				cr.On("RemoveMember", mock.Anything, mock.Anything, 1, 3).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "admin cannot kick another admin",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 2, UserID: 3},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleAdmin), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(member(3, model.RoleAdmin), nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationForbidden,
+		},
+		{
+			name: "member cannot kick",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 3, UserID: 4},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(member(3, model.RoleMember), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 4).Return(member(4, model.RoleMember), nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationForbidden,
+		},
+		{
+			name:      "kick self",
+			inp:       &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 1},
+			mockSetup: func(cr *mocks.MockConversationRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrKickSelf,
+		},
+		{
+			name: "target is not a member",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 9},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 9).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotConversationMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+
+			tc.mockSetup(convRepo)
+
+			srv := service.NewConversationService(nil, convRepo, new(mocks.MockMessageRepo), new(mocks.MockFriendshipRepo), nil)
+			err := srv.KickMember(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.ErrorIs(t, err, tc.expErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			convRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ChangeMemberRole(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inp       *dto.ConversationMemberDTO
+		mockSetup func(cr *mocks.MockConversationRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "owner promotes a member",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 2, Role: "admin"},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleMember), nil)
+				cr.On("UpdateMemberRole", mock.Anything, mock.Anything, mock.MatchedBy(func(m *model.ConversationMember) bool {
+					return m.UserID == 2 && m.Role == model.RoleAdmin
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "cannot hand out ownership",
+			inp:       &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 2, Role: "owner"},
+			mockSetup: func(cr *mocks.MockConversationRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidConversationRole,
+		},
+		{
+			name: "admin cannot change roles",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 2, UserID: 3, Role: "admin"},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleAdmin), nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationForbidden,
+		},
+		{
+			name: "owner cannot demote itself",
+			inp:  &dto.ConversationMemberDTO{ConversationID: 1, ActorID: 1, UserID: 1, Role: "member"},
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 1).Return(member(1, model.RoleOwner), nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrConversationForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+
+			tc.mockSetup(convRepo)
+
+			srv := service.NewConversationService(nil, convRepo, new(mocks.MockMessageRepo), new(mocks.MockFriendshipRepo), nil)
+			m, err := srv.ChangeMemberRole(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.ErrorIs(t, err, tc.expErr)
+				assert.Nil(t, m)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, model.ConversationRole(tc.inp.Role), m.Role)
+			}
+
+			convRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_LeaveConversation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mockSetup func(cr *mocks.MockConversationRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "member leaves",
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(member(3, model.RoleMember), nil)
+				cr.On("RemoveMember", mock.Anything, mock.Anything, 1, 3).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "not a member",
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotConversationMember,
+		},
+		{
+			name: "repository error",
+			mockSetup: func(cr *mocks.MockConversationRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 3).Return(member(3, model.RoleAdmin), nil)
+				cr.On("RemoveMember", mock.Anything, mock.Anything, 1, 3).Return(errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+
+			tc.mockSetup(convRepo)
+
+			srv := service.NewConversationService(nil, convRepo, new(mocks.MockMessageRepo), new(mocks.MockFriendshipRepo), nil)
+			err := srv.LeaveConversation(context.Background(), 1, 3)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+
+			convRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_SendGroupMessage(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name          string
+		inp           *dto.GroupMessageDTO
+		mockSetup     func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo)
+		wantErr       bool
+		expErr        error
+		expRecipients []int
+	}{
+		{
+			name: "valid group message",
+			inp:  &dto.GroupMessageDTO{From: 2, ConversationID: 1, Content: "Hello everyone", Timestamp: now},
+			mockSetup: func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(member(2, model.RoleMember), nil)
+				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.MatchedBy(func(m *model.Message) bool {
+					return m.SenderID == 2 && m.ReceiverID == 0 && m.ConversationID != nil && *m.ConversationID == 1
+				})).Return(30, nil)
+				cr.On("GetMembers", mock.Anything, mock.Anything, 1).Return([]*model.ConversationMember{
+					member(1, model.RoleOwner), member(2, model.RoleMember), member(3, model.RoleMember),
+				}, nil)
+			},
+			wantErr:       false,
+			expRecipients: []int{1, 3},
+		},
+		{
+			name:      "empty message",
+			inp:       &dto.GroupMessageDTO{From: 2, ConversationID: 1, Content: "  ", Timestamp: now},
+			mockSetup: func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrEmptyMessage,
+		},
+		{
+			name: "sender is not a member",
+			inp:  &dto.GroupMessageDTO{From: 5, ConversationID: 1, Content: "Hello", Timestamp: now},
+			mockSetup: func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 5).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotConversationMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(convRepo, msgRepo)
+
+			srv := service.NewConversationService(nil, convRepo, msgRepo, new(mocks.MockFriendshipRepo), nil)
+			m, recipients, err := srv.SendMessage(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.ErrorIs(t, err, tc.expErr)
+				assert.Nil(t, m)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 30, m.ID)
+				assert.Equal(t, tc.expRecipients, recipients)
+			}
+
+			convRepo.AssertExpectations(t)
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RetrieveConversationMessages(t *testing.T) {
+	joinedAt := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name      string
+		page      int
+		mockSetup func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expErr    error
+		expCount  int
+	}{
+		{
+			name: "history starts at the join time",
+			page: 0,
+			mockSetup: func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo) {
+				m := member(2, model.RoleMember)
+				m.JoinedAt = joinedAt
+
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(m, nil)
+				mr.On("GetConversationMessages", mock.Anything, mock.Anything, 1, joinedAt, 1).Return([]*model.Message{
+					{ID: 31, SenderID: 1, Content: "Welcome", Timestamp: joinedAt.Add(time.Minute)},
+				}, nil)
+			},
+			wantErr:  false,
+			expCount: 1,
+		},
+		{
+			name: "not a member",
+			page: 1,
+			mockSetup: func(cr *mocks.MockConversationRepo, mr *mocks.MockMessageRepo) {
+				cr.On("GetMember", mock.Anything, mock.Anything, 1, 2).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotConversationMember,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			convRepo := new(mocks.MockConversationRepo)
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(convRepo, msgRepo)
+
+			srv := service.NewConversationService(nil, convRepo, msgRepo, new(mocks.MockFriendshipRepo), nil)
+			rsp, err := srv.RetrieveMessages(context.Background(), 1, 2, tc.page)
+
+			if tc.wantErr {
+				assert.ErrorIs(t, err, tc.expErr)
+				assert.Nil(t, rsp)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, rsp.Messages, tc.expCount)
+			}
+
+			convRepo.AssertExpectations(t)
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -309,3 +309,120 @@ func Test_CheckStatus(t *testing.T) {
 		})
 	}
 }
+
+func Test_AreFriends(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mockSetup  func(fr *mocks.MockFriendshipRepo)
+		wantErr    bool
+		expFriends bool
+	}{
+		{
+			name: "accepted friendship",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.MatchedBy(func(f *model.Friendship) bool {
+					return f.UID_1 == 1 && f.UID_2 == 2
+				})).Return(model.FriendshipAccepted, nil)
+			},
+			expFriends: true,
+		},
+		{
+			name: "blocked friendship",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipBlocked, nil)
+			},
+			expFriends: false,
+		},
+		{
+			name: "no friendship",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipStatus(""), repository.ErrNoRowsFound)
+			},
+			expFriends: false,
+		},
+		{
+			name: "repository error",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetFriendshipStatus", mock.Anything, mock.Anything, mock.Anything).Return(model.FriendshipStatus(""), errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vld := validator.New(validator.WithRequiredStructEnabled())
+			frRepo := new(mocks.MockFriendshipRepo)
+			userRepo := new(mocks.MockUserRepo)
+
+			tc.mockSetup(frRepo)
+
+			var userRepoInterface repository.UserRepository = userRepo
+			srv := service.NewFriendshipService(*vld, nil, frRepo, &userRepoInterface, nil)
+			friends, err := srv.AreFriends(context.Background(), &dto.FriendshipDTO{From: 1, To: 2})
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expFriends, friends)
+			}
+
+			frRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RelatedUsers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mockSetup  func(fr *mocks.MockFriendshipRepo)
+		wantErr    bool
+		expRelated map[int]bool
+	}{
+		{
+			name: "friends and blocked users",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetRelatedUserIDs", mock.Anything, mock.Anything, 1).Return([]int{2, 5}, nil)
+			},
+			expRelated: map[int]bool{2: true, 5: true},
+		},
+		{
+			name: "no relationships",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetRelatedUserIDs", mock.Anything, mock.Anything, 1).Return([]int{}, nil)
+			},
+			expRelated: map[int]bool{},
+		},
+		{
+			name: "repository error",
+			mockSetup: func(fr *mocks.MockFriendshipRepo) {
+				fr.On("GetRelatedUserIDs", mock.Anything, mock.Anything, 1).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			vld := validator.New(validator.WithRequiredStructEnabled())
+			frRepo := new(mocks.MockFriendshipRepo)
+			userRepo := new(mocks.MockUserRepo)
+
+			tc.mockSetup(frRepo)
+
+			var userRepoInterface repository.UserRepository = userRepo
+			srv := service.NewFriendshipService(*vld, nil, frRepo, &userRepoInterface, nil)
+			related, err := srv.RelatedUsers(context.Background(), 1)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expRelated, related)
+			}
+
+			frRepo.AssertExpectations(t)
+		})
+	}
+}
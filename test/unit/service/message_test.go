@@ -2,7 +2,9 @@ package service_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
 	"github.com/jlry-dev/whirl/internal/service"
 	"github.com/jlry-dev/whirl/test/mocks"
 )
@@ -20,9 +24,11 @@ func Test_StoreMessage(t *testing.T) {
 		senderID   int
 		receiverID int
 		content    string
+		replyTo    int
 		timestamp  time.Time
 		mockSetup  func(mr *mocks.MockMessageRepo)
 		wantErr    bool
+		expErr     error
 	}{
 		{
 			name:       "valid message storage",
@@ -33,7 +39,7 @@ func Test_StoreMessage(t *testing.T) {
 			mockSetup: func(mr *mocks.MockMessageRepo) {
 				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.MatchedBy(func(m *model.Message) bool {
 					return m.SenderID == 1 && m.ReceiverID == 2 && m.Content == "Hello, how are you?"
-				})).Return(nil)
+				})).Return(1, nil)
 			},
 			wantErr: false,
 		},
@@ -44,7 +50,7 @@ func Test_StoreMessage(t *testing.T) {
 			content:    "",
 			timestamp:  time.Now(),
 			mockSetup: func(mr *mocks.MockMessageRepo) {
-				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.Anything).Return(2, nil)
 			},
 			wantErr: false,
 		},
@@ -55,9 +61,50 @@ func Test_StoreMessage(t *testing.T) {
 			content:    "Test message",
 			timestamp:  time.Now(),
 			mockSetup: func(mr *mocks.MockMessageRepo) {
-				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("database error"))
+				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.Anything).Return(0, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+		{
+			name:       "valid reply",
+			senderID:   1,
+			receiverID: 2,
+			content:    "Sure",
+			replyTo:    5,
+			timestamp:  time.Now(),
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 2, ReceiverID: 1}, nil)
+				mr.On("CreateMessage", mock.Anything, mock.Anything, mock.MatchedBy(func(m *model.Message) bool {
+					return m.ReplyTo != nil && *m.ReplyTo == 5
+				})).Return(6, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:       "reply to a message that does not exist",
+			senderID:   1,
+			receiverID: 2,
+			content:    "Sure",
+			replyTo:    5,
+			timestamp:  time.Now(),
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrReplyNotExist,
+		},
+		{
+			name:       "reply to a message from another conversation",
+			senderID:   1,
+			receiverID: 2,
+			content:    "Sure",
+			replyTo:    5,
+			timestamp:  time.Now(),
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 5).Return(&model.Message{ID: 5, SenderID: 3, ReceiverID: 1}, nil)
 			},
 			wantErr: true,
+			expErr:  service.ErrReplyNotInChat,
 		},
 	}
 
@@ -67,13 +114,24 @@ func Test_StoreMessage(t *testing.T) {
 
 			tc.mockSetup(msgRepo)
 
-			srv := service.NewMessageService(nil, msgRepo, nil)
-			err := srv.StoreMessage(context.Background(), tc.senderID, tc.receiverID, tc.content, tc.timestamp)
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			m, err := srv.StoreMessage(context.Background(), &dto.StoreMessageDTO{
+				From:      tc.senderID,
+				To:        tc.receiverID,
+				Content:   tc.content,
+				ReplyTo:   tc.replyTo,
+				Timestamp: tc.timestamp,
+			})
 
 			if tc.wantErr {
 				assert.Error(t, err)
+				assert.Nil(t, m)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
 			} else {
 				assert.NoError(t, err)
+				assert.NotZero(t, m.ID)
 			}
 
 			msgRepo.AssertExpectations(t)
@@ -105,6 +163,7 @@ func Test_RetrieveMessages(t *testing.T) {
 					{SenderID: 1, ReceiverID: 2, Content: "How are you?", Timestamp: now.Add(2 * time.Minute)},
 				}
 				mr.On("GetMessages", mock.Anything, mock.Anything, 1, 2, 1).Return(messages, nil)
+				mr.On("GetReactionCounts", mock.Anything, mock.Anything, mock.Anything, 1).Return(map[int][]*model.ReactionCount{}, nil)
 			},
 			wantErr:  false,
 			expCount: 3,
@@ -131,6 +190,26 @@ func Test_RetrieveMessages(t *testing.T) {
 					{SenderID: 2, ReceiverID: 1, Content: "Message 2", Timestamp: now.Add(time.Minute)},
 				}
 				mr.On("GetMessages", mock.Anything, mock.Anything, 1, 2, 2).Return(messages, nil)
+				mr.On("GetReactionCounts", mock.Anything, mock.Anything, mock.Anything, 1).Return(map[int][]*model.ReactionCount{}, nil)
+			},
+			wantErr:  false,
+			expCount: 2,
+		},
+		{
+			name:           "messages with reactions",
+			participantOne: 1,
+			participantTwo: 2,
+			page:           1,
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				messages := []*model.Message{
+					{ID: 7, SenderID: 1, ReceiverID: 2, Content: "Hello", Timestamp: now},
+					{ID: 8, SenderID: 2, ReceiverID: 1, Content: "Hi there", Timestamp: now.Add(time.Minute)},
+				}
+				counts := map[int][]*model.ReactionCount{
+					7: {{Emoji: "👍", Count: 2, Reacted: true}},
+				}
+				mr.On("GetMessages", mock.Anything, mock.Anything, 1, 2, 1).Return(messages, nil)
+				mr.On("GetReactionCounts", mock.Anything, mock.Anything, []int{7, 8}, 1).Return(counts, nil)
 			},
 			wantErr:  false,
 			expCount: 2,
@@ -145,6 +224,20 @@ func Test_RetrieveMessages(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:           "reaction repository error",
+			participantOne: 1,
+			participantTwo: 2,
+			page:           1,
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				messages := []*model.Message{
+					{ID: 7, SenderID: 1, ReceiverID: 2, Content: "Hello", Timestamp: now},
+				}
+				mr.On("GetMessages", mock.Anything, mock.Anything, 1, 2, 1).Return(messages, nil)
+				mr.On("GetReactionCounts", mock.Anything, mock.Anything, []int{7}, 1).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -153,7 +246,7 @@ func Test_RetrieveMessages(t *testing.T) {
 
 			tc.mockSetup(msgRepo)
 
-			srv := service.NewMessageService(nil, msgRepo, nil)
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
 			resp, err := srv.RetreiveMessages(context.Background(), tc.participantOne, tc.participantTwo, tc.page)
 
 			if tc.wantErr {
@@ -169,3 +262,587 @@ func Test_RetrieveMessages(t *testing.T) {
 		})
 	}
 }
+
+func Test_RetrieveMessagesAttachments(t *testing.T) {
+	now := time.Now()
+	thumbnail := "thumb/9.jpg"
+
+	messages := []*model.Message{
+		{ID: 7, SenderID: 1, ReceiverID: 2, Timestamp: now, Attachment: &model.Attachment{
+			ID: 9, UploaderID: 1, StorageKey: "files/9.jpg", ThumbnailKey: &thumbnail, FileName: "photo.jpg", MimeType: "image/jpeg", Size: 512,
+		}},
+		{ID: 8, SenderID: 2, ReceiverID: 1, Timestamp: now, DeletedAt: &now, Attachment: &model.Attachment{
+			ID: 10, UploaderID: 2, StorageKey: "files/10.pdf", FileName: "notes.pdf", MimeType: "application/pdf", Size: 1024,
+		}},
+	}
+
+	msgRepo := new(mocks.MockMessageRepo)
+	msgRepo.On("GetMessages", mock.Anything, mock.Anything, 1, 2, 1).Return(messages, nil)
+	msgRepo.On("GetReactionCounts", mock.Anything, mock.Anything, []int{7, 8}, 1).Return(map[int][]*model.ReactionCount{}, nil)
+
+	srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+	resp, err := srv.RetreiveMessages(context.Background(), 1, 2, 1)
+
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Messages, 2) {
+		assert.Equal(t, &dto.AttachmentDTO{
+			ID:           9,
+			FileName:     "photo.jpg",
+			MimeType:     "image/jpeg",
+			Size:         512,
+			URL:          "/attachment/9",
+			ThumbnailURL: "/attachment/9/thumbnail",
+		}, resp.Messages[0].Attachment)
+		assert.Nil(t, resp.Messages[1].Attachment, "a message deleted for everyone has no attachment")
+	}
+
+	body, err := json.Marshal(resp)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "files/", "storage keys are never sent")
+	assert.NotContains(t, string(body), "UploaderID")
+
+	msgRepo.AssertExpectations(t)
+}
+
+func Test_SyncMessages(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		receiver  int
+		afterID   int
+		limit     int
+		mockSetup func(mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expCount  int
+	}{
+		{
+			name:     "valid sync",
+			receiver: 2,
+			afterID:  10,
+			limit:    100,
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				messages := []*model.Message{
+					{ID: 11, SenderID: 1, ReceiverID: 2, Content: "Hello", Timestamp: now},
+					{ID: 14, SenderID: 3, ReceiverID: 2, Content: "Hey", Timestamp: now.Add(time.Minute)},
+				}
+				mr.On("GetMessagesAfter", mock.Anything, mock.Anything, 2, 10, 100).Return(messages, nil)
+			},
+			wantErr:  false,
+			expCount: 2,
+		},
+		{
+			name:     "negative last seen id syncs from the start",
+			receiver: 2,
+			afterID:  -5,
+			limit:    100,
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessagesAfter", mock.Anything, mock.Anything, 2, 0, 100).Return([]*model.Message{}, nil)
+			},
+			wantErr:  false,
+			expCount: 0,
+		},
+		{
+			name:     "repository error",
+			receiver: 2,
+			afterID:  10,
+			limit:    100,
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessagesAfter", mock.Anything, mock.Anything, 2, 10, 100).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			messages, err := srv.SyncMessages(context.Background(), tc.receiver, tc.afterID, tc.limit)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, messages)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, messages, tc.expCount)
+			}
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_HasConversation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mockSetup func(mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expExists bool
+	}{
+		{
+			name: "users that exchanged messages",
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("HasMessages", mock.Anything, mock.Anything, 1, 2).Return(true, nil)
+			},
+			expExists: true,
+		},
+		{
+			name: "strangers",
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("HasMessages", mock.Anything, mock.Anything, 1, 2).Return(false, nil)
+			},
+			expExists: false,
+		},
+		{
+			name: "repository error",
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("HasMessages", mock.Anything, mock.Anything, 1, 2).Return(false, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			exists, err := srv.HasConversation(context.Background(), 1, 2)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expExists, exists)
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_SearchMessages(t *testing.T) {
+	now := time.Now()
+
+	fullPage := func() []*model.MessageSearchResult {
+		results := make([]*model.MessageSearchResult, 0, service.SearchPageSize+1)
+		for i := 0; i <= service.SearchPageSize; i++ {
+			results = append(results, &model.MessageSearchResult{ID: 100 - i, SenderID: 1, ReceiverID: 2, Timestamp: now, Snippet: "link"})
+		}
+		return results
+	}
+
+	testCases := []struct {
+		name       string
+		inp        *dto.SearchMessagesDTO
+		mockSetup  func(mr *mocks.MockMessageRepo)
+		expErr     error
+		wantErr    bool
+		expCount   int
+		expCursor  int
+		expSnippet string
+	}{
+		{
+			name: "valid search",
+			inp:  &dto.SearchMessagesDTO{UserID: 1, Query: "  baker street  "},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				results := []*model.MessageSearchResult{
+					{ID: 7, SenderID: 2, ReceiverID: 1, Timestamp: now, Snippet: "meet me at 221B \x02Baker\x03 \x02Street\x03"},
+				}
+				mr.On("SearchMessages", mock.Anything, mock.Anything, 1, 0, "baker street", 0, service.SearchPageSize+1).Return(results, nil)
+			},
+			expCount:   1,
+			expSnippet: "meet me at 221B <mark>Baker</mark> <mark>Street</mark>",
+		},
+		{
+			name: "snippet content is escaped",
+			inp:  &dto.SearchMessagesDTO{UserID: 1, Query: "script", With: 2},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				results := []*model.MessageSearchResult{
+					{ID: 7, SenderID: 2, ReceiverID: 1, Timestamp: now, Snippet: "<\x02script\x03>alert(1)</\x02script\x03>"},
+				}
+				mr.On("SearchMessages", mock.Anything, mock.Anything, 1, 2, "script", 0, service.SearchPageSize+1).Return(results, nil)
+			},
+			expCount:   1,
+			expSnippet: "&lt;<mark>script</mark>&gt;alert(1)&lt;/<mark>script</mark>&gt;",
+		},
+		{
+			name: "full page has a next cursor",
+			inp:  &dto.SearchMessagesDTO{UserID: 1, Query: "link", Cursor: 120},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("SearchMessages", mock.Anything, mock.Anything, 1, 0, "link", 120, service.SearchPageSize+1).Return(fullPage(), nil)
+			},
+			expCount:  service.SearchPageSize,
+			expCursor: 100 - service.SearchPageSize + 1,
+		},
+		{
+			name: "negative cursor starts from the newest",
+			inp:  &dto.SearchMessagesDTO{UserID: 1, Query: "link", Cursor: -3},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("SearchMessages", mock.Anything, mock.Anything, 1, 0, "link", 0, service.SearchPageSize+1).Return([]*model.MessageSearchResult{}, nil)
+			},
+			expCount: 0,
+		},
+		{
+			name:      "empty query",
+			inp:       &dto.SearchMessagesDTO{UserID: 1, Query: "   "},
+			mockSetup: func(mr *mocks.MockMessageRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidSearchQuery,
+		},
+		{
+			name:      "query too long",
+			inp:       &dto.SearchMessagesDTO{UserID: 1, Query: strings.Repeat("a", 201)},
+			mockSetup: func(mr *mocks.MockMessageRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidSearchQuery,
+		},
+		{
+			name: "repository error",
+			inp:  &dto.SearchMessagesDTO{UserID: 1, Query: "link"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("SearchMessages", mock.Anything, mock.Anything, 1, 0, "link", 0, service.SearchPageSize+1).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			rsp, err := srv.SearchMessages(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, rsp)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, rsp.Results, tc.expCount)
+				assert.Equal(t, tc.expCursor, rsp.NextCursor)
+				if tc.expSnippet != "" {
+					assert.Equal(t, tc.expSnippet, rsp.Results[0].Snippet)
+				}
+			}
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_EditMessage(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		inp       *dto.EditMessageDTO
+		mockSetup func(mr *mocks.MockMessageRepo)
+		expErr    error
+	}{
+		{
+			name: "empty content",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 1, Content: "   "},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+			},
+			expErr: service.ErrEmptyMessage,
+		},
+		{
+			name: "message not found",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 1, Content: "edited"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(nil, repository.ErrNoRowsFound)
+			},
+			expErr: service.ErrMessageNotExist,
+		},
+		{
+			name: "group messages are not direct messages",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 1, Content: "edited"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				conversationID := 4
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ConversationID: &conversationID, Timestamp: now}, nil)
+			},
+			expErr: service.ErrMessageNotExist,
+		},
+		{
+			name: "not the sender",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 2, Content: "edited"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+			},
+			expErr: service.ErrNotMessageSender,
+		},
+		{
+			name: "message already deleted",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 1, Content: "edited"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now, DeletedAt: &now}, nil)
+			},
+			expErr: service.ErrMessageDeleted,
+		},
+		{
+			name: "edit window expired",
+			inp:  &dto.EditMessageDTO{MessageID: 1, UserID: 1, Content: "edited"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				sent := now.Add(-service.MessageEditWindow - time.Minute)
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: sent}, nil)
+			},
+			expErr: service.ErrEditWindowExpired,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			m, err := srv.EditMessage(context.Background(), tc.inp)
+
+			assert.ErrorIs(t, err, tc.expErr)
+			assert.Nil(t, m)
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_DeleteMessage(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		inp       *dto.DeleteMessageDTO
+		mockSetup func(mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "delete for me as the receiver",
+			inp:  &dto.DeleteMessageDTO{MessageID: 1, UserID: 2, Scope: service.DeleteForMe},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+				mr.On("HideMessage", mock.Anything, mock.Anything, 1, 2).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid scope",
+			inp:  &dto.DeleteMessageDTO{MessageID: 1, UserID: 1, Scope: "nobody"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+			},
+			wantErr: true,
+			expErr:  service.ErrInvalidDeleteScope,
+		},
+		{
+			name: "not a participant",
+			inp:  &dto.DeleteMessageDTO{MessageID: 1, UserID: 3, Scope: service.DeleteForMe},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotMessageParticipant,
+		},
+		{
+			name: "delete for everyone as the receiver",
+			inp:  &dto.DeleteMessageDTO{MessageID: 1, UserID: 2, Scope: service.DeleteForEveryone},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotMessageSender,
+		},
+		{
+			name: "hide message repository error",
+			inp:  &dto.DeleteMessageDTO{MessageID: 1, UserID: 1, Scope: service.DeleteForMe},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+				mr.On("HideMessage", mock.Anything, mock.Anything, 1, 1).Return(errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			m, err := srv.DeleteMessage(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, m)
+			}
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_React(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		inp       *dto.ReactionDTO
+		mockSetup func(mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "valid reaction",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 2, Emoji: "👍"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+				mr.On("AddReaction", mock.Anything, mock.Anything, mock.MatchedBy(func(rc *model.Reaction) bool {
+					return rc.MessageID == 1 && rc.UserID == 2 && rc.Emoji == "👍"
+				})).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "plain text is not a reaction",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 2, Emoji: "lol"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+			},
+			wantErr: true,
+			expErr:  service.ErrInvalidReaction,
+		},
+		{
+			name: "empty reaction",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 2, Emoji: ""},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+			},
+			wantErr: true,
+			expErr:  service.ErrInvalidReaction,
+		},
+		{
+			name: "not a participant",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 3, Emoji: "👍"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrNotMessageParticipant,
+		},
+		{
+			name: "message deleted",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 2, Emoji: "👍"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now, DeletedAt: &now}, nil)
+			},
+			wantErr: true,
+			expErr:  service.ErrMessageDeleted,
+		},
+		{
+			name: "message not found",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 2, Emoji: "👍"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrMessageNotExist,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			m, err := srv.React(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, m)
+			}
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Unreact(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name      string
+		inp       *dto.ReactionDTO
+		mockSetup func(mr *mocks.MockMessageRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "valid removal",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 1, Emoji: "❤️"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+				mr.On("RemoveReaction", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "reaction not found",
+			inp:  &dto.ReactionDTO{MessageID: 1, UserID: 1, Emoji: "❤️"},
+			mockSetup: func(mr *mocks.MockMessageRepo) {
+				mr.On("GetMessage", mock.Anything, mock.Anything, 1).Return(&model.Message{ID: 1, SenderID: 1, ReceiverID: 2, Timestamp: now}, nil)
+				mr.On("RemoveReaction", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrReactionNotExist,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msgRepo := new(mocks.MockMessageRepo)
+
+			tc.mockSetup(msgRepo)
+
+			srv := service.NewMessageService(nil, msgRepo, new(mocks.MockAttachmentRepo), nil)
+			m, err := srv.Unreact(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, m)
+			}
+
+			msgRepo.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,631 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jlry-dev/whirl/internal/model"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/repository"
+	"github.com/jlry-dev/whirl/internal/service"
+	"github.com/jlry-dev/whirl/test/mocks"
+)
+
+func Test_RandomProfile(t *testing.T) {
+	bdate := time.Now().AddDate(-20, 0, -1)
+
+	testCases := []struct {
+		name      string
+		inp       *dto.JoinRandomDTO
+		mockSetup func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo)
+		expErr    error
+		wantErr   bool
+		exp       *dto.RandomProfileDTO
+	}{
+		{
+			name: "normalizes preferences and uses the stored profile",
+			inp: &dto.JoinRandomDTO{
+				UserID: 1,
+				Preferences: dto.RandomPreferencesDTO{
+					Countries: []string{"phl", "PHL", " usa"},
+					Languages: []string{"EN", "tl", "en"},
+					MinAge:    18,
+					MaxAge:    30,
+				},
+			},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {
+				cr.On("GetIDByISO", mock.Anything, mock.Anything, "PHL").Return(1, nil)
+				cr.On("GetIDByISO", mock.Anything, mock.Anything, "USA").Return(2, nil)
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(&dto.UserWithCountryDTO{ID: 1, Bdate: bdate, CountryCode: "JPN"}, nil)
+				rr.On("GetRatingCounts", mock.Anything, mock.Anything, 1).Return(3, 1, nil)
+			},
+			exp: &dto.RandomProfileDTO{
+				UserID:     1,
+				Age:        20,
+				Country:    "JPN",
+				Reputation: 4.0 / 6.0,
+				Preferences: dto.RandomPreferencesDTO{
+					Countries: []string{"PHL", "USA"},
+					Languages: []string{"en", "tl"},
+					MinAge:    18,
+					MaxAge:    30,
+				},
+			},
+		},
+		{
+			name: "unknown country",
+			inp:  &dto.JoinRandomDTO{UserID: 1, Preferences: dto.RandomPreferencesDTO{Countries: []string{"XXX"}}},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {
+				cr.On("GetIDByISO", mock.Anything, mock.Anything, "XXX").Return(0, repository.ErrCountryNotExist)
+			},
+			wantErr: true,
+			expErr:  service.ErrInvalidRandomPreferences,
+		},
+		{
+			name:      "invalid language code",
+			inp:       &dto.JoinRandomDTO{UserID: 1, Preferences: dto.RandomPreferencesDTO{Languages: []string{"english"}}},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidRandomPreferences,
+		},
+		{
+			name:      "age band below the minimum age",
+			inp:       &dto.JoinRandomDTO{UserID: 1, Preferences: dto.RandomPreferencesDTO{MinAge: 5}},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidRandomPreferences,
+		},
+		{
+			name:      "inverted age band",
+			inp:       &dto.JoinRandomDTO{UserID: 1, Preferences: dto.RandomPreferencesDTO{MinAge: 30, MaxAge: 20}},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidRandomPreferences,
+		},
+		{
+			name: "user not found",
+			inp:  &dto.JoinRandomDTO{UserID: 1},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrUserNotExist,
+		},
+		{
+			name: "rating count error",
+			inp:  &dto.JoinRandomDTO{UserID: 1},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(&dto.UserWithCountryDTO{ID: 1, Bdate: bdate, CountryCode: "JPN"}, nil)
+				rr.On("GetRatingCounts", mock.Anything, mock.Anything, 1).Return(0, 0, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "repository error",
+			inp:  &dto.JoinRandomDTO{UserID: 1},
+			mockSetup: func(ur *mocks.MockUserRepo, cr *mocks.MockCountryRepo, rr *mocks.MockRandomRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			userRepo := new(mocks.MockUserRepo)
+			countryRepo := new(mocks.MockCountryRepo)
+			randomRepo := new(mocks.MockRandomRepo)
+			tc.mockSetup(userRepo, countryRepo, randomRepo)
+
+			srv := service.NewRandomService(discardLogger(), userRepo, countryRepo, randomRepo, nil)
+			profile, err := srv.Profile(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, profile)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.exp, profile)
+			}
+
+			userRepo.AssertExpectations(t)
+			countryRepo.AssertExpectations(t)
+			randomRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Age(t *testing.T) {
+	bdate := time.Date(2000, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 17, service.Age(bdate, time.Date(2018, time.June, 14, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 18, service.Age(bdate, time.Date(2018, time.June, 15, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 18, service.Age(bdate, time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func Test_RandomCompatible(t *testing.T) {
+	profile := func(age int, country string, prefs dto.RandomPreferencesDTO) *dto.RandomProfileDTO {
+		return &dto.RandomProfileDTO{Age: age, Country: country, Preferences: prefs}
+	}
+
+	testCases := []struct {
+		name string
+		a, b *dto.RandomProfileDTO
+		exp  bool
+	}{
+		{
+			name: "no preferences",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{}),
+			b:    profile(40, "USA", dto.RandomPreferencesDTO{}),
+			exp:  true,
+		},
+		{
+			name: "adult and minor are never matched",
+			a:    profile(18, "PHL", dto.RandomPreferencesDTO{}),
+			b:    profile(17, "PHL", dto.RandomPreferencesDTO{}),
+			exp:  false,
+		},
+		{
+			name: "age band of the minor does not reach adults",
+			a:    profile(16, "PHL", dto.RandomPreferencesDTO{MinAge: 13, MaxAge: 60}),
+			b:    profile(25, "PHL", dto.RandomPreferencesDTO{MinAge: 13, MaxAge: 60}),
+			exp:  false,
+		},
+		{
+			name: "partner outside the age band",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{MaxAge: 25}),
+			b:    profile(30, "PHL", dto.RandomPreferencesDTO{}),
+			exp:  false,
+		},
+		{
+			name: "country preference applies both ways",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{}),
+			b:    profile(20, "USA", dto.RandomPreferencesDTO{Countries: []string{"USA"}}),
+			exp:  false,
+		},
+		{
+			name: "matching country",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{Countries: []string{"USA"}}),
+			b:    profile(20, "USA", dto.RandomPreferencesDTO{Countries: []string{"PHL"}}),
+			exp:  true,
+		},
+		{
+			name: "no common language",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{Languages: []string{"tl"}}),
+			b:    profile(20, "USA", dto.RandomPreferencesDTO{Languages: []string{"en"}}),
+			exp:  false,
+		},
+		{
+			name: "common language",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{Languages: []string{"tl", "en"}}),
+			b:    profile(20, "USA", dto.RandomPreferencesDTO{Languages: []string{"en"}}),
+			exp:  true,
+		},
+		{
+			name: "languages of one side only",
+			a:    profile(20, "PHL", dto.RandomPreferencesDTO{Languages: []string{"tl"}}),
+			b:    profile(20, "USA", dto.RandomPreferencesDTO{}),
+			exp:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, service.RandomCompatible(tc.a, tc.b))
+			assert.Equal(t, tc.exp, service.RandomCompatible(tc.b, tc.a))
+		})
+	}
+}
+
+func Test_SaveRandomSession(t *testing.T) {
+	reason := model.EndSkip
+	endedAt := time.Now()
+	sess := &model.RandomSession{ID: "s1", UserA: 1, UserB: 2, Interests: []string{"go"}, StartedAt: endedAt.Add(-time.Minute), EndedAt: &endedAt, EndReason: &reason}
+
+	randomRepo := new(mocks.MockRandomRepo)
+	randomRepo.On("SaveSession", mock.Anything, mock.Anything, sess).Return(nil).Once()
+	randomRepo.On("SaveSession", mock.Anything, mock.Anything, sess).Return(errors.New("database error")).Once()
+
+	srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+
+	assert.NoError(t, srv.SaveSession(context.Background(), sess))
+	assert.Error(t, srv.SaveSession(context.Background(), sess))
+
+	randomRepo.AssertExpectations(t)
+}
+
+func Test_UserRandomSessions(t *testing.T) {
+	sessions := []*model.RandomSession{{ID: "s1", UserA: 1, UserB: 2, StartedAt: time.Now()}}
+
+	testCases := []struct {
+		name      string
+		page      int
+		mockSetup func(rr *mocks.MockRandomRepo)
+		wantErr   bool
+		exp       []*model.RandomSession
+	}{
+		{
+			name: "first page",
+			page: 1,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSessionsByUser", mock.Anything, mock.Anything, 1, service.SessionPageSize, 0).Return(sessions, nil)
+			},
+			exp: sessions,
+		},
+		{
+			name: "later page",
+			page: 3,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSessionsByUser", mock.Anything, mock.Anything, 1, service.SessionPageSize, 2*service.SessionPageSize).Return([]*model.RandomSession{}, nil)
+			},
+			exp: []*model.RandomSession{},
+		},
+		{
+			name: "invalid page defaults to the first",
+			page: 0,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSessionsByUser", mock.Anything, mock.Anything, 1, service.SessionPageSize, 0).Return(sessions, nil)
+			},
+			exp: sessions,
+		},
+		{
+			name: "repository error",
+			page: 1,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSessionsByUser", mock.Anything, mock.Anything, 1, service.SessionPageSize, 0).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			randomRepo := new(mocks.MockRandomRepo)
+			tc.mockSetup(randomRepo)
+
+			srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+			got, err := srv.UserSessions(context.Background(), 1, tc.page)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.exp, got)
+			}
+
+			randomRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RandomSession(t *testing.T) {
+	id := "0b5c4c1e-6f7a-4d8e-9a3b-2c1d0e9f8a7b"
+	session := &model.RandomSession{ID: id, UserA: 1, UserB: 2, StartedAt: time.Now()}
+
+	testCases := []struct {
+		name      string
+		sessionID string
+		mockSetup func(rr *mocks.MockRandomRepo)
+		wantErr   bool
+		expErr    error
+		exp       *model.RandomSession
+	}{
+		{
+			name:      "saved session",
+			sessionID: id,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSession", mock.Anything, mock.Anything, id).Return(session, nil)
+			},
+			exp: session,
+		},
+		{
+			name:      "unknown session",
+			sessionID: id,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSession", mock.Anything, mock.Anything, id).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrRandomSessionNotExist,
+		},
+		{
+			name:      "malformed id is never looked up",
+			sessionID: "not-a-session",
+			mockSetup: func(rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrRandomSessionNotExist,
+		},
+		{
+			name:      "repository error",
+			sessionID: id,
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("GetSession", mock.Anything, mock.Anything, id).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			randomRepo := new(mocks.MockRandomRepo)
+			tc.mockSetup(randomRepo)
+
+			srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+			got, err := srv.Session(context.Background(), tc.sessionID)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.exp, got)
+			}
+
+			randomRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RecentRandomSessions(t *testing.T) {
+	since := time.Now().Add(-time.Minute)
+	sessions := []*model.RandomSession{{ID: "s1", UserA: 1, UserB: 2, StartedAt: time.Now()}}
+
+	randomRepo := new(mocks.MockRandomRepo)
+	randomRepo.On("GetSessionsSince", mock.Anything, mock.Anything, since).Return(sessions, nil).Once()
+	randomRepo.On("GetSessionsSince", mock.Anything, mock.Anything, since).Return(nil, errors.New("database error")).Once()
+
+	srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+
+	got, err := srv.RecentSessions(context.Background(), since)
+	assert.NoError(t, err)
+	assert.Equal(t, sessions, got)
+
+	got, err = srv.RecentSessions(context.Background(), since)
+	assert.Error(t, err)
+	assert.Nil(t, got)
+
+	randomRepo.AssertExpectations(t)
+}
+
+func Test_PublicProfile(t *testing.T) {
+	avatar := "https://example.com/avatar.png"
+
+	testCases := []struct {
+		name      string
+		mockSetup func(ur *mocks.MockUserRepo)
+		exp       *dto.PublicProfileDTO
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "leaves out private fields",
+			mockSetup: func(ur *mocks.MockUserRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(&dto.UserWithCountryDTO{
+					ID:          1,
+					Username:    "whirler",
+					Email:       "whirler@example.com",
+					Bdate:       time.Now().AddDate(-20, 0, 0),
+					AvatarURL:   &avatar,
+					CountryCode: "PHL",
+					CountryName: "Philippines",
+				}, nil)
+			},
+			exp: &dto.PublicProfileDTO{
+				ID:          1,
+				Username:    "whirler",
+				AvatarURL:   &avatar,
+				CountryCode: "PHL",
+				CountryName: "Philippines",
+			},
+		},
+		{
+			name: "user not found",
+			mockSetup: func(ur *mocks.MockUserRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(nil, repository.ErrNoRowsFound)
+			},
+			wantErr: true,
+			expErr:  service.ErrUserNotExist,
+		},
+		{
+			name: "repository error",
+			mockSetup: func(ur *mocks.MockUserRepo) {
+				ur.On("GetUserWithCountryByID", mock.Anything, mock.Anything, 1).Return(nil, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			userRepo := new(mocks.MockUserRepo)
+			tc.mockSetup(userRepo)
+
+			srv := service.NewRandomService(discardLogger(), userRepo, new(mocks.MockCountryRepo), new(mocks.MockRandomRepo), nil)
+			profile, err := srv.PublicProfile(context.Background(), 1)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, profile)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.exp, profile)
+			}
+
+			userRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_ReportRandom(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inp       *dto.RandomReportDTO
+		mockSetup func(rr *mocks.MockRandomRepo)
+		wantErr   bool
+		expErr    error
+		expID     int
+	}{
+		{
+			name: "valid report",
+			inp:  &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "spam", Transcript: "  buy now  "},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateReport", mock.Anything, mock.Anything, mock.MatchedBy(func(rp *model.RandomReport) bool {
+					return rp.ReporterID == 1 && rp.ReportedID == 2 && rp.SessionID == "s1" &&
+						rp.Reason == model.ReportSpam && rp.Transcript != nil && *rp.Transcript == "buy now"
+				})).Return(7, nil)
+			},
+			expID: 7,
+		},
+		{
+			name: "without transcript",
+			inp:  &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "other"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateReport", mock.Anything, mock.Anything, mock.MatchedBy(func(rp *model.RandomReport) bool {
+					return rp.Transcript == nil
+				})).Return(8, nil)
+			},
+			expID: 8,
+		},
+		{
+			name:      "invalid reason",
+			inp:       &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "rude"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidReportReason,
+		},
+		{
+			name:      "transcript too long",
+			inp:       &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "spam", Transcript: strings.Repeat("a", service.MaxTranscriptLen+1)},
+			mockSetup: func(rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrTranscriptTooLong,
+		},
+		{
+			name: "already reported",
+			inp:  &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "hate"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateReport", mock.Anything, mock.Anything, mock.Anything).Return(0, repository.ErrDuplicateReport)
+			},
+			wantErr: true,
+			expErr:  service.ErrAlreadyReported,
+		},
+		{
+			name: "repository error",
+			inp:  &dto.RandomReportDTO{ReporterID: 1, ReportedID: 2, SessionID: "s1", Reason: "hate"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateReport", mock.Anything, mock.Anything, mock.Anything).Return(0, errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			randomRepo := new(mocks.MockRandomRepo)
+			tc.mockSetup(randomRepo)
+
+			srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+			rsp, err := srv.Report(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, rsp)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expID, rsp.ReportID)
+			}
+
+			randomRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_RateRandom(t *testing.T) {
+	testCases := []struct {
+		name      string
+		inp       *dto.RandomRatingDTO
+		mockSetup func(rr *mocks.MockRandomRepo)
+		wantErr   bool
+		expErr    error
+	}{
+		{
+			name: "thumbs up",
+			inp:  &dto.RandomRatingDTO{RaterID: 1, RatedID: 2, SessionID: "s1", Rating: "up"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateRating", mock.Anything, mock.Anything, mock.MatchedBy(func(rt *model.RandomRating) bool {
+					return rt.RaterID == 1 && rt.RatedID == 2 && rt.SessionID == "s1" && rt.Positive
+				})).Return(nil)
+			},
+		},
+		{
+			name: "thumbs down",
+			inp:  &dto.RandomRatingDTO{RaterID: 1, RatedID: 2, SessionID: "s1", Rating: "down"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateRating", mock.Anything, mock.Anything, mock.MatchedBy(func(rt *model.RandomRating) bool {
+					return !rt.Positive
+				})).Return(nil)
+			},
+		},
+		{
+			name:      "invalid rating",
+			inp:       &dto.RandomRatingDTO{RaterID: 1, RatedID: 2, SessionID: "s1", Rating: "meh"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {},
+			wantErr:   true,
+			expErr:    service.ErrInvalidRating,
+		},
+		{
+			name: "already rated",
+			inp:  &dto.RandomRatingDTO{RaterID: 1, RatedID: 2, SessionID: "s1", Rating: "up"},
+			mockSetup: func(rr *mocks.MockRandomRepo) {
+				rr.On("CreateRating", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrDuplicateRating)
+			},
+			wantErr: true,
+			expErr:  service.ErrAlreadyRated,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			randomRepo := new(mocks.MockRandomRepo)
+			tc.mockSetup(randomRepo)
+
+			srv := service.NewRandomService(discardLogger(), new(mocks.MockUserRepo), new(mocks.MockCountryRepo), randomRepo, nil)
+			err := srv.Rate(context.Background(), tc.inp)
+
+			if tc.wantErr {
+				assert.Error(t, err)
+				if tc.expErr != nil {
+					assert.ErrorIs(t, err, tc.expErr)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+
+			randomRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Reputation(t *testing.T) {
+	assert.Equal(t, 0.5, service.Reputation(0, 0))
+	assert.Equal(t, 0.75, service.Reputation(2, 0))
+	assert.Equal(t, 0.25, service.Reputation(0, 2))
+}
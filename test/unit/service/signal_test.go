@@ -0,0 +1,148 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jlry-dev/whirl/internal/config"
+	"github.com/jlry-dev/whirl/internal/model/dto"
+	"github.com/jlry-dev/whirl/internal/service"
+)
+
+func Test_ValidateSignal(t *testing.T) {
+	sdp := "v=0\r\no=- 4611731400430051336 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n"
+	mid := "0"
+	index := 0
+	negative := -1
+
+	testCases := []struct {
+		name   string
+		inp    *dto.SignalDTO
+		expErr error
+	}{
+		{
+			name: "valid offer",
+			inp:  &dto.SignalDTO{Type: "rtc_offer", SDP: sdp},
+		},
+		{
+			name: "valid answer",
+			inp:  &dto.SignalDTO{Type: "rtc_answer", SDP: sdp},
+		},
+		{
+			name: "valid candidate",
+			inp: &dto.SignalDTO{Type: "rtc_ice", Candidate: &dto.IceCandidateDTO{
+				Candidate:     "candidate:842163049 1 udp 1677729535 203.0.113.7 46154 typ srflx raddr 0.0.0.0 rport 0",
+				SDPMid:        &mid,
+				SDPMLineIndex: &index,
+			}},
+		},
+		{
+			name: "end of candidates",
+			inp:  &dto.SignalDTO{Type: "rtc_ice", Candidate: &dto.IceCandidateDTO{}},
+		},
+		{
+			name: "hangup",
+			inp:  &dto.SignalDTO{Type: "rtc_hangup"},
+		},
+		{
+			name:   "offer without sdp",
+			inp:    &dto.SignalDTO{Type: "rtc_offer"},
+			expErr: service.ErrInvalidSignal,
+		},
+		{
+			name:   "offer that is not an sdp",
+			inp:    &dto.SignalDTO{Type: "rtc_offer", SDP: "hello"},
+			expErr: service.ErrInvalidSignal,
+		},
+		{
+			name:   "offer too large",
+			inp:    &dto.SignalDTO{Type: "rtc_offer", SDP: sdp + strings.Repeat("a", service.MaxSDPLen)},
+			expErr: service.ErrSignalTooLarge,
+		},
+		{
+			name:   "ice without candidate",
+			inp:    &dto.SignalDTO{Type: "rtc_ice"},
+			expErr: service.ErrInvalidSignal,
+		},
+		{
+			name:   "malformed candidate",
+			inp:    &dto.SignalDTO{Type: "rtc_ice", Candidate: &dto.IceCandidateDTO{Candidate: "candidate:1\r\na=evil"}},
+			expErr: service.ErrInvalidSignal,
+		},
+		{
+			name:   "candidate too large",
+			inp:    &dto.SignalDTO{Type: "rtc_ice", Candidate: &dto.IceCandidateDTO{Candidate: "candidate:" + strings.Repeat("1", service.MaxCandidateLen)}},
+			expErr: service.ErrSignalTooLarge,
+		},
+		{
+			name:   "negative line index",
+			inp:    &dto.SignalDTO{Type: "rtc_ice", Candidate: &dto.IceCandidateDTO{Candidate: "candidate:1", SDPMLineIndex: &negative}},
+			expErr: service.ErrInvalidSignal,
+		},
+		{
+			name:   "unknown type",
+			inp:    &dto.SignalDTO{Type: "rtc_media", SDP: sdp},
+			expErr: service.ErrInvalidSignal,
+		},
+	}
+
+	srv := service.NewSignalService(discardLogger(), config.RTC{})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := srv.Validate(tc.inp)
+
+			if tc.expErr != nil {
+				assert.ErrorIs(t, err, tc.expErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_IceServers(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("no servers", func(t *testing.T) {
+		srv := service.NewSignalService(discardLogger(), config.RTC{})
+		assert.Empty(t, srv.IceServers(1, now).IceServers)
+	})
+
+	t.Run("static credentials", func(t *testing.T) {
+		srv := service.NewSignalService(discardLogger(), config.RTC{
+			STUNURLs:       []string{"stun:stun.example.com:3478"},
+			TURNURLs:       []string{"turn:turn.example.com:3478"},
+			TURNUsername:   "whirl",
+			TURNCredential: "secret",
+		})
+
+		rsp := srv.IceServers(1, now)
+		assert.Equal(t, []dto.IceServerDTO{
+			{URLs: []string{"stun:stun.example.com:3478"}},
+			{URLs: []string{"turn:turn.example.com:3478"}, Username: "whirl", Credential: "secret"},
+		}, rsp.IceServers)
+		assert.Zero(t, rsp.TTL)
+	})
+
+	t.Run("generated credentials", func(t *testing.T) {
+		srv := service.NewSignalService(discardLogger(), config.RTC{
+			TURNURLs:          []string{"turns:turn.example.com:5349"},
+			TURNUsername:      "ignored",
+			TURNSecret:        "shared",
+			TURNCredentialTTL: time.Hour,
+		})
+
+		rsp := srv.IceServers(7, now)
+		assert.Len(t, rsp.IceServers, 1)
+
+		turn := rsp.IceServers[0]
+		assert.Equal(t, "1735693200:7", turn.Username)
+		assert.Equal(t, service.TURNCredential("shared", turn.Username), turn.Credential)
+		assert.NotEqual(t, service.TURNCredential("other", turn.Username), turn.Credential)
+		assert.Equal(t, 3600, rsp.TTL)
+	})
+}